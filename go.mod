@@ -54,6 +54,7 @@ require (
 	golang.org/x/crypto v0.0.0-20191002192127-34f69633bfdc // indirect
 	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
 	golang.org/x/sys v0.0.0-20191009170203-06d7bd2c5f4f // indirect
+	golang.org/x/text v0.3.2
 	golang.org/x/tools v0.0.0-20191010075000-0337d82405ff // indirect
 	google.golang.org/appengine v1.6.1
 	gopkg.in/olivere/elastic.v5 v5.0.81 // indirect
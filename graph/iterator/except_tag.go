@@ -0,0 +1,254 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph/refs"
+)
+
+// ExceptTag removes paths of the source iterator, for which the value of a tag is found
+// in a tag of any path of the excluded iterator. Paths without the tag are kept.
+//
+// Unlike Not, it compares tag values instead of the values at the end of the paths.
+// All values of the tag in the excluded iterator are loaded into memory before the first result is returned.
+type ExceptTag struct {
+	from       Shape
+	exclude    Shape
+	tag        string
+	excludeTag string
+}
+
+// NewExceptTag creates a new iterator that removes paths of from, if the value of the tag is found in
+// the excludeTag of any path of exclude. If excludeTag is empty, the same tag name is used for both iterators.
+func NewExceptTag(from, exclude Shape, tag, excludeTag string) *ExceptTag {
+	if excludeTag == "" {
+		excludeTag = tag
+	}
+	return &ExceptTag{
+		from:       from,
+		exclude:    exclude,
+		tag:        tag,
+		excludeTag: excludeTag,
+	}
+}
+
+func (it *ExceptTag) Iterate() Scanner {
+	return &exceptTagNext{
+		exceptTagBase: it.newBase(),
+		sub:           it.from.Iterate(),
+	}
+}
+
+func (it *ExceptTag) Lookup() Index {
+	return &exceptTagContains{
+		exceptTagBase: it.newBase(),
+		sub:           it.from.Lookup(),
+	}
+}
+
+func (it *ExceptTag) newBase() exceptTagBase {
+	return exceptTagBase{
+		exclude:    it.exclude,
+		tag:        it.tag,
+		excludeTag: it.excludeTag,
+	}
+}
+
+// SubIterators returns the source iterator and the excluded iterator.
+func (it *ExceptTag) SubIterators() []Shape {
+	return []Shape{it.from, it.exclude}
+}
+
+func (it *ExceptTag) Optimize(ctx context.Context) (Shape, bool) {
+	var opt bool
+	if nit, ok := it.from.Optimize(ctx); ok {
+		it.from, opt = nit, true
+	}
+	if nit, ok := it.exclude.Optimize(ctx); ok {
+		it.exclude, opt = nit, true
+	}
+	return it, opt
+}
+
+// Stats returns the stats of the source iterator. Excluded values are loaded only once,
+// thus their cost is not included.
+func (it *ExceptTag) Stats(ctx context.Context) (Costs, error) {
+	st, err := it.from.Stats(ctx)
+	st.Size.Exact = false
+	return st, err
+}
+
+func (it *ExceptTag) String() string {
+	return "ExceptTag(" + it.tag + ")"
+}
+
+// exceptTagBase holds a set of excluded tag values shared by the scanner and the index.
+type exceptTagBase struct {
+	exclude    Shape
+	tag        string
+	excludeTag string
+
+	set    map[interface{}]struct{}
+	loaded bool
+	err    error
+}
+
+// load reads all values of the tag from the excluded iterator.
+func (it *exceptTagBase) load(ctx context.Context) bool {
+	if it.loaded {
+		return it.err == nil
+	}
+	it.loaded = true
+	it.set = make(map[interface{}]struct{})
+	sc := it.exclude.Iterate()
+	add := func() {
+		m := make(map[string]refs.Ref)
+		sc.TagResults(m)
+		if v, ok := m[it.excludeTag]; ok {
+			it.set[refs.ToKey(v)] = struct{}{}
+		}
+	}
+	for sc.Next(ctx) {
+		add()
+		for sc.NextPath(ctx) {
+			add()
+		}
+	}
+	it.err = sc.Err()
+	if err := sc.Close(); it.err == nil {
+		it.err = err
+	}
+	return it.err == nil
+}
+
+// excluded checks if the current path of the iterator must be removed.
+func (it *exceptTagBase) excluded(sub Base) bool {
+	m := make(map[string]refs.Ref)
+	sub.TagResults(m)
+	v, ok := m[it.tag]
+	if !ok {
+		return false
+	}
+	_, ok = it.set[refs.ToKey(v)]
+	return ok
+}
+
+// skipExcluded advances the iterator to the next path that is not excluded, starting from the current one.
+func (it *exceptTagBase) skipExcluded(ctx context.Context, sub Base) bool {
+	for it.excluded(sub) {
+		if !sub.NextPath(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+type exceptTagNext struct {
+	exceptTagBase
+	sub    Scanner
+	result refs.Ref
+}
+
+func (it *exceptTagNext) Next(ctx context.Context) bool {
+	if !it.load(ctx) {
+		return false
+	}
+	for it.sub.Next(ctx) {
+		if it.skipExcluded(ctx, it.sub) {
+			it.result = it.sub.Result()
+			return true
+		}
+	}
+	return false
+}
+
+func (it *exceptTagNext) NextPath(ctx context.Context) bool {
+	if !it.sub.NextPath(ctx) {
+		return false
+	}
+	return it.skipExcluded(ctx, it.sub)
+}
+
+func (it *exceptTagNext) TagResults(dst map[string]refs.Ref) {
+	it.sub.TagResults(dst)
+}
+
+func (it *exceptTagNext) Result() refs.Ref {
+	return it.result
+}
+
+func (it *exceptTagNext) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.sub.Err()
+}
+
+func (it *exceptTagNext) Close() error {
+	return it.sub.Close()
+}
+
+func (it *exceptTagNext) String() string {
+	return "ExceptTagNext"
+}
+
+type exceptTagContains struct {
+	exceptTagBase
+	sub    Index
+	result refs.Ref
+}
+
+func (it *exceptTagContains) Contains(ctx context.Context, v refs.Ref) bool {
+	if !it.load(ctx) {
+		return false
+	}
+	if !it.sub.Contains(ctx, v) || !it.skipExcluded(ctx, it.sub) {
+		return false
+	}
+	it.result = v
+	return true
+}
+
+func (it *exceptTagContains) NextPath(ctx context.Context) bool {
+	if !it.sub.NextPath(ctx) {
+		return false
+	}
+	return it.skipExcluded(ctx, it.sub)
+}
+
+func (it *exceptTagContains) TagResults(dst map[string]refs.Ref) {
+	it.sub.TagResults(dst)
+}
+
+func (it *exceptTagContains) Result() refs.Ref {
+	return it.result
+}
+
+func (it *exceptTagContains) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.sub.Err()
+}
+
+func (it *exceptTagContains) Close() error {
+	return it.sub.Close()
+}
+
+func (it *exceptTagContains) String() string {
+	return "ExceptTagContains"
+}
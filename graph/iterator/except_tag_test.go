@@ -0,0 +1,71 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestExceptTag(t *testing.T) {
+	ctx := context.TODO()
+	from := func() Shape {
+		return Tag(NewFixed(
+			Int64Node(1),
+			Int64Node(2),
+			Int64Node(3),
+			Int64Node(4),
+		), "x")
+	}
+
+	it := NewExceptTag(from(), Tag(NewFixed(Int64Node(2), Int64Node(4)), "x"), "x", "")
+	for i := 0; i < 2; i++ {
+		require.Equal(t, []int{1, 3}, iterated(it))
+	}
+	idx := it.Lookup()
+	for _, v := range []int{1, 3} {
+		require.True(t, idx.Contains(ctx, Int64Node(v)))
+	}
+	for _, v := range []int{2, 4} {
+		require.False(t, idx.Contains(ctx, Int64Node(v)))
+	}
+	require.NoError(t, idx.Close())
+
+	// different tag names
+	it = NewExceptTag(from(), Tag(NewFixed(Int64Node(2)), "y"), "x", "y")
+	require.Equal(t, []int{1, 3, 4}, iterated(it))
+
+	// paths without the tag are kept
+	it = NewExceptTag(from(), Tag(NewFixed(Int64Node(2)), "y"), "y", "")
+	require.Equal(t, []int{1, 2, 3, 4}, iterated(it))
+}
+
+func TestExceptTagErr(t *testing.T) {
+	ctx := context.TODO()
+	wantErr := errors.New("unique")
+
+	it := NewExceptTag(NewFixed(Int64Node(1)), newTestIterator(false, wantErr), "x", "").Iterate()
+	require.False(t, it.Next(ctx))
+	require.Equal(t, wantErr, it.Err())
+
+	it = NewExceptTag(newTestIterator(false, wantErr), NewFixed(), "x", "").Iterate()
+	require.False(t, it.Next(ctx))
+	require.Equal(t, wantErr, it.Err())
+}
@@ -18,6 +18,7 @@ package iterator
 
 import (
 	"context"
+	"sync"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph/refs"
@@ -33,6 +34,41 @@ type result struct {
 type Materialize struct {
 	sub        Shape
 	expectSize int64
+	cache      *MaterializeCache
+}
+
+// MaterializeCache holds results loaded by Materialize iterators, so they can be shared
+// between iterators built for the same sub-query. It is filled by the first complete scan;
+// scans that were aborted or failed leave it empty.
+type MaterializeCache struct {
+	mu          sync.RWMutex
+	done        bool
+	containsMap map[interface{}]int
+	values      [][]result
+}
+
+// NewMaterializeCache creates an empty cache for Materialize iterators.
+func NewMaterializeCache() *MaterializeCache {
+	return &MaterializeCache{}
+}
+
+func (c *MaterializeCache) load(it *materializeNext) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.done {
+		return false
+	}
+	it.containsMap, it.values = c.containsMap, c.values
+	return true
+}
+
+func (c *MaterializeCache) store(it *materializeNext) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.containsMap, c.values = it.containsMap, it.values
+		c.done = true
+	}
 }
 
 func NewMaterialize(sub Shape) *Materialize {
@@ -46,12 +82,25 @@ func NewMaterializeWithSize(sub Shape, size int64) *Materialize {
 	}
 }
 
+// NewMaterializeCached is the same as NewMaterializeWithSize, but results are shared
+// with all iterators that use the same cache. The sub-iterator is only scanned if the
+// cache is empty.
+func NewMaterializeCached(sub Shape, size int64, cache *MaterializeCache) *Materialize {
+	it := NewMaterializeWithSize(sub, size)
+	it.cache = cache
+	return it
+}
+
 func (it *Materialize) Iterate() Scanner {
-	return newMaterializeNext(it.sub)
+	next := newMaterializeNext(it.sub)
+	next.cache = it.cache
+	return next
 }
 
 func (it *Materialize) Lookup() Index {
-	return newMaterializeContains(it.sub)
+	contains := newMaterializeContains(it.sub)
+	contains.next.cache = it.cache
+	return contains
 }
 
 func (it *Materialize) String() string {
@@ -92,8 +141,9 @@ func (it *Materialize) Stats(ctx context.Context) (Costs, error) {
 }
 
 type materializeNext struct {
-	sub  Shape
-	next Scanner
+	sub   Shape
+	next  Scanner
+	cache *MaterializeCache
 
 	containsMap map[interface{}]int
 	values      [][]result
@@ -202,9 +252,17 @@ func (it *materializeNext) NextPath(ctx context.Context) bool {
 }
 
 func (it *materializeNext) materializeSet(ctx context.Context) {
+	if it.cache != nil && it.cache.load(it) {
+		it.hasRun = true
+		return
+	}
 	i := 0
 	mn := 0
 	for it.next.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			it.err = err
+			break
+		}
 		i++
 		if i > MaterializeLimit {
 			it.aborted = true
@@ -237,7 +295,9 @@ func (it *materializeNext) materializeSet(ctx context.Context) {
 			it.values[index] = append(it.values[index], result{id: id, tags: tags})
 		}
 	}
-	it.err = it.next.Err()
+	if it.err == nil {
+		it.err = it.next.Err()
+	}
 	if it.err == nil && it.aborted {
 		if clog.V(2) {
 			clog.Infof("Aborting subiterator")
@@ -247,6 +307,9 @@ func (it *materializeNext) materializeSet(ctx context.Context) {
 		_ = it.next.Close()
 		it.next = it.sub.Iterate()
 	}
+	if it.err == nil && !it.aborted && it.cache != nil {
+		it.cache.store(it)
+	}
 	it.hasRun = true
 }
 
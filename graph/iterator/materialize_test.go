@@ -62,3 +62,42 @@ func TestMaterializeIteratorErrorAbort(t *testing.T) {
 	require.False(t, mIt.Next(ctx))
 	require.Equal(t, wantErr, mIt.Err())
 }
+
+func TestMaterializeIteratorCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	// This tests that materialization stops when the context is canceled.
+	mIt := NewMaterialize(newInt64(1, 10, true)).Iterate()
+
+	require.False(t, mIt.Next(ctx))
+	require.Equal(t, context.Canceled, mIt.Err())
+}
+
+func TestMaterializeIteratorCache(t *testing.T) {
+	ctx := context.TODO()
+	cache := NewMaterializeCache()
+
+	mIt := NewMaterializeCached(newInt64(1, 3, true), 0, cache).Iterate()
+	for i := 0; i < 3; i++ {
+		require.True(t, mIt.Next(ctx))
+	}
+	require.False(t, mIt.Next(ctx))
+	require.NoError(t, mIt.Close())
+
+	// This tests that the second iterator is served from the cache
+	// and doesn't touch the failing sub-iterator.
+	errIt := newTestIterator(false, errors.New("unique"))
+	mIt = NewMaterializeCached(errIt, 0, cache).Iterate()
+	for i := 0; i < 3; i++ {
+		require.True(t, mIt.Next(ctx))
+		require.NoError(t, mIt.Err())
+	}
+	require.False(t, mIt.Next(ctx))
+	require.NoError(t, mIt.Err())
+
+	cIt := NewMaterializeCached(errIt, 0, cache).Lookup()
+	require.True(t, cIt.Contains(ctx, Int64Node(2)))
+	require.False(t, cIt.Contains(ctx, Int64Node(4)))
+	require.NoError(t, cIt.Err())
+}
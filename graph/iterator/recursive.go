@@ -24,6 +24,9 @@ type Recursive struct {
 	morphism  Morphism
 	maxDepth  int
 	depthTags []string
+
+	maxResults int
+	onTruncate func()
 }
 
 func NewRecursive(it Shape, morphism Morphism, maxDepth int) *Recursive {
@@ -37,18 +40,33 @@ func NewRecursive(it Shape, morphism Morphism, maxDepth int) *Recursive {
 	}
 }
 
+func (it *Recursive) newNext() *recursiveNext {
+	next := newRecursiveNext(it.subIt.Iterate(), it.morphism, it.maxDepth, it.depthTags)
+	next.maxResults, next.onTruncate = it.maxResults, it.onTruncate
+	return next
+}
+
 func (it *Recursive) Iterate() Scanner {
-	return newRecursiveNext(it.subIt.Iterate(), it.morphism, it.maxDepth, it.depthTags)
+	return it.newNext()
 }
 
 func (it *Recursive) Lookup() Index {
-	return newRecursiveContains(newRecursiveNext(it.subIt.Iterate(), it.morphism, it.maxDepth, it.depthTags))
+	return newRecursiveContains(it.newNext())
 }
 
 func (it *Recursive) AddDepthTag(s string) {
 	it.depthTags = append(it.depthTags, s)
 }
 
+// SetMaxResults limits the number of distinct nodes returned by the iterator. Zero or negative value means no limit.
+//
+// Nodes are visited level by level, thus nodes closer to the base are returned first. Nodes that were already
+// returned are not counted twice, the same way they are not returned twice. If there are more nodes
+// than the limit allows, onTruncate is called when the iterator reaches the limit. It may be nil.
+func (it *Recursive) SetMaxResults(n int, onTruncate func()) {
+	it.maxResults, it.onTruncate = n, onTruncate
+}
+
 func (it *Recursive) SubIterators() []Shape {
 	return []Shape{it.subIt}
 }
@@ -102,6 +120,11 @@ type recursiveNext struct {
 	depthTags     []string
 	depthCache    []refs.Ref
 	baseIt        *Fixed
+
+	maxResults int
+	returned   int
+	onTruncate func()
+	truncated  bool
 }
 
 func newRecursiveNext(it Scanner, morphism Morphism, maxDepth int, depthTags []string) *recursiveNext {
@@ -138,6 +161,24 @@ func (it *recursiveNext) TagResults(dst map[string]refs.Ref) {
 }
 
 func (it *recursiveNext) Next(ctx context.Context) bool {
+	if it.maxResults > 0 && it.returned >= it.maxResults {
+		// check if there are more results to report the truncation
+		if !it.truncated && it.next(ctx) {
+			it.truncated = true
+			if it.onTruncate != nil {
+				it.onTruncate()
+			}
+		}
+		return false
+	}
+	if !it.next(ctx) {
+		return false
+	}
+	it.returned++
+	return true
+}
+
+func (it *recursiveNext) next(ctx context.Context) bool {
 	it.pathIndex = 0
 	if it.depth == 0 {
 		for it.subIt.Next(ctx) {
@@ -70,6 +70,36 @@ func TestRecursiveNext(t *testing.T) {
 	require.Equal(t, expected, got)
 }
 
+func TestRecursiveMaxResults(t *testing.T) {
+	ctx := context.TODO()
+	qs := recTestQs
+	for _, c := range []struct {
+		max       int
+		expected  []string
+		truncated bool
+	}{
+		{max: 2, expected: []string{"bob", "charlie"}, truncated: true},
+		{max: 3, expected: []string{"bob", "charlie", "dani"}, truncated: true},
+		// bob is reachable twice, but it's returned and counted only once
+		{max: 4, expected: []string{"bob", "charlie", "dani", "emily"}},
+		{max: 10, expected: []string{"bob", "charlie", "dani", "emily"}},
+	} {
+		start := NewFixed()
+		start.Add(refs.PreFetched(quad.Raw("alice")))
+		truncated := false
+		rec := NewRecursive(start, singleHop(qs, "parent"), 0)
+		rec.SetMaxResults(c.max, func() { truncated = true })
+		r := rec.Iterate()
+
+		var got []string
+		for r.Next(ctx) {
+			got = append(got, quad.ToString(qs.NameOf(r.Result())))
+		}
+		require.Equal(t, c.expected, got, "max: %d", c.max)
+		require.Equal(t, c.truncated, truncated, "max: %d", c.max)
+	}
+}
+
 func TestRecursiveContains(t *testing.T) {
 	ctx := context.TODO()
 	qs := recTestQs
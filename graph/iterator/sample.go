@@ -0,0 +1,180 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph/refs"
+)
+
+var _ Shape = &Sample{}
+
+// Sample iterator returns a random subset of up to N values from the sub-iterator.
+//
+// All values of the sub-iterator are loaded into memory and ordered the same way as with Sort
+// before the sample is taken. Thus, the sample only depends on the random source and on the set
+// of values, but not on the order in which the sub-iterator returns them. Sampled values are
+// returned in this order as well.
+type Sample struct {
+	namer refs.Namer
+	subIt Shape
+	n     int
+	rnd   *rand.Rand
+}
+
+// NewSample creates a new Sample iterator that selects n values using a given random source.
+// If rnd is nil, a new source seeded with the current time is used.
+func NewSample(namer refs.Namer, subIt Shape, n int, rnd *rand.Rand) *Sample {
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &Sample{namer: namer, subIt: subIt, n: n, rnd: rnd}
+}
+
+func (it *Sample) newNext() *sortNext {
+	next := newSortNext(it.namer, it.subIt.Iterate())
+	next.pick = it.pick
+	return next
+}
+
+// pick selects n random values, preserving their order.
+func (it *Sample) pick(v sortByValue) sortByValue {
+	if it.n <= 0 {
+		return nil
+	} else if len(v) <= it.n {
+		return v
+	}
+	// partial Fisher-Yates shuffle of indexes
+	idx := make([]int, len(v))
+	for i := range idx {
+		idx[i] = i
+	}
+	for i := 0; i < it.n; i++ {
+		j := i + it.rnd.Intn(len(idx)-i)
+		idx[i], idx[j] = idx[j], idx[i]
+	}
+	idx = idx[:it.n]
+	sort.Ints(idx)
+	out := make(sortByValue, 0, it.n)
+	for _, i := range idx {
+		out = append(out, v[i])
+	}
+	return out
+}
+
+func (it *Sample) Iterate() Scanner {
+	return it.newNext()
+}
+
+func (it *Sample) Lookup() Index {
+	return &sampleContains{next: it.newNext()}
+}
+
+func (it *Sample) Optimize(ctx context.Context) (Shape, bool) {
+	newIt, optimized := it.subIt.Optimize(ctx)
+	if optimized {
+		it.subIt = newIt
+	}
+	return it, false
+}
+
+func (it *Sample) Stats(ctx context.Context) (Costs, error) {
+	subStats, err := it.subIt.Stats(ctx)
+	size := subStats.Size
+	if size.Value > int64(it.n) {
+		size.Value = int64(it.n)
+	}
+	return Costs{
+		NextCost:     subStats.NextCost * 2,
+		ContainsCost: subStats.NextCost * 2,
+		Size:         size,
+	}, err
+}
+
+func (it *Sample) String() string {
+	return "Sample"
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Sample) SubIterators() []Shape {
+	return []Shape{it.subIt}
+}
+
+// sampleContains checks if the value is a part of the sample. The sample is taken on the first call.
+type sampleContains struct {
+	next      *sortNext
+	keys      map[interface{}]int
+	cur       int
+	pathIndex int
+	result    result
+}
+
+func (it *sampleContains) TagResults(dst map[string]refs.Ref) {
+	for tag, value := range it.result.tags {
+		dst[tag] = value
+	}
+}
+
+func (it *sampleContains) Err() error {
+	return it.next.Err()
+}
+
+func (it *sampleContains) Result() refs.Ref {
+	return it.result.id
+}
+
+func (it *sampleContains) Contains(ctx context.Context, v refs.Ref) bool {
+	if it.keys == nil {
+		if !it.next.load(ctx) {
+			return false
+		}
+		it.keys = make(map[interface{}]int, len(it.next.ordered))
+		for i, r := range it.next.ordered {
+			it.keys[refs.ToKey(r.id)] = i
+		}
+	}
+	i, ok := it.keys[refs.ToKey(v)]
+	if !ok {
+		return false
+	}
+	it.cur, it.pathIndex = i, -1
+	it.result = it.next.ordered[i].result
+	return true
+}
+
+func (it *sampleContains) NextPath(ctx context.Context) bool {
+	if it.keys == nil {
+		return false
+	}
+	r := it.next.ordered[it.cur]
+	if it.pathIndex+1 >= len(r.paths) {
+		return false
+	}
+	it.pathIndex++
+	it.result = r.paths[it.pathIndex]
+	return true
+}
+
+func (it *sampleContains) Close() error {
+	return it.next.Close()
+}
+
+func (it *sampleContains) String() string {
+	return "SampleContains"
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/quad"
+)
+
+func TestSample(t *testing.T) {
+	var qs valueNamer
+	fixed := NewFixed()
+	for i := 0; i < 20; i++ {
+		qs = append(qs, quad.Int(i))
+		fixed.Add(Int64Node(i))
+	}
+	sample := func(seed int64, n int) []quad.Value {
+		it := NewSample(qs, fixed, n, rand.New(rand.NewSource(seed)))
+		return mapValues(t, qs, it)
+	}
+	s1 := sample(1, 5)
+	require.Len(t, s1, 5)
+	for i := 1; i < len(s1); i++ {
+		require.True(t, CompareValues(s1[i-1], s1[i]) < 0, "expected ordered sample: %v", s1)
+	}
+	require.Equal(t, s1, sample(1, 5))
+	require.Len(t, sample(1, 30), 20)
+	require.Len(t, sample(1, 0), 0)
+
+	ctx := context.TODO()
+	ix := NewSample(qs, fixed, 5, rand.New(rand.NewSource(1))).Lookup()
+	defer ix.Close()
+	var in []quad.Value
+	for i := range qs {
+		if ix.Contains(ctx, Int64Node(i)) {
+			in = append(in, qs.NameOf(ix.Result()))
+		}
+	}
+	require.NoError(t, ix.Err())
+	require.Equal(t, s1, in)
+}
@@ -0,0 +1,250 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph/refs"
+)
+
+// SkipLast iterator will omit a certain number of values at the end of the result set.
+//
+// The iterator has to read n values ahead, thus up to n values with all their paths are kept in memory.
+// Zero and negative values means that nothing is skipped.
+type SkipLast struct {
+	n  int64
+	it Shape
+}
+
+func NewSkipLast(it Shape, n int64) *SkipLast {
+	return &SkipLast{
+		n:  n,
+		it: it,
+	}
+}
+
+func (it *SkipLast) Iterate() Scanner {
+	return newSkipLastNext(it.it.Iterate(), it.n)
+}
+
+func (it *SkipLast) Lookup() Index {
+	return newSkipLastContains(newSkipLastNext(it.it.Iterate(), it.n))
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *SkipLast) SubIterators() []Shape {
+	return []Shape{it.it}
+}
+
+func (it *SkipLast) Optimize(ctx context.Context) (Shape, bool) {
+	nit, optimized := it.it.Optimize(ctx)
+	if it.n <= 0 {
+		return nit, true
+	}
+	it.it = nit
+	return it, optimized
+}
+
+func (it *SkipLast) Stats(ctx context.Context) (Costs, error) {
+	st, err := it.it.Stats(ctx)
+	if it.n > 0 {
+		if st.Size.Value > it.n {
+			st.Size.Value -= it.n
+		} else {
+			st.Size.Value = 0
+		}
+		// lookup requires a full scan
+		st.ContainsCost = st.NextCost
+	}
+	return st, err
+}
+
+func (it *SkipLast) String() string {
+	return fmt.Sprintf("SkipLast(%d)", it.n)
+}
+
+// skipLastValue is a single result of the sub-iterator with all its paths.
+type skipLastValue struct {
+	result
+	paths []result
+}
+
+type skipLastNext struct {
+	n         int64
+	it        Scanner
+	buf       []skipLastValue
+	cur       skipLastValue
+	result    result
+	pathIndex int
+	done      bool
+}
+
+func newSkipLastNext(it Scanner, n int64) *skipLastNext {
+	return &skipLastNext{
+		n:  n,
+		it: it,
+	}
+}
+
+func (it *skipLastNext) TagResults(dst map[string]refs.Ref) {
+	for tag, value := range it.result.tags {
+		dst[tag] = value
+	}
+}
+
+func (it *skipLastNext) readValue(ctx context.Context) (skipLastValue, bool) {
+	if it.done || !it.it.Next(ctx) {
+		it.done = true
+		return skipLastValue{}, false
+	}
+	id := it.it.Result()
+	tags := make(map[string]refs.Ref)
+	it.it.TagResults(tags)
+	v := skipLastValue{result: result{id, tags}}
+	for it.it.NextPath(ctx) {
+		tags = make(map[string]refs.Ref)
+		it.it.TagResults(tags)
+		v.paths = append(v.paths, result{id, tags})
+	}
+	return v, true
+}
+
+// Next advances the iterator. It reads up to n values ahead to make sure the current one is not one of the last n values.
+func (it *skipLastNext) Next(ctx context.Context) bool {
+	if it.n <= 0 {
+		// fast path
+		v, ok := it.readValue(ctx)
+		if !ok {
+			return false
+		}
+		it.setCurrent(v)
+		return true
+	}
+	for int64(len(it.buf)) <= it.n {
+		v, ok := it.readValue(ctx)
+		if !ok {
+			it.buf = nil
+			return false
+		}
+		it.buf = append(it.buf, v)
+	}
+	v := it.buf[0]
+	it.buf = it.buf[1:]
+	it.setCurrent(v)
+	return true
+}
+
+func (it *skipLastNext) setCurrent(v skipLastValue) {
+	it.cur = v
+	it.result = v.result
+	it.pathIndex = -1
+}
+
+func (it *skipLastNext) Err() error {
+	return it.it.Err()
+}
+
+func (it *skipLastNext) Result() refs.Ref {
+	return it.result.id
+}
+
+func (it *skipLastNext) NextPath(ctx context.Context) bool {
+	if it.pathIndex+1 >= len(it.cur.paths) {
+		return false
+	}
+	it.pathIndex++
+	it.result = it.cur.paths[it.pathIndex]
+	return true
+}
+
+// Close closes the primary and all iterators.  It closes all subiterators
+// it can, but returns the first error it encounters.
+func (it *skipLastNext) Close() error {
+	it.buf = nil
+	return it.it.Close()
+}
+
+func (it *skipLastNext) String() string {
+	return fmt.Sprintf("SkipLastNext(%d)", it.n)
+}
+
+// skipLastContains scans the sub-iterator on the first call to Contains, since it's impossible
+// to tell if the value is one of the last values without reading all of them.
+type skipLastContains struct {
+	next   *skipLastNext
+	values map[interface{}]skipLastValue
+	err    error
+	cur    skipLastValue
+	result result
+	path   int
+}
+
+func newSkipLastContains(next *skipLastNext) *skipLastContains {
+	return &skipLastContains{next: next}
+}
+
+func (it *skipLastContains) TagResults(dst map[string]refs.Ref) {
+	for tag, value := range it.result.tags {
+		dst[tag] = value
+	}
+}
+
+func (it *skipLastContains) Err() error {
+	return it.err
+}
+
+func (it *skipLastContains) Result() refs.Ref {
+	return it.result.id
+}
+
+func (it *skipLastContains) Contains(ctx context.Context, val refs.Ref) bool {
+	if it.values == nil {
+		it.values = make(map[interface{}]skipLastValue)
+		for it.next.Next(ctx) {
+			it.values[refs.ToKey(it.next.Result())] = it.next.cur
+		}
+		if it.err = it.next.Err(); it.err != nil {
+			return false
+		}
+	}
+	v, ok := it.values[refs.ToKey(val)]
+	if !ok {
+		return false
+	}
+	it.cur, it.result, it.path = v, v.result, -1
+	return true
+}
+
+func (it *skipLastContains) NextPath(ctx context.Context) bool {
+	if it.path+1 >= len(it.cur.paths) {
+		return false
+	}
+	it.path++
+	it.result = it.cur.paths[it.path]
+	return true
+}
+
+// Close closes the primary and all iterators.  It closes all subiterators
+// it can, but returns the first error it encounters.
+func (it *skipLastContains) Close() error {
+	it.values = nil
+	return it.next.Close()
+}
+
+func (it *skipLastContains) String() string {
+	return fmt.Sprintf("SkipLastContains(%d)", it.next.n)
+}
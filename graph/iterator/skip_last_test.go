@@ -0,0 +1,40 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestSkipLastIteratorBasics(t *testing.T) {
+	ctx := context.TODO()
+	allIt := NewFixed(
+		Int64Node(1),
+		Int64Node(2),
+		Int64Node(3),
+		Int64Node(4),
+		Int64Node(5),
+	)
+
+	u := NewSkipLast(allIt, 0)
+	require.Equal(t, []int{1, 2, 3, 4, 5}, iterated(u))
+
+	u = NewSkipLast(allIt, 2)
+	sz, _ := u.Stats(ctx)
+	require.Equal(t, int64(3), sz.Size.Value)
+	require.Equal(t, []int{1, 2, 3}, iterated(u))
+
+	uc := u.Lookup()
+	for _, v := range []int{3, 2, 1} {
+		require.True(t, uc.Contains(ctx, Int64Node(v)))
+	}
+	for _, v := range []int{4, 5} {
+		require.False(t, uc.Contains(ctx, Int64Node(v)))
+	}
+
+	u = NewSkipLast(allIt, 5)
+	require.Empty(t, iterated(u))
+}
@@ -3,25 +3,41 @@ package iterator
 import (
 	"context"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/quad"
 )
 
 // Sort iterator orders values from it's subiterator.
+//
+// Values are ordered by CompareValues, thus the order is the same for all backends,
+// even if the set contains values of different types.
 type Sort struct {
 	namer refs.Namer
 	subIt Shape
+	desc  bool
 }
 
 // NewSort creates a new Sort iterator.
 // TODO(dennwc): This iterator must not be used inside And: it may be moved to a Contains branch and won't do anything.
 //               We should make And/Intersect account for this.
 func NewSort(namer refs.Namer, subIt Shape) *Sort {
-	return &Sort{namer, subIt}
+	return &Sort{namer: namer, subIt: subIt}
+}
+
+// NewSortDesc is the same as NewSort, but orders values in descending order.
+func NewSortDesc(namer refs.Namer, subIt Shape) *Sort {
+	return &Sort{namer: namer, subIt: subIt, desc: true}
 }
 
 func (it *Sort) Iterate() Scanner {
-	return newSortNext(it.namer, it.subIt.Iterate())
+	next := newSortNext(it.namer, it.subIt.Iterate())
+	if it.desc {
+		next.pick = reverseValues
+	}
+	return next
 }
 
 func (it *Sort) Lookup() Index {
@@ -53,6 +69,9 @@ func (it *Sort) Stats(ctx context.Context) (Costs, error) {
 }
 
 func (it *Sort) String() string {
+	if it.desc {
+		return "Sort(desc)"
+	}
 	return "Sort"
 }
 
@@ -61,23 +80,150 @@ func (it *Sort) SubIterators() []Shape {
 	return []Shape{it.subIt}
 }
 
+// valueKind returns the rank of the value type in the total order defined by CompareValues.
+func valueKind(v quad.Value) int {
+	switch v.(type) {
+	case quad.IRI:
+		return 0
+	case quad.BNode:
+		return 1
+	case quad.String, quad.LangString, quad.TypedString:
+		return 2
+	case quad.Int, quad.Float:
+		return 3
+	case quad.Bool:
+		return 4
+	case quad.Time:
+		return 5
+	case nil:
+		return 7
+	}
+	return 6
+}
+
+// plainString returns a string value without language and type tags.
+func plainString(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.IRI:
+		return string(v)
+	case quad.BNode:
+		return string(v)
+	case quad.String:
+		return string(v)
+	case quad.LangString:
+		return string(v.Value)
+	case quad.TypedString:
+		return string(v.Value)
+	}
+	return v.String()
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return +1
+	}
+	return 0
+}
+
+func compareNumbers(a, b quad.Value) int {
+	if ai, ok := a.(quad.Int); ok {
+		if bi, ok := b.(quad.Int); ok {
+			if ai < bi {
+				return -1
+			} else if ai > bi {
+				return +1
+			}
+			return 0
+		}
+	}
+	toFloat := func(v quad.Value) float64 {
+		switch v := v.(type) {
+		case quad.Int:
+			return float64(v)
+		case quad.Float:
+			return float64(v)
+		}
+		return 0
+	}
+	return compareFloats(toFloat(a), toFloat(b))
+}
+
+// CompareValues defines a total order on all quad values. It returns -1 if a < b, +1 if a > b and 0 if they are equal.
+//
+// Values of different types are ordered by kind first:
+//
+//	IRIs < blank nodes < strings < numbers < booleans < times < other values < nil
+//
+// Values of the same kind are ordered naturally: strings and IRIs lexicographically (language and type tags are ignored),
+// numbers numerically (integers and floats are comparable), false before true, and times chronologically.
+// Values that are equal on this step are ordered by their string representation.
+func CompareValues(a, b quad.Value) int {
+	ka, kb := valueKind(a), valueKind(b)
+	if ka != kb {
+		if ka < kb {
+			return -1
+		}
+		return +1
+	}
+	var c int
+	switch ka {
+	case 0, 1, 2:
+		c = strings.Compare(plainString(a), plainString(b))
+	case 3:
+		c = compareNumbers(a, b)
+	case 4:
+		ab, bb := bool(a.(quad.Bool)), bool(b.(quad.Bool))
+		if ab != bb {
+			if !ab {
+				c = -1
+			} else {
+				c = +1
+			}
+		}
+	case 5:
+		at, bt := time.Time(a.(quad.Time)), time.Time(b.(quad.Time))
+		if at.Before(bt) {
+			c = -1
+		} else if at.After(bt) {
+			c = +1
+		}
+	case 7:
+		return 0
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
 type sortValue struct {
 	result
-	str   string
+	val   quad.Value
 	paths []result
 }
-type sortByString []sortValue
+type sortByValue []sortValue
 
-func (v sortByString) Len() int { return len(v) }
-func (v sortByString) Less(i, j int) bool {
-	return v[i].str < v[j].str
+func (v sortByValue) Len() int { return len(v) }
+func (v sortByValue) Less(i, j int) bool {
+	return CompareValues(v[i].val, v[j].val) < 0
+}
+func (v sortByValue) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+
+// reverseValues reverses the order of values in place.
+func reverseValues(v sortByValue) sortByValue {
+	for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+		v[i], v[j] = v[j], v[i]
+	}
+	return v
 }
-func (v sortByString) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
 
 type sortNext struct {
 	namer     refs.Namer
 	subIt     Scanner
-	ordered   sortByString
+	pick      func(sortByValue) sortByValue // optional; selects a subset of ordered values
+	ordered   sortByValue
 	result    result
 	err       error
 	index     int
@@ -110,13 +256,8 @@ func (it *sortNext) Next(ctx context.Context) bool {
 	if it.err != nil {
 		return false
 	}
-	if it.ordered == nil {
-		v, err := getSortedValues(ctx, it.namer, it.subIt)
-		it.ordered = v
-		it.err = err
-		if it.err != nil {
-			return false
-		}
+	if !it.load(ctx) {
+		return false
 	}
 	if it.index >= len(it.ordered) {
 		return false
@@ -127,6 +268,28 @@ func (it *sortNext) Next(ctx context.Context) bool {
 	return true
 }
 
+// load reads and sorts all values from the sub-iterator, if it wasn't done yet.
+func (it *sortNext) load(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	} else if it.ordered != nil {
+		return true
+	}
+	v, err := getSortedValues(ctx, it.namer, it.subIt)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if it.pick != nil {
+		v = it.pick(v)
+	}
+	if v == nil {
+		v = sortByValue{}
+	}
+	it.ordered = v
+	return true
+}
+
 func (it *sortNext) NextPath(ctx context.Context) bool {
 	if it.index >= len(it.ordered) {
 		return false
@@ -149,18 +312,17 @@ func (it *sortNext) String() string {
 	return "SortNext"
 }
 
-func getSortedValues(ctx context.Context, namer refs.Namer, it Scanner) (sortByString, error) {
-	var v sortByString
+func getSortedValues(ctx context.Context, namer refs.Namer, it Scanner) (sortByValue, error) {
+	var v sortByValue
 	for it.Next(ctx) {
 		id := it.Result()
 		// TODO(dennwc): batch and use refs.ValuesOf
 		name := namer.NameOf(id)
-		str := name.String()
 		tags := make(map[string]refs.Ref)
 		it.TagResults(tags)
 		val := sortValue{
 			result: result{id, tags},
-			str:    str,
+			val:    name,
 		}
 		for it.NextPath(ctx) {
 			tags = make(map[string]refs.Ref)
@@ -172,6 +334,6 @@ func getSortedValues(ctx context.Context, namer refs.Namer, it Scanner) (sortByS
 	if err := it.Err(); err != nil {
 		return v, err
 	}
-	sort.Sort(v)
+	sort.Stable(v)
 	return v, nil
 }
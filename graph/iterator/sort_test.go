@@ -0,0 +1,130 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/quad"
+)
+
+// valueNamer resolves Int64Node to a value at the corresponding index.
+type valueNamer []quad.Value
+
+func (qs valueNamer) ValueOf(v quad.Value) refs.Ref {
+	for i, v2 := range qs {
+		if CompareValues(v, v2) == 0 {
+			return Int64Node(i)
+		}
+	}
+	return nil
+}
+
+func (qs valueNamer) NameOf(v refs.Ref) quad.Value {
+	i, ok := v.(Int64Node)
+	if !ok || i < 0 || int(i) >= len(qs) {
+		return nil
+	}
+	return qs[i]
+}
+
+func TestSortMixed(t *testing.T) {
+	t1 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	qs := valueNamer{
+		quad.Time(t2),
+		quad.Int(10),
+		quad.String("b"),
+		quad.IRI("b"),
+		quad.Float(2.5),
+		quad.Time(t1),
+		quad.LangString{Value: "a", Lang: "en"},
+		quad.Int(9),
+		quad.IRI("a"),
+		quad.String("a"),
+		quad.BNode("x"),
+		quad.Bool(true),
+	}
+	fixed := NewFixed()
+	for i := range qs {
+		fixed.Add(Int64Node(i))
+	}
+
+	ctx := context.TODO()
+	it := NewSort(qs, fixed).Iterate()
+	defer it.Close()
+	var got []quad.Value
+	for it.Next(ctx) {
+		got = append(got, qs.NameOf(it.Result()))
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []quad.Value{
+		quad.IRI("a"),
+		quad.IRI("b"),
+		quad.BNode("x"),
+		quad.String("a"),
+		quad.LangString{Value: "a", Lang: "en"},
+		quad.String("b"),
+		quad.Float(2.5),
+		quad.Int(9),
+		quad.Int(10),
+		quad.Bool(true),
+		quad.Time(t1),
+		quad.Time(t2),
+	}, got)
+}
+
+func TestSortDesc(t *testing.T) {
+	qs := valueNamer{
+		quad.Int(2),
+		quad.String("b"),
+		quad.Int(10),
+		quad.String("a"),
+	}
+	fixed := NewFixed()
+	for i := range qs {
+		fixed.Add(Int64Node(i))
+	}
+
+	ctx := context.TODO()
+	it := NewSortDesc(qs, fixed).Iterate()
+	defer it.Close()
+	var got []quad.Value
+	for it.Next(ctx) {
+		got = append(got, qs.NameOf(it.Result()))
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []quad.Value{
+		quad.Int(10),
+		quad.Int(2),
+		quad.String("b"),
+		quad.String("a"),
+	}, got)
+}
+
+func TestCompareValues(t *testing.T) {
+	require.Equal(t, 0, CompareValues(quad.Int(1), quad.Int(1)))
+	require.Equal(t, -1, CompareValues(quad.Int(1), quad.Float(1.5)))
+	require.Equal(t, +1, CompareValues(quad.String("a"), quad.IRI("b")))
+	require.Equal(t, -1, CompareValues(quad.Bool(false), quad.Bool(true)))
+	require.Equal(t, -1, CompareValues(quad.IRI("a"), nil))
+	require.Equal(t, 0, CompareValues(nil, nil))
+}
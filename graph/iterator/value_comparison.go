@@ -59,45 +59,116 @@ const (
 	// Why no Equals? Because that's usually an AndIterator.
 )
 
+// NewComparison returns an iterator that passes only values that compare with val using op.
+//
+// Values of different types never pass the comparison, with an exception of numeric typed strings:
+// if either value is a quad.TypedString with one of quad.KnownIntTypes or quad.KnownFloatTypes datatypes,
+// and the other value is a number or a numeric typed string, values are compared numerically.
+// Typed strings that cannot be parsed as numbers are compared lexically.
 func NewComparison(sub Shape, op Operator, val quad.Value, qs refs.Namer) Shape {
 	return NewValueFilter(qs, sub, func(qval quad.Value) (bool, error) {
-		switch cVal := val.(type) {
-		case quad.Int:
-			if cVal2, ok := qval.(quad.Int); ok {
-				return RunIntOp(cVal2, op, cVal), nil
-			}
-			return false, nil
-		case quad.Float:
-			if cVal2, ok := qval.(quad.Float); ok {
-				return RunFloatOp(cVal2, op, cVal), nil
-			}
-			return false, nil
-		case quad.String:
-			if cVal2, ok := qval.(quad.String); ok {
-				return RunStrOp(string(cVal2), op, string(cVal)), nil
-			}
-			return false, nil
-		case quad.BNode:
-			if cVal2, ok := qval.(quad.BNode); ok {
-				return RunStrOp(string(cVal2), op, string(cVal)), nil
-			}
-			return false, nil
-		case quad.IRI:
-			if cVal2, ok := qval.(quad.IRI); ok {
-				return RunStrOp(string(cVal2), op, string(cVal)), nil
-			}
-			return false, nil
-		case quad.Time:
-			if cVal2, ok := qval.(quad.Time); ok {
-				return RunTimeOp(time.Time(cVal2), op, time.Time(cVal)), nil
-			}
-			return false, nil
-		default:
-			return RunStrOp(quad.StringOf(qval), op, quad.StringOf(val)), nil
-		}
+		return RunValueOp(qval, op, val), nil
 	})
 }
 
+// RunValueOp compares two values using op, the same way as the Comparison iterator does.
+// See NewComparison for details.
+func RunValueOp(qval quad.Value, op Operator, val quad.Value) bool {
+	if a, b, ok := typedNumbers(qval, val); ok {
+		return RunNumOp(a, op, b)
+	}
+	switch cVal := val.(type) {
+	case quad.Int:
+		if cVal2, ok := qval.(quad.Int); ok {
+			return RunIntOp(cVal2, op, cVal)
+		}
+		return false
+	case quad.Float:
+		if cVal2, ok := qval.(quad.Float); ok {
+			return RunFloatOp(cVal2, op, cVal)
+		}
+		return false
+	case quad.String:
+		if cVal2, ok := qval.(quad.String); ok {
+			return RunStrOp(string(cVal2), op, string(cVal))
+		}
+		return false
+	case quad.BNode:
+		if cVal2, ok := qval.(quad.BNode); ok {
+			return RunStrOp(string(cVal2), op, string(cVal))
+		}
+		return false
+	case quad.IRI:
+		if cVal2, ok := qval.(quad.IRI); ok {
+			return RunStrOp(string(cVal2), op, string(cVal))
+		}
+		return false
+	case quad.Time:
+		if cVal2, ok := qval.(quad.Time); ok {
+			return RunTimeOp(time.Time(cVal2), op, time.Time(cVal))
+		}
+		return false
+	default:
+		return RunStrOp(quad.StringOf(qval), op, quad.StringOf(val))
+	}
+}
+
+// numericValue returns a numeric value for quad.Int, quad.Float and numeric quad.TypedString.
+func numericValue(v quad.Value) (quad.Value, bool) {
+	if ts, ok := v.(quad.TypedString); ok {
+		pv, err := ts.ParseValue()
+		if err != nil {
+			return nil, false
+		}
+		v = pv
+	}
+	switch v.(type) {
+	case quad.Int, quad.Float:
+		return v, true
+	}
+	return nil, false
+}
+
+// typedNumbers converts both values to numbers if at least one of them is a typed string.
+func typedNumbers(a, b quad.Value) (quad.Value, quad.Value, bool) {
+	_, ok1 := a.(quad.TypedString)
+	_, ok2 := b.(quad.TypedString)
+	if !ok1 && !ok2 {
+		return nil, nil, false
+	}
+	na, ok := numericValue(a)
+	if !ok {
+		return nil, nil, false
+	}
+	nb, ok := numericValue(b)
+	if !ok {
+		return nil, nil, false
+	}
+	return na, nb, true
+}
+
+// RunNumOp compares two numeric values. Both values must be either quad.Int or quad.Float.
+// If one of the values is a quad.Float, both values are compared as floats.
+func RunNumOp(a quad.Value, op Operator, b quad.Value) bool {
+	ai, ok1 := a.(quad.Int)
+	bi, ok2 := b.(quad.Int)
+	if ok1 && ok2 {
+		return RunIntOp(ai, op, bi)
+	}
+	return RunFloatOp(toFloat(a), op, toFloat(b))
+}
+
+func toFloat(v quad.Value) quad.Float {
+	switch v := v.(type) {
+	case quad.Int:
+		return quad.Float(v)
+	case quad.Float:
+		return v
+	default:
+		panic(fmt.Errorf("unexpected numeric value: %T", v))
+	}
+}
+
 func RunIntOp(a quad.Int, op Operator, b quad.Int) bool {
 	switch op {
 	case CompareLT:
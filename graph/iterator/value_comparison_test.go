@@ -26,12 +26,22 @@ import (
 	. "github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/refs"
 	"github.com/cayleygraph/quad"
+	"github.com/cayleygraph/quad/voc/xsd"
 )
 
 var (
 	simpleStore = &graphmock.Oldstore{Data: []string{"0", "1", "2", "3", "4", "5"}, Parse: true}
 	stringStore = &graphmock.Oldstore{Data: []string{"foo", "bar", "baz", "echo"}, Parse: true}
 	mixedStore  = &graphmock.Oldstore{Data: []string{"0", "1", "2", "3", "4", "5", "foo", "bar", "baz", "echo"}, Parse: true}
+	typedStore  = valueNamer{
+		quad.TypedString{Value: "1", Type: xsd.Integer},
+		quad.TypedString{Value: "10", Type: xsd.Integer},
+		quad.TypedString{Value: "2.5", Type: xsd.Double},
+		quad.TypedString{Value: "x", Type: xsd.Integer},
+		quad.Int(3),
+		quad.Float(4.5),
+		quad.String("5"),
+	}
 )
 
 func simpleFixedIterator() *Fixed {
@@ -50,6 +60,14 @@ func stringFixedIterator() *Fixed {
 	return f
 }
 
+func typedFixedIterator() *Fixed {
+	f := NewFixed()
+	for i := range typedStore {
+		f.Add(Int64Node(i))
+	}
+	return f
+}
+
 func mixedFixedIterator() *Fixed {
 	f := NewFixed()
 	for i := 0; i < len(mixedStore.Data); i++ {
@@ -138,6 +156,29 @@ var comparisonTests = []struct {
 		qs:       stringStore,
 		iterator: stringFixedIterator,
 	},
+	{
+		message:  "successful int greater than comparison (typed strings)",
+		operand:  quad.Int(2),
+		operator: CompareGT,
+		expect: []quad.Value{
+			quad.TypedString{Value: "10", Type: xsd.Integer},
+			quad.TypedString{Value: "2.5", Type: xsd.Double},
+			quad.Int(3),
+		},
+		qs:       typedStore,
+		iterator: typedFixedIterator,
+	},
+	{
+		message:  "successful typed string less than comparison",
+		operand:  quad.TypedString{Value: "3", Type: xsd.Integer},
+		operator: CompareLT,
+		expect: []quad.Value{
+			quad.TypedString{Value: "1", Type: xsd.Integer},
+			quad.TypedString{Value: "2.5", Type: xsd.Double},
+		},
+		qs:       typedStore,
+		iterator: typedFixedIterator,
+	},
 }
 
 func TestValueComparison(t *testing.T) {
@@ -269,3 +310,37 @@ func TestComparisonIteratorErr(t *testing.T) {
 		require.Equal(t, wantErr, vc.Err())
 	}
 }
+
+func TestAnyValueFilter(t *testing.T) {
+	builds := 0
+	it := NewAnyValueFilter(simpleFixedIterator(), func(cur Shape) []Shape {
+		builds++
+		eq := func(n quad.Int) Shape {
+			return NewValueFilter(simpleStore, cur, func(v quad.Value) (bool, error) {
+				return v == n, nil
+			})
+		}
+		return []Shape{eq(3), eq(1)}
+	})
+	require.Equal(t, []quad.Value{quad.Int(1), quad.Int(3)}, mapValues(t, simpleStore, it))
+	require.Equal(t, []quad.Value{quad.Int(1), quad.Int(3)}, mapValues(t, simpleStore, it))
+	require.Equal(t, 1, builds)
+
+	ctx := context.TODO()
+	ix := it.Lookup()
+	defer ix.Close()
+	require.True(t, ix.Contains(ctx, Int64Node(3)))
+	require.False(t, ix.Contains(ctx, Int64Node(2)))
+	require.NoError(t, ix.Err())
+
+	// filters are checked with the context of the scan
+	it = NewAnyValueFilter(simpleFixedIterator(), func(cur Shape) []Shape {
+		return []Shape{NewMaterialize(cur)}
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	sc := it.Iterate()
+	defer sc.Close()
+	require.False(t, sc.Next(ctx))
+	require.Equal(t, context.Canceled, sc.Err())
+}
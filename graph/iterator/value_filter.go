@@ -16,6 +16,7 @@ package iterator
 
 import (
 	"context"
+	"sync"
 
 	"github.com/cayleygraph/cayley/graph/refs"
 	"github.com/cayleygraph/quad"
@@ -197,3 +198,247 @@ func (it *valueFilterContains) TagResults(dst map[string]refs.Ref) {
 func (it *valueFilterContains) String() string {
 	return "ValueFilterContains"
 }
+
+// AnyValueFilter passes values of the sub-iterator that pass at least one of the filters.
+//
+// Values are checked one by one, thus they are returned in the same order and with the same paths
+// as in the sub-iterator. Filters are built once, on top of an iterator that returns the value being checked.
+type AnyValueFilter struct {
+	sub Shape
+
+	mu      sync.Mutex // guards the current value, since filters are shared by all scanners
+	cur     *singleValue
+	filters []Shape
+}
+
+// NewAnyValueFilter creates a new filter. The build function is called once with an iterator that returns
+// the value being checked, and must return an iterator for each of the filters.
+func NewAnyValueFilter(sub Shape, build func(cur Shape) []Shape) *AnyValueFilter {
+	cur := &singleValue{}
+	return &AnyValueFilter{
+		sub:     sub,
+		cur:     cur,
+		filters: build(cur),
+	}
+}
+
+// check returns true if the value passes at least one of the filters.
+func (it *AnyValueFilter) check(ctx context.Context, val refs.Ref) (bool, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.cur.val = val
+	for _, f := range it.filters {
+		sc := f.Iterate()
+		ok := sc.Next(ctx)
+		err := sc.Err()
+		sc.Close()
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (it *AnyValueFilter) Iterate() Scanner {
+	return &anyValueFilterNext{it: it, sub: it.sub.Iterate()}
+}
+
+func (it *AnyValueFilter) Lookup() Index {
+	return &anyValueFilterContains{it: it, sub: it.sub.Lookup()}
+}
+
+func (it *AnyValueFilter) SubIterators() []Shape {
+	return []Shape{it.sub}
+}
+
+func (it *AnyValueFilter) String() string {
+	return "AnyValueFilter"
+}
+
+func (it *AnyValueFilter) Optimize(ctx context.Context) (Shape, bool) {
+	newSub, changed := it.sub.Optimize(ctx)
+	if changed {
+		it.sub = newSub
+	}
+	return it, changed
+}
+
+func (it *AnyValueFilter) Stats(ctx context.Context) (Costs, error) {
+	st, err := it.sub.Stats(ctx)
+	st.Size.Value = st.Size.Value/2 + 1
+	st.Size.Exact = false
+	return st, err
+}
+
+type anyValueFilterNext struct {
+	it     *AnyValueFilter
+	sub    Scanner
+	result refs.Ref
+	err    error
+}
+
+func (it *anyValueFilterNext) Close() error {
+	return it.sub.Close()
+}
+
+func (it *anyValueFilterNext) Next(ctx context.Context) bool {
+	for it.sub.Next(ctx) {
+		val := it.sub.Result()
+		ok, err := it.it.check(ctx, val)
+		if err != nil {
+			it.err = err
+			return false
+		} else if ok {
+			it.result = val
+			return true
+		}
+	}
+	it.err = it.sub.Err()
+	return false
+}
+
+func (it *anyValueFilterNext) Err() error {
+	return it.err
+}
+
+func (it *anyValueFilterNext) Result() refs.Ref {
+	return it.result
+}
+
+func (it *anyValueFilterNext) NextPath(ctx context.Context) bool {
+	return it.sub.NextPath(ctx)
+}
+
+func (it *anyValueFilterNext) TagResults(dst map[string]refs.Ref) {
+	it.sub.TagResults(dst)
+}
+
+func (it *anyValueFilterNext) String() string {
+	return "AnyValueFilterNext"
+}
+
+type anyValueFilterContains struct {
+	it     *AnyValueFilter
+	sub    Index
+	result refs.Ref
+	err    error
+}
+
+func (it *anyValueFilterContains) Close() error {
+	return it.sub.Close()
+}
+
+func (it *anyValueFilterContains) Err() error {
+	return it.err
+}
+
+func (it *anyValueFilterContains) Result() refs.Ref {
+	return it.result
+}
+
+func (it *anyValueFilterContains) NextPath(ctx context.Context) bool {
+	return it.sub.NextPath(ctx)
+}
+
+func (it *anyValueFilterContains) Contains(ctx context.Context, val refs.Ref) bool {
+	ok, err := it.it.check(ctx, val)
+	if err != nil {
+		it.err = err
+		return false
+	} else if !ok {
+		return false
+	}
+	if !it.sub.Contains(ctx, val) {
+		it.err = it.sub.Err()
+		return false
+	}
+	it.result = val
+	return true
+}
+
+func (it *anyValueFilterContains) TagResults(dst map[string]refs.Ref) {
+	it.sub.TagResults(dst)
+}
+
+func (it *anyValueFilterContains) String() string {
+	return "AnyValueFilterContains"
+}
+
+// singleValue is an iterator that returns a single value, which can be changed between scans.
+type singleValue struct {
+	val refs.Ref
+}
+
+func (it *singleValue) Iterate() Scanner {
+	return &singleValueNext{val: it.val}
+}
+
+func (it *singleValue) Lookup() Index {
+	return &singleValueContains{val: it.val}
+}
+
+func (it *singleValue) SubIterators() []Shape {
+	return nil
+}
+
+func (it *singleValue) String() string {
+	return "SingleValue"
+}
+
+func (it *singleValue) Optimize(ctx context.Context) (Shape, bool) {
+	return it, false
+}
+
+func (it *singleValue) Stats(ctx context.Context) (Costs, error) {
+	return Costs{
+		ContainsCost: 1,
+		NextCost:     1,
+		Size:         refs.Size{Value: 1, Exact: true},
+	}, nil
+}
+
+type singleValueNext struct {
+	val  refs.Ref
+	done bool
+}
+
+func (it *singleValueNext) Close() error                       { return nil }
+func (it *singleValueNext) Err() error                         { return nil }
+func (it *singleValueNext) NextPath(ctx context.Context) bool  { return false }
+func (it *singleValueNext) TagResults(dst map[string]refs.Ref) {}
+func (it *singleValueNext) String() string                     { return "SingleValueNext" }
+
+func (it *singleValueNext) Next(ctx context.Context) bool {
+	if it.done || it.val == nil {
+		return false
+	}
+	it.done = true
+	return true
+}
+
+func (it *singleValueNext) Result() refs.Ref {
+	if !it.done {
+		return nil
+	}
+	return it.val
+}
+
+type singleValueContains struct {
+	val    refs.Ref
+	result refs.Ref
+}
+
+func (it *singleValueContains) Close() error                       { return nil }
+func (it *singleValueContains) Err() error                         { return nil }
+func (it *singleValueContains) NextPath(ctx context.Context) bool  { return false }
+func (it *singleValueContains) TagResults(dst map[string]refs.Ref) {}
+func (it *singleValueContains) Result() refs.Ref                   { return it.result }
+func (it *singleValueContains) String() string                     { return "SingleValueContains" }
+
+func (it *singleValueContains) Contains(ctx context.Context, val refs.Ref) bool {
+	if it.val == nil || refs.ToKey(val) != refs.ToKey(it.val) {
+		return false
+	}
+	it.result = val
+	return true
+}
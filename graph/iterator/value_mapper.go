@@ -0,0 +1,493 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/quad"
+)
+
+// ValueMapperFunc maps one value to another.
+//
+// The mapper may return ErrDropValue (possibly wrapped) to skip the value; the same happens if it returns a nil value.
+type ValueMapperFunc func(quad.Value) (quad.Value, error)
+
+// ErrDropValue can be returned by ValueMapperFunc to skip the value.
+// It is not treated as an error: the iterator skips the value and continues, and Err returns nil.
+// The rest of the mappers in the chain are not called for the value.
+var ErrDropValue = errors.New("drop value")
+
+// ValueMapperChain is a list of mappers that are applied in order.
+type ValueMapperChain []ValueMapperFunc
+
+// Map applies all mappers in the chain to the value. It returns nil if any of the mappers drops the value.
+func (c ValueMapperChain) Map(v quad.Value) (quad.Value, error) {
+	var err error
+	for _, fnc := range c {
+		if v == nil {
+			return nil, nil
+		}
+		v, err = fnc(v)
+		if errors.Is(err, ErrDropValue) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// ValueMapperSelectivity describes how the number of results of a mapper relates to the number of its input values.
+// It is used to estimate the size of the ValueMapper iterator.
+type ValueMapperSelectivity int
+
+const (
+	// SelectivityUnknown means that the mapper may drop some of the values, but it's not known how many.
+	SelectivityUnknown ValueMapperSelectivity = iota
+	// SelectivityOneToOne means that the mapper returns exactly one result for each input value.
+	SelectivityOneToOne
+	// SelectivityFilter means that the mapper may drop any number of values.
+	SelectivityFilter
+)
+
+// ValueMapper is an iterator that maps values of the sub-iterator to other values.
+//
+// Each value is resolved with NameOf, passed through all mappers and resolved back with ValueOf.
+// Mapped values that are not present in the quad store are skipped.
+type ValueMapper struct {
+	sub         Shape
+	mapper      ValueMapperChain
+	qs          refs.Namer
+	workers     int
+	ordered     bool
+	selectivity ValueMapperSelectivity
+}
+
+// NewValueMapper creates a new iterator that maps values of the sub-iterator.
+func NewValueMapper(qs refs.Namer, sub Shape, mapper ValueMapperFunc) *ValueMapper {
+	return NewValueMapperChain(qs, sub, mapper)
+}
+
+// NewValueMapperChain is the same as NewValueMapper, but applies a list of mappers in one pass.
+// It requires only one NameOf and ValueOf call per value, regardless of the number of mappers.
+func NewValueMapperChain(qs refs.Namer, sub Shape, mappers ...ValueMapperFunc) *ValueMapper {
+	return &ValueMapper{
+		sub:    sub,
+		qs:     qs,
+		mapper: ValueMapperChain(mappers),
+	}
+}
+
+// NewValueMapperParallel is the same as NewValueMapperChain, but applies mappers to multiple values
+// concurrently, using a given number of workers. It is useful for mappers that are expensive to call.
+//
+// If ordered is set, results are returned in the same order as the values of the sub-iterator,
+// otherwise they are returned as soon as they are mapped.
+// Mappers must be safe for concurrent use. Lookups are not affected and always map values one by one.
+func NewValueMapperParallel(qs refs.Namer, sub Shape, workers int, ordered bool, mappers ...ValueMapperFunc) *ValueMapper {
+	it := NewValueMapperChain(qs, sub, mappers...)
+	it.workers = workers
+	it.ordered = ordered
+	return it
+}
+
+// SetSelectivity declares how many results the mapper returns, to make a better size estimate.
+// The default is SelectivityUnknown.
+func (it *ValueMapper) SetSelectivity(s ValueMapperSelectivity) {
+	it.selectivity = s
+}
+
+func (it *ValueMapper) Iterate() Scanner {
+	if it.workers > 1 {
+		return newValueMapperParallelNext(it.qs, it.sub.Iterate(), it.mapper, it.workers, it.ordered)
+	}
+	return newValueMapperNext(it.qs, it.sub.Iterate(), it.mapper)
+}
+
+func (it *ValueMapper) Lookup() Index {
+	return newValueMapperContains(it.qs, it.sub, it.mapper)
+}
+
+func (it *ValueMapper) SubIterators() []Shape {
+	return []Shape{it.sub}
+}
+
+func (it *ValueMapper) String() string {
+	return "ValueMapper"
+}
+
+func (it *ValueMapper) Optimize(ctx context.Context) (Shape, bool) {
+	newSub, changed := it.sub.Optimize(ctx)
+	if changed {
+		it.sub = newSub
+	}
+	if sub, ok := it.sub.(*ValueMapper); ok && sub.workers == it.workers && sub.ordered == it.ordered {
+		// fuse nested mappers into a single chain; mappers that run differently are kept separate,
+		// since sequential mappers may not be safe for concurrent use
+		mapper := make(ValueMapperChain, 0, len(sub.mapper)+len(it.mapper))
+		mapper = append(mapper, sub.mapper...)
+		mapper = append(mapper, it.mapper...)
+		fused := NewValueMapperParallel(it.qs, sub.sub, it.workers, it.ordered, mapper...)
+		fused.selectivity = combineSelectivity(sub.selectivity, it.selectivity)
+		return fused, true
+	}
+	return it, changed
+}
+
+// combineSelectivity returns the selectivity of two mappers applied one after another.
+func combineSelectivity(a, b ValueMapperSelectivity) ValueMapperSelectivity {
+	switch {
+	case a == b:
+		return a
+	case a == SelectivityOneToOne:
+		return b
+	case b == SelectivityOneToOne:
+		return a
+	}
+	return SelectivityUnknown
+}
+
+// Mapped values may collapse or be absent from the quad store, thus the size is a guess,
+// unless the selectivity of the mapper is set.
+// Checking if the value is in the set requires a full scan of the sub-iterator.
+func (it *ValueMapper) Stats(ctx context.Context) (Costs, error) {
+	st, err := it.sub.Stats(ctx)
+	st.ContainsCost = st.NextCost * st.Size.Value
+	switch it.selectivity {
+	case SelectivityOneToOne:
+		// sub-iterator size is preserved, including the exact flag
+	case SelectivityFilter:
+		st.Size.Exact = false
+	default:
+		st.Size.Value = st.Size.Value/2 + 1
+		st.Size.Exact = false
+	}
+	return st, err
+}
+
+type valueMapperNext struct {
+	sub    Scanner
+	mapper ValueMapperChain
+	qs     refs.Namer
+	result refs.Ref
+	err    error
+}
+
+func newValueMapperNext(qs refs.Namer, sub Scanner, mapper ValueMapperChain) *valueMapperNext {
+	return &valueMapperNext{
+		sub:    sub,
+		qs:     qs,
+		mapper: mapper,
+	}
+}
+
+func (it *valueMapperNext) doMap(val refs.Ref) refs.Ref {
+	qval, err := it.mapper.Map(it.qs.NameOf(val))
+	if err != nil {
+		it.err = err
+		return nil
+	} else if qval == nil {
+		return nil
+	}
+	return it.qs.ValueOf(qval)
+}
+
+func (it *valueMapperNext) Close() error {
+	return it.sub.Close()
+}
+
+func (it *valueMapperNext) Next(ctx context.Context) bool {
+	for it.sub.Next(ctx) {
+		if v := it.doMap(it.sub.Result()); v != nil {
+			it.result = v
+			return true
+		} else if it.err != nil {
+			return false
+		}
+	}
+	it.err = it.sub.Err()
+	return false
+}
+
+func (it *valueMapperNext) Err() error {
+	return it.err
+}
+
+func (it *valueMapperNext) Result() refs.Ref {
+	return it.result
+}
+
+func (it *valueMapperNext) NextPath(ctx context.Context) bool {
+	return it.sub.NextPath(ctx)
+}
+
+func (it *valueMapperNext) TagResults(dst map[string]refs.Ref) {
+	it.sub.TagResults(dst)
+}
+
+func (it *valueMapperNext) String() string {
+	return "ValueMapperNext"
+}
+
+// valueMapperJob is a single value of the sub-iterator that is mapped by one of the workers.
+type valueMapperJob struct {
+	seq  int
+	in   quad.Value
+	tags []map[string]refs.Ref // tags for each path of the value
+	out  quad.Value
+	err  error
+}
+
+// valueMapperParallelNext maps values of the sub-iterator using a pool of workers.
+//
+// Only mappers are called from the workers: the sub-iterator and the quad store are accessed from
+// the caller's goroutine, and tags for all paths of the value are collected before it's sent to the workers.
+type valueMapperParallelNext struct {
+	sub     Scanner
+	mapper  ValueMapperChain
+	qs      refs.Namer
+	workers int
+	ordered bool
+
+	jobs     chan *valueMapperJob
+	done     chan *valueMapperJob
+	pending  map[int]*valueMapperJob // finished jobs waiting for their turn; only in ordered mode
+	seq      int                     // sequence number of the next job to send
+	next     int                     // sequence number of the next job to return; only in ordered mode
+	inflight int
+	subDone  bool
+
+	cur    *valueMapperJob
+	path   int
+	result refs.Ref
+	err    error
+}
+
+func newValueMapperParallelNext(qs refs.Namer, sub Scanner, mapper ValueMapperChain, workers int, ordered bool) *valueMapperParallelNext {
+	return &valueMapperParallelNext{
+		sub:     sub,
+		qs:      qs,
+		mapper:  mapper,
+		workers: workers,
+		ordered: ordered,
+	}
+}
+
+func (it *valueMapperParallelNext) window() int {
+	return 2 * it.workers
+}
+
+func (it *valueMapperParallelNext) start() {
+	// both channels can hold all jobs in flight, so neither side blocks on send
+	it.jobs = make(chan *valueMapperJob, it.window())
+	it.done = make(chan *valueMapperJob, it.window())
+	if it.ordered {
+		it.pending = make(map[int]*valueMapperJob)
+	}
+	for i := 0; i < it.workers; i++ {
+		go func(mapper ValueMapperChain, jobs <-chan *valueMapperJob, done chan<- *valueMapperJob) {
+			for j := range jobs {
+				j.out, j.err = mapper.Map(j.in)
+				done <- j
+			}
+		}(it.mapper, it.jobs, it.done)
+	}
+}
+
+// fill sends values of the sub-iterator to the workers, until the window is full.
+func (it *valueMapperParallelNext) fill(ctx context.Context) {
+	for !it.subDone && it.inflight < it.window() {
+		if !it.sub.Next(ctx) {
+			it.subDone = true
+			it.err = it.sub.Err()
+			return
+		}
+		j := &valueMapperJob{seq: it.seq, in: it.qs.NameOf(it.sub.Result())}
+		for {
+			tags := make(map[string]refs.Ref)
+			it.sub.TagResults(tags)
+			j.tags = append(j.tags, tags)
+			if !it.sub.NextPath(ctx) {
+				break
+			}
+		}
+		it.seq++
+		it.inflight++
+		it.jobs <- j
+	}
+}
+
+// take waits for the next finished job. It returns nil if there are no jobs in flight.
+func (it *valueMapperParallelNext) take(ctx context.Context) *valueMapperJob {
+	if it.ordered {
+		if j, ok := it.pending[it.next]; ok {
+			delete(it.pending, it.next)
+			it.next++
+			it.inflight--
+			return j
+		}
+	}
+	for it.inflight > 0 {
+		select {
+		case <-ctx.Done():
+			it.err = ctx.Err()
+			return nil
+		case j := <-it.done:
+			if it.ordered && j.seq != it.next {
+				it.pending[j.seq] = j
+				continue
+			}
+			it.next++
+			it.inflight--
+			return j
+		}
+	}
+	return nil
+}
+
+func (it *valueMapperParallelNext) Close() error {
+	if it.jobs != nil {
+		close(it.jobs)
+		it.jobs = nil
+	}
+	return it.sub.Close()
+}
+
+func (it *valueMapperParallelNext) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if it.jobs == nil {
+		it.start()
+	}
+	for {
+		it.fill(ctx)
+		if it.err != nil {
+			return false
+		}
+		j := it.take(ctx)
+		if j == nil {
+			return false
+		} else if j.err != nil {
+			it.err = j.err
+			return false
+		} else if j.out == nil {
+			continue
+		}
+		v := it.qs.ValueOf(j.out)
+		if v == nil {
+			continue
+		}
+		it.cur, it.path, it.result = j, 0, v
+		return true
+	}
+}
+
+func (it *valueMapperParallelNext) Err() error {
+	return it.err
+}
+
+func (it *valueMapperParallelNext) Result() refs.Ref {
+	return it.result
+}
+
+func (it *valueMapperParallelNext) NextPath(ctx context.Context) bool {
+	if it.cur == nil || it.path+1 >= len(it.cur.tags) {
+		return false
+	}
+	it.path++
+	return true
+}
+
+func (it *valueMapperParallelNext) TagResults(dst map[string]refs.Ref) {
+	if it.cur == nil {
+		return
+	}
+	for k, v := range it.cur.tags[it.path] {
+		dst[k] = v
+	}
+}
+
+func (it *valueMapperParallelNext) String() string {
+	return "ValueMapperParallelNext"
+}
+
+// valueMapperContains checks if the value is in the set by scanning the sub-iterator,
+// since mappers cannot be reversed in general.
+type valueMapperContains struct {
+	iterate func() Scanner // returns a new scanner for mapped values
+	cur     Scanner
+	result  refs.Ref
+	err     error
+}
+
+func newValueMapperContains(qs refs.Namer, sub Shape, mapper ValueMapperChain) *valueMapperContains {
+	return &valueMapperContains{
+		iterate: func() Scanner {
+			return newValueMapperNext(qs, sub.Iterate(), mapper)
+		},
+	}
+}
+
+func (it *valueMapperContains) Close() error {
+	if it.cur != nil {
+		return it.cur.Close()
+	}
+	return nil
+}
+
+func (it *valueMapperContains) Err() error {
+	return it.err
+}
+
+func (it *valueMapperContains) Result() refs.Ref {
+	return it.result
+}
+
+func (it *valueMapperContains) NextPath(ctx context.Context) bool {
+	if it.cur == nil {
+		return false
+	}
+	return it.cur.NextPath(ctx)
+}
+
+func (it *valueMapperContains) Contains(ctx context.Context, val refs.Ref) bool {
+	if it.cur != nil {
+		it.cur.Close()
+	}
+	key := refs.ToKey(val)
+	it.cur = it.iterate()
+	for it.cur.Next(ctx) {
+		if refs.ToKey(it.cur.Result()) == key {
+			it.result = val
+			return true
+		}
+	}
+	it.err = it.cur.Err()
+	return false
+}
+
+func (it *valueMapperContains) TagResults(dst map[string]refs.Ref) {
+	if it.cur != nil {
+		it.cur.TagResults(dst)
+	}
+}
+
+func (it *valueMapperContains) String() string {
+	return "ValueMapperContains"
+}
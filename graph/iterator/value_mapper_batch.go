@@ -0,0 +1,228 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/quad"
+)
+
+// BatchValueMapperFunc maps a batch of values to other values.
+//
+// It must return a slice of the same length as the input. Values mapped to nil are skipped.
+type BatchValueMapperFunc func([]quad.Value) ([]quad.Value, error)
+
+// DefaultBatchValueMapperSize is the number of values mapped in one batch, if the size is not set.
+const DefaultBatchValueMapperSize = 100
+
+// BatchValueMapper is the same as ValueMapper, but maps values of the sub-iterator in batches.
+//
+// Refs of each batch are resolved with a single ValuesOf call, if the quad store implements refs.BatchNamer.
+// Mapped values are resolved back with ValueOf one by one, when they are returned by the iterator.
+type BatchValueMapper struct {
+	sub    Shape
+	mapper BatchValueMapperFunc
+	qs     refs.Namer
+	size   int
+}
+
+// NewBatchValueMapper creates a new iterator that maps values of the sub-iterator in batches of a given size.
+// If the size is not positive, DefaultBatchValueMapperSize is used.
+func NewBatchValueMapper(qs refs.Namer, sub Shape, size int, mapper BatchValueMapperFunc) *BatchValueMapper {
+	if size <= 0 {
+		size = DefaultBatchValueMapperSize
+	}
+	return &BatchValueMapper{
+		sub:    sub,
+		qs:     qs,
+		mapper: mapper,
+		size:   size,
+	}
+}
+
+func (it *BatchValueMapper) Iterate() Scanner {
+	return newBatchValueMapperNext(it.qs, it.sub.Iterate(), it.mapper, it.size)
+}
+
+func (it *BatchValueMapper) Lookup() Index {
+	return &valueMapperContains{
+		iterate: func() Scanner {
+			return newBatchValueMapperNext(it.qs, it.sub.Iterate(), it.mapper, it.size)
+		},
+	}
+}
+
+func (it *BatchValueMapper) SubIterators() []Shape {
+	return []Shape{it.sub}
+}
+
+func (it *BatchValueMapper) String() string {
+	return fmt.Sprintf("BatchValueMapper(%d)", it.size)
+}
+
+func (it *BatchValueMapper) Optimize(ctx context.Context) (Shape, bool) {
+	newSub, changed := it.sub.Optimize(ctx)
+	if changed {
+		it.sub = newSub
+	}
+	return it, true
+}
+
+// Stats is the same as for ValueMapper: the size is a guess, and checking if the value is in the set
+// requires a full scan of the sub-iterator.
+func (it *BatchValueMapper) Stats(ctx context.Context) (Costs, error) {
+	st, err := it.sub.Stats(ctx)
+	st.ContainsCost = st.NextCost * st.Size.Value
+	st.Size.Value = st.Size.Value/2 + 1
+	st.Size.Exact = false
+	return st, err
+}
+
+// batchValue is a mapped value with tags for each path of the original value.
+type batchValue struct {
+	val  quad.Value
+	tags []map[string]refs.Ref
+}
+
+type batchValueMapperNext struct {
+	sub    Scanner
+	mapper BatchValueMapperFunc
+	qs     refs.Namer
+	size   int
+
+	buf     []batchValue
+	ind     int
+	subDone bool
+
+	cur    *batchValue
+	path   int
+	result refs.Ref
+	err    error
+}
+
+func newBatchValueMapperNext(qs refs.Namer, sub Scanner, mapper BatchValueMapperFunc, size int) *batchValueMapperNext {
+	return &batchValueMapperNext{
+		sub:    sub,
+		qs:     qs,
+		mapper: mapper,
+		size:   size,
+	}
+}
+
+// fill reads the next batch from the sub-iterator and maps it.
+func (it *batchValueMapperNext) fill(ctx context.Context) {
+	it.buf, it.ind = it.buf[:0], 0
+	var (
+		ids  []refs.Ref
+		tags [][]map[string]refs.Ref
+	)
+	for len(ids) < it.size {
+		if !it.sub.Next(ctx) {
+			it.subDone = true
+			if it.err = it.sub.Err(); it.err != nil {
+				return
+			}
+			break
+		}
+		ids = append(ids, it.sub.Result())
+		var paths []map[string]refs.Ref
+		for {
+			m := make(map[string]refs.Ref)
+			it.sub.TagResults(m)
+			paths = append(paths, m)
+			if !it.sub.NextPath(ctx) {
+				break
+			}
+		}
+		tags = append(tags, paths)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	names, err := refs.ValuesOf(ctx, it.qs, ids)
+	if err != nil {
+		it.err = err
+		return
+	}
+	out, err := it.mapper(names)
+	if err != nil {
+		it.err = err
+		return
+	} else if len(out) != len(names) {
+		it.err = fmt.Errorf("batch mapper returned %d values for %d inputs", len(out), len(names))
+		return
+	}
+	for i, v := range out {
+		if v == nil {
+			continue
+		}
+		it.buf = append(it.buf, batchValue{val: v, tags: tags[i]})
+	}
+}
+
+func (it *batchValueMapperNext) Close() error {
+	return it.sub.Close()
+}
+
+func (it *batchValueMapperNext) Next(ctx context.Context) bool {
+	for it.err == nil {
+		if it.ind >= len(it.buf) {
+			if it.subDone {
+				return false
+			}
+			it.fill(ctx)
+			continue
+		}
+		v := &it.buf[it.ind]
+		it.ind++
+		if ref := it.qs.ValueOf(v.val); ref != nil {
+			it.cur, it.path, it.result = v, 0, ref
+			return true
+		}
+	}
+	return false
+}
+
+func (it *batchValueMapperNext) Err() error {
+	return it.err
+}
+
+func (it *batchValueMapperNext) Result() refs.Ref {
+	return it.result
+}
+
+func (it *batchValueMapperNext) NextPath(ctx context.Context) bool {
+	if it.cur == nil || it.path+1 >= len(it.cur.tags) {
+		return false
+	}
+	it.path++
+	return true
+}
+
+func (it *batchValueMapperNext) TagResults(dst map[string]refs.Ref) {
+	if it.cur == nil {
+		return
+	}
+	for k, v := range it.cur.tags[it.path] {
+		dst[k] = v
+	}
+}
+
+func (it *batchValueMapperNext) String() string {
+	return "BatchValueMapperNext"
+}
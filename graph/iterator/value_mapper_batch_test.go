@@ -0,0 +1,119 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/quad"
+)
+
+// batchNamer counts calls to ValuesOf.
+type batchNamer struct {
+	countingNamer
+	batches int
+}
+
+func (qs *batchNamer) ValuesOf(ctx context.Context, vals []refs.Ref) ([]quad.Value, error) {
+	qs.batches++
+	out := make([]quad.Value, len(vals))
+	for i, v := range vals {
+		out[i] = qs.Namer.NameOf(v)
+	}
+	return out, nil
+}
+
+func (qs *batchNamer) RefsOf(ctx context.Context, nodes []quad.Value) ([]refs.Ref, error) {
+	panic("not implemented")
+}
+
+func batchIncInt(vals []quad.Value) ([]quad.Value, error) {
+	out := make([]quad.Value, len(vals))
+	for i, v := range vals {
+		out[i], _ = incInt(v)
+	}
+	return out, nil
+}
+
+func TestBatchValueMapper(t *testing.T) {
+	for size := 1; size <= 6; size++ {
+		qs := &batchNamer{countingNamer: countingNamer{Namer: simpleStore}}
+		calls := 0
+		it := NewBatchValueMapper(qs, simpleFixedIterator(), size, func(vals []quad.Value) ([]quad.Value, error) {
+			calls++
+			require.True(t, len(vals) <= size, "batch is too large: %d", len(vals))
+			return batchIncInt(vals)
+		})
+		got := mapValues(t, simpleStore, it)
+		require.Equal(t, []quad.Value{quad.Int(1), quad.Int(2), quad.Int(3), quad.Int(4), quad.Int(5)}, got, "size: %d", size)
+
+		batches := (5 + size - 1) / size
+		require.Equal(t, batches, calls, "size: %d", size)
+		require.Equal(t, batches, qs.batches, "size: %d", size)
+		require.Equal(t, 0, qs.names, "size: %d", size)
+	}
+}
+
+func TestBatchValueMapperTags(t *testing.T) {
+	it := NewBatchValueMapper(simpleStore, NewSave(simpleFixedIterator(), "src"), 2, batchIncInt)
+	ctx := context.TODO()
+	sc := it.Iterate()
+	defer sc.Close()
+	n := 0
+	for sc.Next(ctx) {
+		n++
+		tags := make(map[string]refs.Ref)
+		sc.TagResults(tags)
+		src := simpleStore.NameOf(tags["src"]).(quad.Int)
+		require.Equal(t, src+1, simpleStore.NameOf(sc.Result()))
+	}
+	require.NoError(t, sc.Err())
+	require.Equal(t, 5, n)
+}
+
+func TestBatchValueMapperContains(t *testing.T) {
+	it := NewBatchValueMapper(simpleStore, simpleFixedIterator(), 2, batchIncInt)
+	ctx := context.TODO()
+	ix := it.Lookup()
+	defer ix.Close()
+	require.True(t, ix.Contains(ctx, Int64Node(5)))
+	require.False(t, ix.Contains(ctx, Int64Node(0)))
+	require.NoError(t, ix.Err())
+}
+
+func TestBatchValueMapperError(t *testing.T) {
+	errMap := errors.New("map error")
+	it := NewBatchValueMapper(simpleStore, simpleFixedIterator(), 2, func(vals []quad.Value) ([]quad.Value, error) {
+		return nil, errMap
+	})
+	sc := it.Iterate()
+	defer sc.Close()
+	require.False(t, sc.Next(context.TODO()))
+	require.Equal(t, errMap, sc.Err())
+
+	it = NewBatchValueMapper(simpleStore, simpleFixedIterator(), 2, func(vals []quad.Value) ([]quad.Value, error) {
+		return vals[:1], nil
+	})
+	sc = it.Iterate()
+	defer sc.Close()
+	require.False(t, sc.Next(context.TODO()))
+	require.Error(t, sc.Err())
+}
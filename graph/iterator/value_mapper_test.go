@@ -0,0 +1,256 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/quad"
+)
+
+type countingNamer struct {
+	refs.Namer
+	names, values int
+}
+
+func (qs *countingNamer) NameOf(v refs.Ref) quad.Value {
+	qs.names++
+	return qs.Namer.NameOf(v)
+}
+
+func (qs *countingNamer) ValueOf(v quad.Value) refs.Ref {
+	qs.values++
+	return qs.Namer.ValueOf(v)
+}
+
+func incInt(v quad.Value) (quad.Value, error) {
+	return v.(quad.Int) + 1, nil
+}
+
+func mapValues(t *testing.T, qs refs.Namer, it Shape) []quad.Value {
+	ctx := context.TODO()
+	sc := it.Iterate()
+	defer sc.Close()
+	var got []quad.Value
+	for sc.Next(ctx) {
+		got = append(got, qs.NameOf(sc.Result()))
+	}
+	require.NoError(t, sc.Err())
+	return got
+}
+
+func TestValueMapperChain(t *testing.T) {
+	qs := &countingNamer{Namer: simpleStore}
+	it := NewValueMapperChain(qs, simpleFixedIterator(), incInt, incInt, incInt)
+
+	ctx := context.TODO()
+	sc := it.Iterate()
+	defer sc.Close()
+	var got []refs.Ref
+	for sc.Next(ctx) {
+		got = append(got, sc.Result())
+	}
+	require.NoError(t, sc.Err())
+	// 5 values in the source, each resolved exactly once in both directions
+	require.Equal(t, 5, qs.names)
+	require.Equal(t, 5, qs.values)
+
+	var vals []quad.Value
+	for _, r := range got {
+		vals = append(vals, simpleStore.NameOf(r))
+	}
+	require.Equal(t, []quad.Value{quad.Int(3), quad.Int(4), quad.Int(5)}, vals)
+}
+
+func TestValueMapperFuse(t *testing.T) {
+	qs := &countingNamer{Namer: simpleStore}
+	var it Shape = simpleFixedIterator()
+	for i := 0; i < 3; i++ {
+		it = NewValueMapper(qs, it, incInt)
+	}
+	it, _ = it.Optimize(context.TODO())
+	m, ok := it.(*ValueMapper)
+	require.True(t, ok, "expected a single mapper, got: %T", it)
+	_, ok = m.SubIterators()[0].(*ValueMapper)
+	require.False(t, ok, "nested mappers were not fused")
+
+	got := mapValues(t, simpleStore, it)
+	require.Equal(t, []quad.Value{quad.Int(3), quad.Int(4), quad.Int(5)}, got)
+	require.Equal(t, 5, qs.names)
+	require.Equal(t, 5, qs.values)
+}
+
+func TestValueMapperFuseParallel(t *testing.T) {
+	ctx := context.TODO()
+	fused := func(it Shape) bool {
+		_, nested := it.SubIterators()[0].(*ValueMapper)
+		return !nested
+	}
+	// mappers with the same settings are fused
+	var it Shape = NewValueMapperParallel(simpleStore, simpleFixedIterator(), 3, true, incInt)
+	it = NewValueMapperParallel(simpleStore, it, 3, true, incInt)
+	it, _ = it.Optimize(ctx)
+	require.True(t, fused(it))
+	require.Equal(t, []quad.Value{quad.Int(2), quad.Int(3), quad.Int(4), quad.Int(5)}, mapValues(t, simpleStore, it))
+
+	// sequential mappers are not run concurrently
+	it = NewValueMapper(simpleStore, simpleFixedIterator(), incInt)
+	it = NewValueMapperParallel(simpleStore, it, 3, true, incInt)
+	it, _ = it.Optimize(ctx)
+	require.False(t, fused(it))
+
+	// ordering is preserved
+	it = NewValueMapperParallel(simpleStore, simpleFixedIterator(), 3, true, slowIncInt)
+	it = NewValueMapperParallel(simpleStore, it, 3, false, incInt)
+	it, _ = it.Optimize(ctx)
+	require.False(t, fused(it))
+	require.ElementsMatch(t, []quad.Value{quad.Int(2), quad.Int(3), quad.Int(4), quad.Int(5)}, mapValues(t, simpleStore, it))
+}
+
+func TestValueMapperContains(t *testing.T) {
+	it := NewValueMapperChain(simpleStore, simpleFixedIterator(), incInt, incInt)
+	ctx := context.TODO()
+	ix := it.Lookup()
+	defer ix.Close()
+	require.True(t, ix.Contains(ctx, Int64Node(4)))
+	require.False(t, ix.Contains(ctx, Int64Node(1)))
+	require.NoError(t, ix.Err())
+}
+
+func TestValueMapperError(t *testing.T) {
+	errMap := errors.New("map error")
+	it := NewValueMapperChain(simpleStore, simpleFixedIterator(), incInt, func(v quad.Value) (quad.Value, error) {
+		return nil, errMap
+	})
+	sc := it.Iterate()
+	defer sc.Close()
+	require.False(t, sc.Next(context.TODO()))
+	require.Equal(t, errMap, sc.Err())
+}
+
+// slowIncInt is the same as incInt, but lower values take longer to map.
+func slowIncInt(v quad.Value) (quad.Value, error) {
+	time.Sleep(time.Duration(5-v.(quad.Int)) * time.Millisecond)
+	return incInt(v)
+}
+
+func TestValueMapperParallel(t *testing.T) {
+	it := NewValueMapperParallel(simpleStore, simpleFixedIterator(), 3, true, slowIncInt)
+	got := mapValues(t, simpleStore, it)
+	require.Equal(t, []quad.Value{quad.Int(1), quad.Int(2), quad.Int(3), quad.Int(4), quad.Int(5)}, got)
+
+	it = NewValueMapperParallel(simpleStore, simpleFixedIterator(), 3, false, slowIncInt)
+	got = mapValues(t, simpleStore, it)
+	require.ElementsMatch(t, []quad.Value{quad.Int(1), quad.Int(2), quad.Int(3), quad.Int(4), quad.Int(5)}, got)
+}
+
+func TestValueMapperParallelTags(t *testing.T) {
+	it := NewValueMapperParallel(simpleStore, NewSave(simpleFixedIterator(), "src"), 2, true, incInt)
+	ctx := context.TODO()
+	sc := it.Iterate()
+	defer sc.Close()
+	for sc.Next(ctx) {
+		tags := make(map[string]refs.Ref)
+		sc.TagResults(tags)
+		src := simpleStore.NameOf(tags["src"]).(quad.Int)
+		require.Equal(t, src+1, simpleStore.NameOf(sc.Result()))
+	}
+	require.NoError(t, sc.Err())
+}
+
+func TestValueMapperParallelError(t *testing.T) {
+	errMap := errors.New("map error")
+	it := NewValueMapperParallel(simpleStore, simpleFixedIterator(), 3, false, func(v quad.Value) (quad.Value, error) {
+		if v.(quad.Int) == 2 {
+			return nil, errMap
+		}
+		return incInt(v)
+	})
+	ctx := context.TODO()
+	sc := it.Iterate()
+	defer sc.Close()
+	for sc.Next(ctx) {
+	}
+	require.Equal(t, errMap, sc.Err())
+}
+
+func TestValueMapperSelectivity(t *testing.T) {
+	ctx := context.TODO()
+	for _, c := range []struct {
+		sel   ValueMapperSelectivity
+		size  int64
+		exact bool
+	}{
+		{SelectivityUnknown, 3, false},
+		{SelectivityOneToOne, 5, true},
+		{SelectivityFilter, 5, false},
+	} {
+		it := NewValueMapper(simpleStore, simpleFixedIterator(), incInt)
+		it.SetSelectivity(c.sel)
+		st, err := it.Stats(ctx)
+		require.NoError(t, err)
+		require.Equal(t, refs.Size{Value: c.size, Exact: c.exact}, st.Size, "selectivity: %v", c.sel)
+	}
+
+	// fused mappers keep the selectivity if both of them are one-to-one
+	it := NewValueMapper(simpleStore, simpleFixedIterator(), incInt)
+	it.SetSelectivity(SelectivityOneToOne)
+	it2 := NewValueMapper(simpleStore, it, incInt)
+	it2.SetSelectivity(SelectivityOneToOne)
+	opt, _ := it2.Optimize(ctx)
+	st, err := opt.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, refs.Size{Value: 5, Exact: true}, st.Size)
+}
+
+func TestValueMapperDrop(t *testing.T) {
+	dropOdd := func(v quad.Value) (quad.Value, error) {
+		if v.(quad.Int)%2 != 0 {
+			return nil, ErrDropValue
+		}
+		return v, nil
+	}
+	it := NewValueMapperChain(simpleStore, simpleFixedIterator(), dropOdd, incInt)
+	got := mapValues(t, simpleStore, it)
+	require.Equal(t, []quad.Value{quad.Int(1), quad.Int(3), quad.Int(5)}, got)
+
+	it = NewValueMapperParallel(simpleStore, simpleFixedIterator(), 2, true, dropOdd, incInt)
+	got = mapValues(t, simpleStore, it)
+	require.Equal(t, []quad.Value{quad.Int(1), quad.Int(3), quad.Int(5)}, got)
+
+	dropWrapped := func(v quad.Value) (quad.Value, error) {
+		if _, err := dropOdd(v); err != nil {
+			return nil, fmt.Errorf("odd value %v: %w", v, err)
+		}
+		return v, nil
+	}
+	it = NewValueMapperChain(simpleStore, simpleFixedIterator(), dropWrapped, incInt)
+	got = mapValues(t, simpleStore, it)
+	require.Equal(t, []quad.Value{quad.Int(1), quad.Int(3), quad.Int(5)}, got)
+
+	ctx := context.TODO()
+	ix := NewValueMapperChain(simpleStore, simpleFixedIterator(), dropOdd, incInt).Lookup()
+	defer ix.Close()
+	require.False(t, ix.Contains(ctx, Int64Node(2)))
+	require.NoError(t, ix.Err())
+}
@@ -172,6 +172,20 @@ func (qs *QuadStore) optimizeFilter(s shape.Filter) (shape.Shape, bool) {
 				{Path: fieldPath(fldValData), Filter: nosql.Regexp, Value: nosql.String(f.Regexp())},
 			}...)
 			continue
+		case shape.Prefix:
+			if f.IgnoreCase {
+				break
+			}
+			from, to, ok := f.Range()
+			filters = append(filters, nosql.FieldFilter{
+				Path: fieldPath(fldValData), Filter: nosql.GTE, Value: nosql.String(from),
+			})
+			if ok {
+				filters = append(filters, nosql.FieldFilter{
+					Path: fieldPath(fldValData), Filter: nosql.LT, Value: nosql.String(to),
+				})
+			}
+			continue
 		case shape.Regexp:
 			filters = append(filters, []nosql.FieldFilter{
 				{Path: fieldPath(fldValData), Filter: nosql.Regexp, Value: nosql.String(f.Re.String())},
@@ -246,6 +246,20 @@ func (opt *Optimizer) optimizeFilter(from shape.Shape, f shape.ValueFilter) ([]W
 			}, []Value{
 				StringVal(convRegexp(f.Regexp())),
 			}, true
+	case shape.Prefix:
+		if f.IgnoreCase {
+			return nil, nil, false
+		}
+		from, to, ok := f.Range()
+		where := []Where{
+			{Field: "value_string", Op: OpGTE, Value: Placeholder{}},
+		}
+		params := []Value{StringVal(from)}
+		if ok {
+			where = append(where, Where{Field: "value_string", Op: OpLT, Value: Placeholder{}})
+			params = append(params, StringVal(to))
+		}
+		return where, params, true
 	case shape.Regexp:
 		if opt.regexpOp == "" {
 			return nil, nil, false
@@ -85,6 +85,17 @@ var shapeCases = []struct {
 		qu:   `SELECT hash AS ` + tagNode + ` FROM nodes WHERE value_string > $1 AND datatype = $2`,
 		args: []Value{StringVal("a"), StringVal("A")},
 	},
+	{
+		name: "string prefix",
+		s: shape.Filter{
+			From: shape.AllNodes{},
+			Filters: []shape.ValueFilter{
+				shape.Prefix{Prefix: "ab"},
+			},
+		},
+		qu:   `SELECT hash AS ` + tagNode + ` FROM nodes WHERE value_string >= $1 AND value_string < $2`,
+		args: []Value{StringVal("ab"), StringVal("ac")},
+	},
 	{
 		name: "lookup int",
 		s: shape.Filter{
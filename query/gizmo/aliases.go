@@ -0,0 +1,212 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+// Method aliases. JS engine maps each Go method to a single name, thus each alias is a separate method
+// that is only visible when enabled with WithSnakeCaseAliases or WithConstructorAliases. See fieldNameMapper.
+
+import (
+	"github.com/dop251/goja"
+
+	"github.com/cayleygraph/quad"
+)
+
+func (g *graphObject) AliasNewV(call goja.FunctionCall) goja.Value {
+	return g.NewV(call)
+}
+func (g *graphObject) AliasNewVertex(call goja.FunctionCall) goja.Value {
+	return g.NewVertex(call)
+}
+func (g *graphObject) AliasVertex(call goja.FunctionCall) goja.Value {
+	return g.NewVertex(call)
+}
+func (g *graphObject) AliasNewM() *pathObject {
+	return g.NewM()
+}
+func (g *graphObject) AliasNewMorphism() *pathObject {
+	return g.NewMorphism()
+}
+func (g *graphObject) AliasMorphism() *pathObject {
+	return g.NewMorphism()
+}
+func (g *graphObject) AliasNewIRI(s string) quad.IRI {
+	return g.NewIRI(s)
+}
+
+func (p *pathObject) SnakeAsOf(call goja.FunctionCall) goja.Value {
+	return p.AsOf(call)
+}
+func (p *pathObject) SnakeBothDir(call goja.FunctionCall) goja.Value {
+	return p.BothDir(call)
+}
+func (p *pathObject) SnakeBothUnique(call goja.FunctionCall) goja.Value {
+	return p.BothUnique(call)
+}
+func (p *pathObject) SnakeClearLabelContext() *pathObject {
+	return p.ClearLabelContext()
+}
+func (p *pathObject) SnakeCountAtLeast(n int) (bool, error) {
+	return p.CountAtLeast(n)
+}
+func (p *pathObject) SnakeCountBy(tag string) (map[string]int64, error) {
+	return p.CountBy(tag)
+}
+func (p *pathObject) SnakeCountProgress(call goja.FunctionCall) goja.Value {
+	return p.CountProgress(call)
+}
+func (p *pathObject) SnakeCountUpTo(n int) (int, error) {
+	return p.CountUpTo(n)
+}
+func (p *pathObject) SnakeCountWindow(offset, limit int) (map[string]interface{}, error) {
+	return p.CountWindow(offset, limit)
+}
+func (p *pathObject) SnakeDistinctBy(tag string) (goja.Value, error) {
+	return p.DistinctBy(tag)
+}
+func (p *pathObject) SnakeExceptBy(path *pathObject, tag string) (*pathObject, error) {
+	return p.ExceptBy(path, tag)
+}
+func (p *pathObject) SnakeFilterOr(call goja.FunctionCall) goja.Value {
+	return p.FilterOr(call)
+}
+func (p *pathObject) SnakeFollowAny(call goja.FunctionCall) goja.Value {
+	return p.FollowAny(call)
+}
+func (p *pathObject) SnakeFollowR(path *pathObject) *pathObject {
+	return p.FollowR(path)
+}
+func (p *pathObject) SnakeFollowRecursive(call goja.FunctionCall) goja.Value {
+	return p.FollowRecursive(call)
+}
+func (p *pathObject) SnakeForEach(call goja.FunctionCall) goja.Value {
+	return p.ForEach(call)
+}
+func (p *pathObject) SnakeForEachBatch(call goja.FunctionCall) goja.Value {
+	return p.ForEachBatch(call)
+}
+func (p *pathObject) SnakeForEachTags(call goja.FunctionCall) goja.Value {
+	return p.ForEachTags(call)
+}
+func (p *pathObject) SnakeGetLimit(limit int) error {
+	return p.GetLimit(limit)
+}
+func (p *pathObject) SnakeGroupCount(tag string) ([]interface{}, error) {
+	return p.GroupCount(tag)
+}
+func (p *pathObject) SnakeHasAll(call goja.FunctionCall) goja.Value {
+	return p.HasAll(call)
+}
+func (p *pathObject) SnakeHasAny() (bool, error) {
+	return p.HasAny()
+}
+func (p *pathObject) SnakeHasFilter(call goja.FunctionCall) goja.Value {
+	return p.HasFilter(call)
+}
+func (p *pathObject) SnakeHasNot(call goja.FunctionCall) goja.Value {
+	return p.HasNot(call)
+}
+func (p *pathObject) SnakeHasPrefix(call goja.FunctionCall) goja.Value {
+	return p.HasPrefix(call)
+}
+func (p *pathObject) SnakeHasR(call goja.FunctionCall) goja.Value {
+	return p.HasR(call)
+}
+func (p *pathObject) SnakeInPredicates() *pathObject {
+	return p.InPredicates()
+}
+func (p *pathObject) SnakeInValues(call goja.FunctionCall) goja.Value {
+	return p.InValues(call)
+}
+func (p *pathObject) SnakeLabelContext(call goja.FunctionCall) goja.Value {
+	return p.LabelContext(call)
+}
+func (p *pathObject) SnakeLangMatches(call goja.FunctionCall) goja.Value {
+	return p.LangMatches(call)
+}
+func (p *pathObject) SnakeOutPredicates() *pathObject {
+	return p.OutPredicates()
+}
+func (p *pathObject) SnakeOutValues(call goja.FunctionCall) goja.Value {
+	return p.OutValues(call)
+}
+func (p *pathObject) SnakeResumeFrom(token string) (*pathObject, error) {
+	return p.ResumeFrom(token)
+}
+func (p *pathObject) SnakeSaveInPredicates(tag string) *pathObject {
+	return p.SaveInPredicates(tag)
+}
+func (p *pathObject) SnakeSaveOpt(call goja.FunctionCall) goja.Value {
+	return p.SaveOpt(call)
+}
+func (p *pathObject) SnakeSaveOptR(call goja.FunctionCall) goja.Value {
+	return p.SaveOptR(call)
+}
+func (p *pathObject) SnakeSaveOutPredicates(tag string) *pathObject {
+	return p.SaveOutPredicates(tag)
+}
+func (p *pathObject) SnakeSaveR(call goja.FunctionCall) goja.Value {
+	return p.SaveR(call)
+}
+func (p *pathObject) SnakeSaveReverse(call goja.FunctionCall) goja.Value {
+	return p.SaveReverse(call)
+}
+func (p *pathObject) SnakeSelectTags(call goja.FunctionCall) goja.Value {
+	return p.SelectTags(call)
+}
+func (p *pathObject) SnakeTagArray(call goja.FunctionCall) goja.Value {
+	return p.TagArray(call)
+}
+func (p *pathObject) SnakeTagValue() (interface{}, error) {
+	return p.TagValue()
+}
+func (p *pathObject) SnakeToArray(call goja.FunctionCall) goja.Value {
+	return p.ToArray(call)
+}
+func (p *pathObject) SnakeToObject(idTag string) (interface{}, error) {
+	return p.ToObject(idTag)
+}
+func (p *pathObject) SnakeToValue() (interface{}, error) {
+	return p.ToValue()
+}
+func (p *pathObject) SnakeToValueTags() (interface{}, error) {
+	return p.ToValueTags()
+}
+func (g *graphObject) SnakeAddDefaultNamespaces() {
+	g.AddDefaultNamespaces()
+}
+func (g *graphObject) SnakeAddNamespace(pref, ns string) {
+	g.AddNamespace(pref, ns)
+}
+func (g *graphObject) SnakeEmitMeta(call goja.FunctionCall) goja.Value {
+	return g.EmitMeta(call)
+}
+func (g *graphObject) SnakeFixedSet(call goja.FunctionCall) goja.Value {
+	return g.FixedSet(call)
+}
+func (g *graphObject) SnakeFromValue(call goja.FunctionCall) goja.Value {
+	return g.FromValue(call)
+}
+func (g *graphObject) SnakeLoadNamespaces() error {
+	return g.LoadNamespaces()
+}
+func (g *graphObject) SnakeNamedMorphism(name string) (*pathObject, error) {
+	return g.NamedMorphism(name)
+}
+func (g *graphObject) SnakeSaveMorphism(name string, m *pathObject) error {
+	return g.SaveMorphism(name, m)
+}
+func (g *graphObject) SnakeToValue(call goja.FunctionCall) goja.Value {
+	return g.ToValue(call)
+}
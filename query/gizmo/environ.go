@@ -17,17 +17,26 @@ package gizmo
 // Builds a new Gizmo environment pointing at a session.
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dop251/goja"
+	"golang.org/x/text/language"
 
+	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/query/path"
 	"github.com/cayleygraph/cayley/query/shape"
 	"github.com/cayleygraph/quad"
 	"github.com/cayleygraph/quad/voc"
+	"github.com/cayleygraph/quad/voc/xsd"
 )
 
 // graphObject is a root graph object.
@@ -79,6 +88,7 @@ func (g *graphObject) NewVertex(call goja.FunctionCall) goja.Value {
 	if err != nil {
 		return throwErr(g.s.vm, err)
 	}
+	qv = g.s.resolveValues(qv)
 	return g.s.vm.ToValue(&pathObject{
 		s:      g.s,
 		finals: true,
@@ -86,6 +96,38 @@ func (g *graphObject) NewVertex(call goja.FunctionCall) goja.Value {
 	})
 }
 
+// FixedSet is the same as Vertex, but resolves nodes once and returns a path that can be reused by multiple queries.
+// Signature: ([nodeId],[nodeId]...)
+//
+// Nodes that are not in the graph are ignored. Unlike Vertex, no ids means an empty set, not "all vertices".
+//
+// Nodes are resolved for the current quad store, thus the path cannot be executed on a different one.
+// For the same reason, a morphism that uses it cannot be saved with g.saveMorphism.
+//
+// Example:
+// 	// javascript
+//	var people = g.fixedSet("<alice>", "<bob>", "<charlie>")
+//	people.out("<follows>").all()
+//	people.in("<follows>").all()
+func (g *graphObject) FixedSet(call goja.FunctionCall) goja.Value {
+	qv, err := toQuadValues(exportArgs(call.Arguments))
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	qv = g.s.resolveValues(qv)
+	nodes := make([]graph.Ref, 0, len(qv))
+	for _, v := range qv {
+		if ref := g.s.qs.ValueOf(v); ref != nil {
+			nodes = append(nodes, ref)
+		}
+	}
+	return g.s.vm.ToValue(&pathObject{
+		s:      g.s,
+		finals: true,
+		path:   path.StartPathFixed(g.s.qs, nodes...),
+	})
+}
+
 // M is a shorthand for Morphism.
 func (g *graphObject) NewM() *pathObject {
 	return g.NewMorphism()
@@ -105,21 +147,144 @@ func (g *graphObject) NewMorphism() *pathObject {
 	}
 }
 
+// Predicates returns a list of all predicates in the graph.
+//
+//	// javascript
+//	g.emit(g.predicates())
+func (g *graphObject) Predicates() ([]interface{}, error) {
+	out := make([]interface{}, 0)
+	ctx, cancel := g.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, g.s.qs.NodesAllIterator()).EachValuePair(g.s.qs, func(ref graph.Ref, v quad.Value) {
+		first, err := iterator.Iterate(ctx, g.s.qs.QuadIterator(quad.Predicate, ref)).First()
+		if err == nil && first != nil {
+			out = append(out, g.s.quadValueToNative(v))
+		}
+	})
+	err = g.s.queryErr(ctx, err)
+	return out, err
+}
+
+// Stats returns the number of quads and nodes in the graph, without scanning it.
+// Signature: ([exact])
+//
+// The result has the following fields: quads, nodes, and exact that is set if both counts are exact.
+// Some backends can only estimate counts. Passing true forces exact counts, which may be slow.
+//
+//	// javascript
+//	g.emit(g.stats().quads)
+func (g *graphObject) Stats(exact bool) (map[string]interface{}, error) {
+	ctx, cancel := g.s.context()
+	defer cancel()
+	st, err := g.s.qs.Stats(ctx, exact)
+	if err = g.s.queryErr(ctx, err); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"quads": st.Quads.Value,
+		"nodes": st.Nodes.Value,
+		"exact": st.Quads.Exact && st.Nodes.Exact,
+	}, nil
+}
+
+// Diff compares results of two paths. It returns an object with three arrays of nodes:
+// onlyLeft is the nodes found only by the first path, onlyRight is the nodes found only by the second one,
+// and both is the nodes found by both paths.
+// Signature: (path1, path2)
+//
+//	// javascript
+//	var d = g.diff(g.V("<alice>").out("<follows>"), g.V("<charlie>").out("<follows>"))
+//	g.emit(d.both) // ["<bob>"]
+func (g *graphObject) Diff(left, right *pathObject) (map[string]interface{}, error) {
+	if left == nil || right == nil || !left.finals || !right.finals {
+		return nil, fmt.Errorf("diff: expected two paths")
+	}
+	run := func(p *path.Path) ([]interface{}, error) {
+		it := left.new(p).buildIteratorTree()
+		it = iterator.Tag(it, g.s.resultTag)
+		return g.s.runIteratorToArrayNoTags(it, -1)
+	}
+	onlyLeft, err := run(left.path.Clone().Except(right.path))
+	if err != nil {
+		return nil, err
+	}
+	onlyRight, err := run(right.path.Clone().Except(left.path))
+	if err != nil {
+		return nil, err
+	}
+	both, err := run(left.path.Clone().And(right.path))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"onlyLeft":  onlyLeft,
+		"onlyRight": onlyRight,
+		"both":      both,
+	}, nil
+}
+
+// Truncated returns true if results of followRecursive were cut off by the maxResults limit
+// since the query started executing.
+//
+//	// javascript
+//	var people = g.V("<charlie>").followRecursive(g.M().out("<follows>"), 0, 2).toArray()
+//	if (g.truncated()) {
+//		g.emit("more than 2 people")
+//	}
+func (g *graphObject) Truncated() bool {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	return g.s.truncated
+}
+
 // Emit adds data programmatically to the JSON result list. Can be any JSON type.
 //
+// Emitted values are always returned in the order of emit calls, including calls made from callbacks
+// of forEach and other finals, since callbacks run one at a time on the script itself.
+// Each value is numbered in this order (see Result.Seq).
+//
 //	// javascript
 //	g.emit({name:"bob"}) // push {"name":"bob"} as a result
 func (g *graphObject) Emit(call goja.FunctionCall) goja.Value {
 	value := call.Argument(0)
 	if !goja.IsNull(value) && !goja.IsUndefined(value) {
 		val := exportArgs([]goja.Value{value})[0]
+		if m, ok := val.(map[string]interface{}); ok {
+			if _, ok = m[EmitMetaKey]; ok {
+				return throwErr(g.s.vm, errReservedKey{Key: EmitMetaKey})
+			}
+		}
 		if val != nil {
-			g.s.send(nil, &Result{Val: val})
+			g.s.send(nil, &Result{Val: val, Seq: g.s.nextEmitSeq()})
 		}
 	}
 	return goja.Null()
 }
 
+// EmitMeta is the same as Emit, but attaches metadata to the value.
+// Signature: (value, meta)
+//
+// The value must be an object. Metadata is returned under the reserved "$meta" key of the value,
+// thus the value itself cannot contain this key. The same is true for values passed to Emit.
+//
+//	// javascript
+//	g.emitMeta({name:"bob"}, {source:"friends", score:0.5})
+//	// push {"name":"bob", "$meta":{"source":"friends", "score":0.5}} as a result
+func (g *graphObject) EmitMeta(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 {
+		return throwErr(g.s.vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	val, ok := args[0].(map[string]interface{})
+	if !ok {
+		return throwErr(g.s.vm, fmt.Errorf("emitMeta: expected an object, got: %T", args[0]))
+	} else if _, ok = val[EmitMetaKey]; ok {
+		return throwErr(g.s.vm, errReservedKey{Key: EmitMetaKey})
+	}
+	g.s.send(nil, &Result{Val: val, Metadata: args[1], Seq: g.s.nextEmitSeq()})
+	return goja.Null()
+}
+
 // Backwards compatibility
 func (g *graphObject) CapitalizedUri(s string) quad.IRI {
 	return g.NewIRI(s)
@@ -157,49 +322,110 @@ func twoStringType(fnc func(s1, s2 string) quad.Value) func(vm *goja.Runtime, ca
 	}
 }
 
-func cmpOpType(op iterator.Operator) func(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
-	return func(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+// cmpOp implements comparison builtins (lt, gt, etc). The argument is either a value, or a path
+// that must resolve to a single value. The path is executed when the filter is created,
+// not when the query that uses the filter is executed.
+func (s *Session) cmpOp(op iterator.Operator) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
 		args := exportArgs(call.Arguments)
 		if len(args) != 1 {
-			return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+			return s.filterErr(errArgCount2{Expected: 1, Got: len(args)})
+		}
+		var (
+			qv  quad.Value
+			err error
+		)
+		if p, ok := call.Argument(0).Export().(*pathObject); ok {
+			qv, err = p.singleValue()
+			if _, ok = err.(errNotSingleValue); err != nil && !ok {
+				// failed to run the path
+				return throwErr(s.vm, err)
+			}
+		} else {
+			qv, err = toQuadValue(args[0])
 		}
-		qv, err := toQuadValue(args[0])
 		if err != nil {
-			return throwErr(vm, err)
+			return s.filterErr(err)
+		}
+		if ts, ok := qv.(quad.TypedString); ok && ts.Type == xsdDuration {
+			if d, err := parseDuration(string(ts.Value)); err == nil {
+				return s.vm.ToValue(valFilter{f: durationComparison{op: op, val: d}})
+			}
 		}
-		return vm.ToValue(valFilter{f: shape.Comparison{Op: op, Val: qv}})
+		return s.vm.ToValue(valFilter{f: shape.Comparison{Op: op, Val: qv}})
 	}
 }
 
-func cmpWildcard(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+// cmpWildcard implements a "like" builtin.
+// Signature: (pattern, [ignoreCase])
+func (s *Session) cmpWildcard(call goja.FunctionCall) goja.Value {
+	vm := s.vm
 	args := exportArgs(call.Arguments)
-	if len(args) != 1 {
-		return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+	if len(args) != 1 && len(args) != 2 {
+		return s.filterErr(errArgCount2{Expected: 1, Got: len(args)})
 	}
 	pattern, ok := args[0].(string)
 	if !ok {
-		return throwErr(vm, fmt.Errorf("wildcard: unsupported type: %T", args[0]))
+		return s.filterErr(fmt.Errorf("wildcard: unsupported type: %T", args[0]))
 	}
-	return vm.ToValue(valFilter{f: shape.Wildcard{Pattern: pattern}})
+	ignoreCase := s.ignoreCase
+	if len(args) > 1 {
+		if ignoreCase, ok = args[1].(bool); !ok {
+			return s.filterErr(fmt.Errorf("expected bool as second argument"))
+		}
+	}
+	return vm.ToValue(valFilter{f: shape.Wildcard{Pattern: pattern, IgnoreCase: ignoreCase}})
 }
 
-func cmpRegexp(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+// cmpRegexp implements a "regex" builtin.
+// Signature: (expression, [includeIRIs, [ignoreCase]]) or (expression, options)
+//
+// Options object may have includeIRIs and caseInsensitive boolean fields.
+func (s *Session) cmpRegexp(call goja.FunctionCall) goja.Value {
+	vm := s.vm
 	args := exportArgs(call.Arguments)
-	if len(args) != 1 && len(args) != 2 {
-		return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+	if len(args) < 1 || len(args) > 3 {
+		return s.filterErr(errArgCount2{Expected: 1, Got: len(args)})
 	}
 	v, err := toQuadValue(args[0])
 	if err != nil {
-		return throwErr(vm, err)
+		return s.filterErr(err)
 	}
 	allowRefs := false
+	ignoreCase := s.ignoreCase
+	if len(args) == 2 {
+		if opts, ok := args[1].(map[string]interface{}); ok {
+			for k, o := range opts {
+				b, ok := o.(bool)
+				if !ok {
+					return s.filterErr(fmt.Errorf("expected bool for %q option", k))
+				}
+				switch k {
+				case "includeIRIs":
+					allowRefs = b
+				case "caseInsensitive":
+					ignoreCase = b
+				default:
+					return s.filterErr(fmt.Errorf("unknown regex option: %q", k))
+				}
+			}
+			args = args[:1]
+		}
+	}
 	if len(args) > 1 {
 		b, ok := args[1].(bool)
 		if !ok {
-			return throwErr(vm, fmt.Errorf("expected bool as second argument"))
+			return s.filterErr(fmt.Errorf("expected bool or options object as second argument"))
 		}
 		allowRefs = b
 	}
+	if len(args) > 2 {
+		b, ok := args[2].(bool)
+		if !ok {
+			return s.filterErr(fmt.Errorf("expected bool as third argument"))
+		}
+		ignoreCase = b
+	}
 	switch vt := v.(type) {
 	case quad.String:
 		if allowRefs {
@@ -207,63 +433,428 @@ func cmpRegexp(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
 		}
 	case quad.IRI:
 		if !allowRefs {
-			return throwErr(vm, errRegexpOnIRI)
+			return s.filterErr(errRegexpOnIRI)
 		}
 	case quad.BNode:
 		if !allowRefs {
-			return throwErr(vm, errRegexpOnIRI)
+			return s.filterErr(errRegexpOnIRI)
 		}
 	default:
-		return throwErr(vm, fmt.Errorf("regexp: unsupported type: %T", v))
+		return s.filterErr(fmt.Errorf("regexp: unsupported type: %T", v))
 	}
 	var (
-		s    string
+		expr string
 		refs bool
 	)
 	switch v := v.(type) {
 	case quad.String:
-		s = string(v)
+		expr = string(v)
 	case quad.IRI:
-		s, refs = string(v), true
+		expr, refs = string(v), true
 	case quad.BNode:
-		s, refs = string(v), true
+		expr, refs = string(v), true
 	default:
-		return throwErr(vm, fmt.Errorf("regexp from non-string value: %T", v))
+		return s.filterErr(fmt.Errorf("regexp from non-string value: %T", v))
 	}
-	re, err := regexp.Compile(string(s))
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
 	if err != nil {
-		return throwErr(vm, err)
+		return s.filterErr(err)
 	}
 	return vm.ToValue(valFilter{f: shape.Regexp{Re: re, Refs: refs}})
 }
 
 type valFilter struct {
 	f shape.ValueFilter
+	// err is set instead of f if the filter is invalid and soft errors are enabled.
+	// See WithSoftErrors.
+	err error
+}
+
+var _ shape.ValueFilter = filterCallback{}
+
+// filterCallback is a value filter that passes values for which all JS callbacks return true.
+// Callbacks are called in order, and the first one that returns false stops the evaluation.
+type filterCallback struct {
+	s   *Session
+	fns []goja.Callable
+}
+
+func (f filterCallback) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		arg := f.s.vm.ToValue(f.s.quadValueToJS(v))
+		for _, fnc := range f.fns {
+			out, err := fnc(goja.Undefined(), arg)
+			if err != nil {
+				return false, err
+			} else if !out.ToBoolean() {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
 }
 
 var defaultEnv = map[string]func(vm *goja.Runtime, call goja.FunctionCall) goja.Value{
-	"iri":   oneStringType(func(s string) quad.Value { return quad.IRI(s) }),
-	"bnode": oneStringType(func(s string) quad.Value { return quad.BNode(s) }),
-	"raw":   oneStringType(func(s string) quad.Value { return quad.Raw(s) }),
-	"str":   oneStringType(func(s string) quad.Value { return quad.String(s) }),
+	"iri": oneStringType(func(s string) quad.Value { return quad.IRI(s) }),
+	"raw": oneStringType(func(s string) quad.Value { return quad.Raw(s) }),
+	"str": oneStringType(func(s string) quad.Value { return quad.String(s) }),
 
-	"lang": twoStringType(func(s, lang string) quad.Value {
-		return quad.LangString{Value: quad.String(s), Lang: lang}
-	}),
 	"typed": twoStringType(func(s, typ string) quad.Value {
 		return quad.TypedString{Value: quad.String(s), Type: quad.IRI(typ)}
 	}),
 
-	"lt":    cmpOpType(iterator.CompareLT),
-	"lte":   cmpOpType(iterator.CompareLTE),
-	"gt":    cmpOpType(iterator.CompareGT),
-	"gte":   cmpOpType(iterator.CompareGTE),
-	"regex": cmpRegexp,
-	"like":  cmpWildcard,
+	"geo": geoPoint,
+
+	"duration": duration,
+	"timeAdd":  timeShift(false),
+	"timeSub":  timeShift(true),
+
+	"uuid": uuidValue,
+
+	"parseTyped": parseTyped,
+}
+
+// parseTyped implements a "parseTyped" builtin. It accepts a typed literal and returns an object
+// with its lexical form and the full datatype IRI: {value: "1", type: "http://www.w3.org/2001/XMLSchema#integer"}.
+func parseTyped(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 {
+		return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	v, ok := args[0].(quad.TypedString)
+	if !ok {
+		return throwErr(vm, fmt.Errorf("parseTyped: expected a typed literal, got: %T", args[0]))
+	}
+	return vm.ToValue(map[string]interface{}{
+		"value": string(v.Value),
+		"type":  string(v.Type),
+	})
+}
+
+// newUUID generates a random (version 4) UUID using crypto/rand.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// uuidValue implements a "uuid" builtin. Without arguments it returns a blank node with a new random UUID.
+// If a prefix is given, it returns an IRI that consists of the prefix followed by the UUID.
+func uuidValue(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) > 1 {
+		return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	id, err := newUUID()
+	if err != nil {
+		return throwErr(vm, err)
+	}
+	if len(args) == 0 {
+		return vm.ToValue(quad.BNode(id))
+	}
+	prefix, ok := args[0].(string)
+	if !ok {
+		return throwErr(vm, fmt.Errorf("uuid: expected a string prefix, got: %T", args[0]))
+	}
+	return vm.ToValue(quad.IRI(prefix + id))
+}
+
+// xsdDuration is a datatype for durations, as produced by the duration builtin.
+const xsdDuration = quad.IRI(xsd.Prefix + "duration")
+
+// duration implements a "duration" builtin. It parses a Go duration string (like "24h" or "1h30m")
+// and returns an xsd:duration value.
+func duration(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	args := toStrings(exportArgs(call.Arguments))
+	if len(args) != 1 {
+		return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return throwErr(vm, err)
+	}
+	return vm.ToValue(quad.TypedString{Value: quad.String(formatDuration(d)), Type: xsdDuration})
+}
+
+// formatDuration formats a duration in the xsd:duration format, using only hours, minutes and seconds.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var buf strings.Builder
+	if d < 0 {
+		buf.WriteByte('-')
+		d = -d
+	}
+	buf.WriteString("PT")
+	if h := d / time.Hour; h > 0 {
+		buf.WriteString(strconv.FormatInt(int64(h), 10) + "H")
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		buf.WriteString(strconv.FormatInt(int64(m), 10) + "M")
+		d -= m * time.Minute
+	}
+	if d > 0 {
+		buf.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S")
+	}
+	return buf.String()
+}
+
+// parseDuration parses a duration returned by formatDuration. Durations with days, months or years are not supported.
+func parseDuration(s string) (time.Duration, error) {
+	v := s
+	neg := strings.HasPrefix(v, "-")
+	if neg {
+		v = v[1:]
+	}
+	if !strings.HasPrefix(v, "PT") || len(v) == 2 || strings.Trim(v[2:], "0123456789.HMS") != "" {
+		return 0, fmt.Errorf("unsupported duration: %q", s)
+	}
+	d, err := time.ParseDuration(strings.ToLower(v[2:]))
+	if err != nil {
+		return 0, fmt.Errorf("unsupported duration: %q", s)
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// toDuration converts a value of the duration builtin or a Go duration string to time.Duration.
+func toDuration(v quad.Value) (time.Duration, error) {
+	switch v := v.(type) {
+	case quad.TypedString:
+		if v.Type != xsdDuration {
+			return 0, fmt.Errorf("expected a duration, got: %v", v.Type)
+		}
+		return parseDuration(string(v.Value))
+	case quad.String:
+		return time.ParseDuration(string(v))
+	}
+	return 0, fmt.Errorf("expected a duration, got: %T", v)
+}
+
+var _ shape.ValueFilter = durationComparison{}
+
+// durationComparison compares xsd:duration values by their length, since the lexical order
+// of durations is different: PT2H would be greater than PT10H. Values of other types never match.
+type durationComparison struct {
+	op  iterator.Operator
+	val time.Duration
+}
+
+func (f durationComparison) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		ts, ok := v.(quad.TypedString)
+		if !ok || ts.Type != xsdDuration {
+			return false, nil
+		}
+		d, err := parseDuration(string(ts.Value))
+		if err != nil {
+			return false, nil
+		}
+		return iterator.RunIntOp(quad.Int(d), f.op, quad.Int(f.val)), nil
+	})
+}
+
+// timeShift implements "timeAdd" and "timeSub" builtins. They add a duration to a time value
+// or subtract it, for example timeSub(now(), duration("24h")).
+func timeShift(sub bool) func(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	return func(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+		args := exportArgs(call.Arguments)
+		if len(args) != 2 {
+			return throwErr(vm, errArgCount2{Expected: 2, Got: len(args)})
+		}
+		tv, err := toQuadValue(args[0])
+		if err != nil {
+			return throwErr(vm, err)
+		}
+		t, ok := tv.(quad.Time)
+		if !ok {
+			return throwErr(vm, fmt.Errorf("expected a time, got: %T", tv))
+		}
+		dv, err := toQuadValue(args[1])
+		if err != nil {
+			return throwErr(vm, err)
+		}
+		d, err := toDuration(dv)
+		if err != nil {
+			return throwErr(vm, err)
+		}
+		if sub {
+			d = -d
+		}
+		return vm.ToValue(quad.Time(time.Time(t).Add(d)))
+	}
+}
+
+// wktLiteral is a GeoSPARQL datatype for geometries in WKT format.
+const wktLiteral = quad.IRI("http://www.opengis.net/ont/geosparql#wktLiteral")
+
+// geoPoint implements a "geo" builtin. It accepts latitude and longitude in degrees
+// and returns a WKT point. Note that WKT puts longitude first.
+func geoPoint(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 {
+		return throwErr(vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	lat, ok1 := toFloat(args[0])
+	lng, ok2 := toFloat(args[1])
+	if !ok1 || !ok2 {
+		return throwErr(vm, fmt.Errorf("geo: expected numeric coordinates, got: %T, %T", args[0], args[1]))
+	} else if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return throwErr(vm, fmt.Errorf("geo: latitude must be in [-90, 90], got: %v", lat))
+	} else if math.IsNaN(lng) || lng < -180 || lng > 180 {
+		return throwErr(vm, fmt.Errorf("geo: longitude must be in [-180, 180], got: %v", lng))
+	}
+	wkt := "POINT(" + strconv.FormatFloat(lng, 'g', -1, 64) + " " + strconv.FormatFloat(lat, 'g', -1, 64) + ")"
+	return vm.ToValue(quad.TypedString{Value: quad.String(wkt), Type: wktLiteral})
+}
+
+// blankNode implements a "bnode" builtin. Without arguments it returns a new unique blank node.
+// If WithBlankNodeScope is enabled, labels are mapped to unique blank nodes that are stable within the session.
+func (s *Session) blankNode(call goja.FunctionCall) goja.Value {
+	args := toStrings(exportArgs(call.Arguments))
+	switch len(args) {
+	case 0:
+		return s.vm.ToValue(quad.RandomBlankNode())
+	case 1:
+	default:
+		return throwErr(s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	label := args[0]
+	if !s.scopedBNodes {
+		return s.vm.ToValue(quad.BNode(label))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bnodes[label]
+	if !ok {
+		if s.bnodes == nil {
+			s.bnodes = make(map[string]quad.BNode)
+		}
+		b = quad.RandomBlankNode()
+		s.bnodes[label] = b
+	}
+	return s.vm.ToValue(b)
+}
+
+// now implements a "now" builtin. It returns the current time in UTC, as reported by the session clock.
+// See WithClock.
+func (s *Session) now(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 0 {
+		return throwErr(s.vm, errArgCount2{Expected: 0, Got: len(call.Arguments)})
+	}
+	return s.vm.ToValue(quad.Time(s.clock().UTC()))
+}
+
+// curie implements a "curie" builtin. It is the same as "iri", but expands prefixed names like "rdf:type"
+// using namespaces registered in the session (see graph.addNamespace). Strings without a known prefix are used as-is.
+func (s *Session) curie(call goja.FunctionCall) goja.Value {
+	args := toStrings(exportArgs(call.Arguments))
+	if len(args) != 1 {
+		return throwErr(s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	return s.vm.ToValue(quad.IRI(s.ns.FullIRI(args[0])))
+}
+
+// ResetBlankNodes forgets all blank node labels of the session. See WithBlankNodeScope.
+func (s *Session) ResetBlankNodes() {
+	s.mu.Lock()
+	s.bnodes = nil
+	s.mu.Unlock()
+}
+
+// checkLangTag checks if the tag is a valid BCP 47 language tag.
+func checkLangTag(tag string) error {
+	// language.Parse accepts underscores as separators, but BCP 47 doesn't
+	if strings.Contains(tag, "_") {
+		return fmt.Errorf("subtags must be separated by '-'")
+	}
+	_, err := language.Parse(tag)
+	return err
+}
+
+// langString implements a "lang" builtin. Language tags are validated if WithLangValidation is enabled.
+func (s *Session) langString(call goja.FunctionCall) goja.Value {
+	args := toStrings(exportArgs(call.Arguments))
+	if len(args) != 2 {
+		return throwErr(s.vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	if s.validLang {
+		if err := checkLangTag(args[1]); err != nil {
+			return throwErr(s.vm, errInvalidLangTag{Tag: args[1], Err: err})
+		}
+	}
+	return s.vm.ToValue(quad.LangString{Value: quad.String(args[0]), Lang: args[1]})
+}
+
+// valueObject wraps a quad.Value returned to JS to provide type information.
+type valueObject struct {
+	s *Session
+	v quad.Value
+}
+
+// Type returns a type of the value. See typeOf for a list of types.
+func (o *valueObject) Type() string {
+	return typeOf(o.v)
+}
+
+// Value returns a native JS value.
+func (o *valueObject) Value() interface{} {
+	return o.s.quadValueToNative(o.v)
+}
+
+// ToString returns a string representation of the value, as it will be written in N-Quads.
+func (o *valueObject) ToString() string {
+	return o.v.String()
+}
+
+// MarshalJSON implements json.Marshaler. Wrapped values are encoded the same way as native values.
+func (o *valueObject) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.s.quadValueToNative(o.v))
+}
+
+// typeOf returns a name of the value type:
+// "iri", "bnode", "string", "lang", "typed", "int", "float", "bool" or "time".
+// Empty string is returned for unknown types.
+func typeOf(v quad.Value) string {
+	switch v.(type) {
+	case quad.IRI:
+		return "iri"
+	case quad.BNode:
+		return "bnode"
+	case quad.String:
+		return "string"
+	case quad.LangString:
+		return "lang"
+	case quad.TypedString:
+		return "typed"
+	case quad.Int:
+		return "int"
+	case quad.Float:
+		return "float"
+	case quad.Bool:
+		return "bool"
+	case quad.Time:
+		return "time"
+	}
+	return ""
 }
 
 func unwrap(o interface{}) interface{} {
 	switch v := o.(type) {
+	case *valueObject:
+		o = v.v
 	case *pathObject:
 		o = v.path
 	case []interface{}:
@@ -303,6 +894,19 @@ func toInt(o interface{}) (int, bool) {
 	}
 }
 
+func toFloat(o interface{}) (float64, bool) {
+	switch v := o.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
 func toQuadValue(o interface{}) (quad.Value, error) {
 	var qv quad.Value
 	switch v := o.(type) {
@@ -408,15 +1012,21 @@ func toViaData(objs []interface{}) (predicates []interface{}, tags []string, ok
 	return
 }
 
-func toViaDepthData(objs []interface{}) (predicates []interface{}, maxDepth int, tags []string, ok bool) {
+func toViaDepthData(objs []interface{}) (predicates []interface{}, maxDepth, maxResults int, tags []string, ok bool) {
 	if len(objs) != 0 {
 		predicates = toVia([]interface{}{objs[0]})
 	}
 	if len(objs) > 1 {
 		maxDepth, ok = toInt(objs[1])
 		if ok {
-			if len(objs) > 2 {
-				tags = toStrings(objs[2:])
+			objs = objs[2:]
+			if len(objs) != 0 {
+				if maxResults, ok = toInt(objs[0]); ok {
+					objs = objs[1:]
+				}
+			}
+			if len(objs) != 0 {
+				tags = toStrings(objs)
 			}
 		} else {
 			tags = toStrings(objs[1:])
@@ -14,11 +14,23 @@
 
 package gizmo
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cayleygraph/quad"
+)
 
 var (
 	errNoVia       = fmt.Errorf("expected predicate list")
 	errRegexpOnIRI = fmt.Errorf("regexps are not allowed on IRIs")
+
+	errEmptyMorphismName = fmt.Errorf("expected morphism name")
+	errNotMorphism       = fmt.Errorf("expected morphism, got a query path")
+
+	errEvalDisabled = fmt.Errorf("eval and Function are disabled with the instruction limit")
 )
 
 type errArgCount2 struct {
@@ -38,6 +50,14 @@ func (e errArgCount) Error() string {
 	return fmt.Sprintf("unexpected arguments count: %d", e.Got)
 }
 
+type errBoundTypes struct {
+	Low, High quad.Value
+}
+
+func (e errBoundTypes) Error() string {
+	return fmt.Sprintf("bounds must be both numbers or both times, got: %T and %T", e.Low, e.High)
+}
+
 type errNotQuadValue struct {
 	Val interface{}
 }
@@ -45,3 +65,149 @@ type errNotQuadValue struct {
 func (e errNotQuadValue) Error() string {
 	return fmt.Sprintf("not a quad.Value: %T", e.Val)
 }
+
+type errInvalidResumeToken struct {
+	Reason string
+}
+
+func (e errInvalidResumeToken) Error() string {
+	return fmt.Sprintf("invalid resume token: %s", e.Reason)
+}
+
+type errUnknownPredicate struct {
+	Preds []quad.Value
+}
+
+func (e errUnknownPredicate) Error() string {
+	names := make([]string, 0, len(e.Preds))
+	for _, v := range e.Preds {
+		names = append(names, v.String())
+	}
+	return fmt.Sprintf("unknown predicates: %s", strings.Join(names, ", "))
+}
+
+type errUnknownMorphism struct {
+	Name string
+}
+
+func (e errUnknownMorphism) Error() string {
+	return fmt.Sprintf("unknown morphism: %q", e.Name)
+}
+
+type errMorphismNotSerializable struct {
+	Name string
+	Err  error
+}
+
+func (e errMorphismNotSerializable) Error() string {
+	return fmt.Sprintf("cannot save morphism %q: %v", e.Name, e.Err)
+}
+
+type errInvalidLangTag struct {
+	Tag string
+	Err error
+}
+
+func (e errInvalidLangTag) Error() string {
+	return fmt.Sprintf("invalid language tag %q: %v", e.Tag, e.Err)
+}
+
+// errTooManyResults is returned when a final collects more results than allowed by WithMaxResults.
+type errTooManyResults struct {
+	Max int
+}
+
+func (e errTooManyResults) Error() string {
+	return fmt.Sprintf("too many results: stopped after %d results", e.Max)
+}
+
+// errInstructionLimit is returned when a script exceeds the limit set with WithInstructionLimit.
+type errInstructionLimit struct {
+	Limit int64
+}
+
+func (e errInstructionLimit) Error() string {
+	return fmt.Sprintf("script exceeded the instruction limit: %d steps", e.Limit)
+}
+
+type errPathTooDeep struct {
+	Max int
+}
+
+func (e errPathTooDeep) Error() string {
+	return fmt.Sprintf("path is too deep: more than %d steps", e.Max)
+}
+
+// errQueryTimeout is returned when a query final runs longer than the timeout set with WithTimeout.
+// It wraps context.DeadlineExceeded.
+type errQueryTimeout struct {
+	Timeout time.Duration
+}
+
+func (e errQueryTimeout) Error() string {
+	return fmt.Sprintf("query timed out after %v", e.Timeout)
+}
+
+func (e errQueryTimeout) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+type errValueConversion struct {
+	Val  interface{}
+	Type string
+}
+
+func (e errValueConversion) Error() string {
+	return fmt.Sprintf("cannot convert %v (%T) to %s", e.Val, e.Val, e.Type)
+}
+
+type errUnknownValueType struct {
+	Type string
+}
+
+func (e errUnknownValueType) Error() string {
+	return fmt.Sprintf("unknown value type: %q", e.Type)
+}
+
+type errReservedKey struct {
+	Key string
+}
+
+func (e errReservedKey) Error() string {
+	return fmt.Sprintf("key %q is reserved", e.Key)
+}
+
+type errMultipleEntities struct {
+	Tag string
+}
+
+func (e errMultipleEntities) Error() string {
+	return fmt.Sprintf("expected a single entity, got different values for tag %q", e.Tag)
+}
+
+type errNotSingleValue struct {
+	Got int
+}
+
+func (e errNotSingleValue) Error() string {
+	if e.Got > 1 {
+		return "expected path to resolve to a single value, got multiple values"
+	}
+	return "expected path to resolve to a single value, got none"
+}
+
+type errUnknownTag struct {
+	Tag string
+}
+
+func (e errUnknownTag) Error() string {
+	return fmt.Sprintf("unknown tag: %q", e.Tag)
+}
+
+type errNotNumeric struct {
+	Val quad.Value
+}
+
+func (e errNotNumeric) Error() string {
+	return fmt.Sprintf("expected a numeric value, got: %v (%T)", e.Val, e.Val)
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/query/path"
+	"github.com/cayleygraph/quad"
+)
+
+// ExecResult is a result of a script executed with Exec.
+type ExecResult struct {
+	// Paths contains results of path finals like All, with tags resolved to values.
+	Paths []map[string]quad.Value
+	// Emitted contains values added with Emit and EmitMeta, in order they were sent.
+	// Graph values, for example returned by ToArray with typed results, are converted to quad.Value.
+	Emitted []interface{}
+	// Value is the value of the last statement of the script, for example a result of ToArray.
+	// It's converted the same way as emitted values.
+	Value interface{}
+	// Errors contains errors collected in soft errors mode. See WithSoftErrors.
+	Errors []error
+}
+
+// Exec runs a script and collects all its results. Unlike Execute, it returns Go values
+// instead of values prepared for a specific collation.
+//
+// The script can be canceled with the context, the same way as with Execute.
+func (s *Session) Exec(ctx context.Context, script string) (*ExecResult, error) {
+	it, err := s.Execute(ctx, script, query.Options{Collation: query.Raw})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	out := &ExecResult{}
+	for it.Next(ctx) {
+		r, ok := it.Result().(*Result)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.Meta:
+			out.Value = execValue(r.Val)
+		case r.Errors != nil:
+			out.Errors = append(out.Errors, r.Errors...)
+		case r.Tags != nil:
+			m := make(map[string]quad.Value, len(r.Tags))
+			// with multi-tags, only the last value of a repeated tag is kept
+			seqs := make(map[string]int)
+			for k, ref := range r.Tags {
+				name, seq := splitTag(k)
+				if last, ok := seqs[name]; ok && last > seq {
+					continue
+				}
+				if v := s.qs.NameOf(ref); v != nil {
+					m[name], seqs[name] = v, seq
+				}
+			}
+			out.Paths = append(out.Paths, m)
+		default:
+			out.Emitted = append(out.Emitted, execValue(r.value()))
+		}
+	}
+	if err = it.Err(); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// execValue converts a value exported from JS to a Go value.
+func execValue(v interface{}) interface{} {
+	switch v := unwrap(v).(type) {
+	case *path.Path, *graphObject:
+		// paths that were not executed
+		return nil
+	default:
+		return v
+	}
+}
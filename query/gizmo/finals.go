@@ -15,26 +15,76 @@
 package gizmo
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
 	"github.com/dop251/goja"
 
+	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/refs"
+	"github.com/cayleygraph/cayley/query/path"
+	"github.com/cayleygraph/cayley/query/shape"
 	"github.com/cayleygraph/quad"
 )
 
+// TopResultTag is the default tag name used for the node at the end of the path.
+//
+// Note that it may collide with user-defined tags of the same name; see Session.WithResultTag.
 const TopResultTag = "id"
 
 // GetLimit is the same as All, but limited to the first N unique nodes at the end of the path, and each of their possible traversals.
+// The limit must not be negative; a zero limit returns no results.
 func (p *pathObject) GetLimit(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("getLimit: expected non-negative limit, got: %d", limit)
+	} else if limit == 0 {
+		return nil
+	}
+	return p.all(limit)
+}
+
+// all sends the results to the output, resetting the output limit of the session.
+// A zero limit means no limit.
+func (p *pathObject) all(limit int) error {
 	it := p.buildIteratorTree()
-	it = iterator.Tag(it, TopResultTag)
+	it = iterator.Tag(it, p.s.resultTag)
 	p.s.limit = limit
 	p.s.count = 0
 	return p.s.runIterator(it)
 }
 
 // All executes the query and adds the results, with all tags, as a string-to-string (tag to node) map in the output set, one for each path that a traversal could take.
-func (p *pathObject) All() error {
-	return p.GetLimit(p.s.limit)
+// Signature: ([limit])
+//
+// If the limit is set, only the first N nodes at the end of the path are returned, with each of their possible traversals.
+// A zero limit returns no results.
+//
+// Example:
+//	// javascript
+//	// alice and charlie, with their tags
+//	g.V("<bob>").tag("target").in("<follows>").all(2)
+func (p *pathObject) All(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) > 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	obj := p
+	if len(args) == 1 {
+		n, ok := toInt(args[0])
+		if !ok || n < 0 {
+			return throwErr(p.s.vm, fmt.Errorf("all: expected non-negative limit, got: %v", args[0]))
+		} else if n == 0 {
+			return goja.Undefined()
+		}
+		obj = p.new(p.clonePath().Limit(int64(n)))
+	}
+	if err := obj.all(p.s.limit); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return goja.Undefined()
 }
 
 func (p *pathObject) toArray(call goja.FunctionCall, withTags bool) goja.Value {
@@ -47,7 +97,7 @@ func (p *pathObject) toArray(call goja.FunctionCall, withTags bool) goja.Value {
 		limit, _ = toInt(args[0])
 	}
 	it := p.buildIteratorTree()
-	it = iterator.Tag(it, TopResultTag)
+	it = iterator.Tag(it, p.s.resultTag)
 	var (
 		array interface{}
 		err   error
@@ -73,6 +123,60 @@ func (p *pathObject) ToArray(call goja.FunctionCall) goja.Value {
 	return p.toArray(call, false)
 }
 
+func (p *pathObject) inoutValues(call goja.FunctionCall, in bool) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) == 0 || len(args) > 2 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	limit := -1
+	if len(args) > 1 {
+		var ok bool
+		if limit, ok = toInt(args[1]); !ok {
+			return throwErr(p.s.vm, fmt.Errorf("expected limit to be a number, got: %T", args[1]))
+		}
+	}
+	preds, _, _ := toViaData(args[:1])
+	if err := p.s.checkPredicates(preds); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	np := p.clonePath()
+	if in {
+		np = np.In(preds...)
+	} else {
+		np = np.Out(preds...)
+	}
+	it := p.new(np).buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+	array, err := p.s.runIteratorToArrayNoTags(it, limit)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return p.s.vm.ToValue(array)
+}
+
+// OutValues follows the predicate and returns objects as a JS array. It's a shorthand for out(predicate).toArray(limit).
+// Signature: (predicatePath, [limit])
+//
+// Example:
+// 	// javascript
+//	// emails contains an Array of all emails of alice.
+//	var emails = g.V("<alice>").outValues("<email>")
+func (p *pathObject) OutValues(call goja.FunctionCall) goja.Value {
+	return p.inoutValues(call, false)
+}
+
+// InValues is the same as OutValues, but follows the predicate in reverse direction and returns subjects.
+// It's a shorthand for in(predicate).toArray(limit).
+// Signature: (predicatePath, [limit])
+//
+// Example:
+// 	// javascript
+//	// followers contains an Array of followers of bob (alice, charlie, dani).
+//	var followers = g.V("<bob>").inValues("<follows>")
+func (p *pathObject) InValues(call goja.FunctionCall) goja.Value {
+	return p.inoutValues(call, true)
+}
+
 // TagArray is the same as ToArray, but instead of a list of top-level nodes, returns an Array of tag-to-string dictionaries, much as All would, except inside the JS environment.
 //
 // Example:
@@ -84,9 +188,99 @@ func (p *pathObject) ToArray(call goja.FunctionCall) goja.Value {
 func (p *pathObject) TagArray(call goja.FunctionCall) goja.Value {
 	return p.toArray(call, true)
 }
+
+// SelectTags is the same as TagArray, but results only contain the given tags and the node at the end of the path.
+// Tags that are not set for a result are returned as null.
+// Signature: (tag, [tag...])
+//
+// Example:
+// 	// javascript
+//	// [{"id": "<alice>", "target": "<bob>"}, ...] without the follower tag
+//	var rows = g.V("<bob>").tag("target").in("<follows>").tag("follower").selectTags("target")
+func (p *pathObject) SelectTags(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) == 0 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	tags := toStrings(args)
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+	rows, err := p.s.runIteratorToArray(it, -1)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	out := make([]interface{}, 0, len(rows))
+	for _, r := range rows {
+		m := make(map[string]interface{}, len(tags)+1)
+		m[p.s.resultTag] = r[p.s.resultTag]
+		for _, t := range tags {
+			m[t] = r[t]
+		}
+		out = append(out, m)
+	}
+	return p.s.vm.ToValue(out)
+}
+
+// DistinctBy is the same as TagArray, but only returns the first result for each distinct value of the tag.
+// Results without the tag are all returned.
+//
+// Unlike Unique, which removes duplicate nodes at the end of the path, it compares values of an arbitrary tag.
+//
+// Example:
+// 	// javascript
+//	// One follower for each followed person.
+//	var rows = g.V().tag("target").in("<follows>").distinctBy("target")
+func (p *pathObject) DistinctBy(tag string) (_ goja.Value, err error) {
+	if tag == "" {
+		return nil, errors.New("distinctBy: expected a tag name")
+	}
+	name := p.lastTag(tag)
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+
+	ctx, cancel := p.s.context()
+	defer cancel()
+
+	out := make([]map[string]interface{}, 0)
+	defer func(start time.Time) {
+		p.s.observe(it, start, len(out), err)
+	}(time.Now())
+	pool := make(valuePool)
+	seen := make(map[quad.Value]bool)
+	var gerr error
+	err = iterator.Iterate(ctx, it).TagEach(func(tags map[string]graph.Ref) {
+		if gerr != nil {
+			return
+		}
+		if r, ok := tags[name]; ok {
+			v := p.s.qs.NameOf(r)
+			if seen[v] {
+				return
+			}
+			seen[v] = true
+		}
+		tm := p.s.tagsToValueMap(tags, pool)
+		if tm == nil {
+			return
+		}
+		if gerr = p.s.checkMaxResults(len(out)); gerr != nil {
+			cancel()
+			return
+		}
+		out = append(out, tm)
+	})
+	err = p.s.queryErr(ctx, err)
+	if gerr != nil {
+		return nil, gerr
+	} else if err != nil {
+		return nil, err
+	}
+	return p.s.vm.ToValue(out), nil
+}
+
 func (p *pathObject) toValue(withTags bool) (interface{}, error) {
 	it := p.buildIteratorTree()
-	it = iterator.Tag(it, TopResultTag)
+	it = iterator.Tag(it, p.s.resultTag)
 	const limit = 1
 	if !withTags {
 		array, err := p.s.runIteratorToArrayNoTags(it, limit)
@@ -118,17 +312,170 @@ func (p *pathObject) TagValue() (interface{}, error) {
 	return p.toValue(true)
 }
 
+// ToValueTags is an alias for TagValue.
+func (p *pathObject) ToValueTags() (interface{}, error) {
+	return p.TagValue()
+}
+
+// ToObject executes a query and merges all results that describe a single entity into one object.
+// Signature: (idTag)
+//
+// Results must have the same value for the idTag; results without this tag are ignored.
+// Other tags are merged into the object: a tag with a single distinct value across all results
+// becomes a scalar, and a tag with multiple distinct values becomes an array of these values
+// in order of appearance. Thus, conflicting values are never dropped.
+// If results have different values for the idTag, an error is returned.
+// If there are no results, null is returned.
+//
+// Example:
+// 	// javascript
+//	// {"id":"<dani>", "status":"cool_person", "follows":["<bob>","<greg>"]}
+//	var dani = g.V("<dani>").tag("id").out("<follows>").tag("follows").
+//		back("id").out("<status>").tag("status").toObject("id")
+func (p *pathObject) ToObject(idTag string) (interface{}, error) {
+	if idTag == "" {
+		return nil, fmt.Errorf("toObject: expected a tag name")
+	}
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+
+	type field struct {
+		seen map[interface{}]struct{}
+		vals []graph.Ref
+	}
+	var (
+		id     graph.Ref
+		idKey  interface{}
+		fields = make(map[string]*field)
+		names  []string
+		gerr   error
+	)
+	ctx, cancel := p.s.context()
+	defer cancel()
+	n := 0
+	start := time.Now()
+	err := iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
+		if gerr != nil {
+			return
+		}
+		// with multi-tags, the same tag may have multiple values in one result
+		var rid graph.Ref
+		for k, v := range tags {
+			if name, _ := splitTag(k); name == idTag {
+				rid = v
+				break
+			}
+		}
+		if rid == nil {
+			return
+		}
+		if key := refs.ToKey(rid); id == nil {
+			id, idKey = rid, key
+		} else if key != idKey {
+			gerr = errMultipleEntities{Tag: idTag}
+			cancel()
+			return
+		}
+		n++
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		// keep values of multi-tags in order of assignment
+		sort.Slice(keys, func(i, j int) bool {
+			ni, si := splitTag(keys[i])
+			nj, sj := splitTag(keys[j])
+			if ni != nj {
+				return ni < nj
+			}
+			return si < sj
+		})
+		for _, k := range keys {
+			v := tags[k]
+			name, _ := splitTag(k)
+			if name == idTag {
+				continue
+			}
+			f := fields[name]
+			if f == nil {
+				f = &field{seen: make(map[interface{}]struct{})}
+				fields[name] = f
+				names = append(names, name)
+			}
+			key := refs.ToKey(v)
+			if _, ok := f.seen[key]; ok {
+				continue
+			}
+			f.seen[key] = struct{}{}
+			f.vals = append(f.vals, v)
+		}
+	})
+	err = p.s.queryErr(ctx, err)
+	if err == nil {
+		err = gerr
+	}
+	p.s.observe(it, start, n, err)
+	if err != nil {
+		return nil, err
+	} else if id == nil {
+		return nil, nil
+	}
+	pool := make(valuePool)
+	out := map[string]interface{}{
+		idTag: p.s.internValue(pool, p.s.qs.NameOf(id)),
+	}
+	for _, name := range names {
+		f := fields[name]
+		if len(f.vals) == 1 {
+			out[name] = p.s.internValue(pool, p.s.qs.NameOf(f.vals[0]))
+			continue
+		}
+		arr := make([]interface{}, 0, len(f.vals))
+		for _, v := range f.vals {
+			arr = append(arr, p.s.internValue(pool, p.s.qs.NameOf(v)))
+		}
+		out[name] = arr
+	}
+	return out, nil
+}
+
+// singleValue executes the path and returns its only result.
+// It returns an error if the path has no results or more than one distinct result.
+func (p *pathObject) singleValue() (quad.Value, error) {
+	it := p.new(p.path.Clone().Unique()).buildIteratorTree()
+	start := time.Now()
+	ctx, cancel := p.s.context()
+	defer cancel()
+	vals, err := iterator.Iterate(ctx, it).Paths(false).Limit(2).AllValues(p.s.qs)
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, len(vals), err)
+	if err != nil {
+		return nil, err
+	} else if len(vals) != 1 {
+		return nil, errNotSingleValue{Got: len(vals)}
+	}
+	return vals[0], nil
+}
+
 // Map is a alias for ForEach.
 func (p *pathObject) Map(call goja.FunctionCall) goja.Value {
 	return p.ForEach(call)
 }
 
+// ForEachTags is an alias for ForEach. The callback always receives a full tag map of the result,
+// including the node at the end of the path under the "id" tag.
+func (p *pathObject) ForEachTags(call goja.FunctionCall) goja.Value {
+	return p.ForEach(call)
+}
+
 // ForEach calls callback(data) for each result, where data is the tag-to-string map as in All case.
-// Signature: (callback) or (limit, callback)
+// Signature: (callback) or (limit, callback) or (limit, perNode, callback)
 //
 // Arguments:
 //
 // * `limit` (Optional): An integer value on the first `limit` paths to process.
+// * `perNode` (Optional): If set to true, `limit` counts distinct nodes at the end of the path instead of callback invocations.
+// A callback is then called for each path that leads to one of these nodes, thus it may be called more than `limit` times.
 // * `callback`: A javascript function of the form `function(data)`
 //
 // Example:
@@ -137,8 +484,8 @@ func (p *pathObject) Map(call goja.FunctionCall) goja.Value {
 //	graph.V("<alice>").ForEach(function(d) { g.Emit(d) } )
 func (p *pathObject) ForEach(call goja.FunctionCall) goja.Value {
 	it := p.buildIteratorTree()
-	it = iterator.Tag(it, TopResultTag)
-	if n := len(call.Arguments); n != 1 && n != 2 {
+	it = iterator.Tag(it, p.s.resultTag)
+	if n := len(call.Arguments); n < 1 || n > 3 {
 		return throwErr(p.s.vm, errArgCount{Got: len(call.Arguments)})
 	}
 	callback := call.Argument(len(call.Arguments) - 1)
@@ -147,7 +494,52 @@ func (p *pathObject) ForEach(call goja.FunctionCall) goja.Value {
 	if len(args) != 0 {
 		limit, _ = toInt(args[0])
 	}
-	err := p.s.runIteratorWithCallback(it, callback, call, limit)
+	perNode := false
+	if len(args) > 1 {
+		b, ok := args[1].(bool)
+		if !ok {
+			return throwErr(p.s.vm, fmt.Errorf("expected bool as second argument"))
+		}
+		perNode = b
+	}
+	err := p.s.runIteratorWithCallback(it, callback, call, limit, perNode, 0)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return goja.Null()
+}
+
+// ForEachBatch is the same as ForEach, but calls callback(batch) with an array of up to `size` results.
+// It is faster than ForEach for large result sets, since it calls JS code less often.
+// Signature: (size, callback) or (limit, size, callback)
+//
+// Arguments:
+//
+// * `limit` (Optional): An integer value on the first `limit` paths to process.
+// * `size`: A maximal number of results in one batch.
+// * `callback`: A javascript function of the form `function(batch)`
+//
+// Example:
+// 	// javascript
+//	graph.V().forEachBatch(100, function(batch) { g.emit(batch.length) })
+func (p *pathObject) ForEachBatch(call goja.FunctionCall) goja.Value {
+	if n := len(call.Arguments); n < 2 || n > 3 {
+		return throwErr(p.s.vm, errArgCount{Got: len(call.Arguments)})
+	}
+	callback := call.Argument(len(call.Arguments) - 1)
+	args := exportArgs(call.Arguments[:len(call.Arguments)-1])
+	limit := -1
+	if len(args) > 1 {
+		limit, _ = toInt(args[0])
+		args = args[1:]
+	}
+	size, ok := toInt(args[0])
+	if !ok || size <= 0 {
+		return throwErr(p.s.vm, fmt.Errorf("expected positive batch size, got: %v", args[0]))
+	}
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+	err := p.s.runIteratorWithCallback(it, callback, call, limit, false, size)
 	if err != nil {
 		return throwErr(p.s.vm, err)
 	}
@@ -167,12 +559,557 @@ func (p *pathObject) Count() (int64, error) {
 	return p.s.countResults(it)
 }
 
+// Paginate executes the query and returns a page of results together with the total number of results.
+// Signature: (offset, limit)
+//
+// Results are tag-to-string maps, as in TagArray; the total is counted the same way as with Count.
+// The query runs only once: results before the offset and after the page are only counted.
+// If the offset is larger than the number of results, the page is empty.
+//
+// Example:
+//	// javascript
+//	// bob has three followers; returns {"total": 3, "results": [...]} with the last two of them
+//	var page = g.V("<bob>").in("<follows>").paginate(1, 2)
+func (p *pathObject) Paginate(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	offset, ok1 := toInt(args[0])
+	limit, ok2 := toInt(args[1])
+	if !ok1 || !ok2 || offset < 0 || limit < 0 {
+		return throwErr(p.s.vm, fmt.Errorf("paginate: expected non-negative offset and limit, got: %v, %v", args[0], args[1]))
+	}
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+	start := time.Now()
+	var total int64
+	results := make([]map[string]interface{}, 0)
+	pool := make(valuePool)
+	ctx, cancel := p.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
+		total++
+		if total <= int64(offset) || len(results) >= limit {
+			return
+		}
+		if tm := p.s.tagsToValueMap(tags, pool); tm != nil {
+			results = append(results, tm)
+		}
+	})
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, len(results), err)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return p.s.vm.ToValue(map[string]interface{}{
+		"total":   total,
+		"results": results,
+	})
+}
+
+// CountBy counts results grouped by the value of a given tag, and returns an object that maps each value to a count.
+// Results are counted the same way as with Count. Results without the tag are not counted.
+// Values are keyed by their string representation, thus string values are quoted and IRIs are in angle brackets.
+// Signature: (tag)
+//
+// Example:
+//	// javascript
+//	// number of nodes with each status: {"\"cool_person\"": 3, "\"smart_person\"": 2}
+//	var n = g.V().out("<status>").countBy("id")
+func (p *pathObject) CountBy(tag string) (map[string]int64, error) {
+	if tag == "" {
+		return nil, fmt.Errorf("countBy: expected a tag name")
+	}
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+	if tag != p.s.resultTag {
+		tag = p.lastTag(tag)
+	}
+	start := time.Now()
+	out := make(map[string]int64)
+	ctx, cancel := p.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
+		v, ok := tags[tag]
+		if !ok {
+			return
+		}
+		out[quad.StringOf(p.s.qs.NameOf(v))]++
+	})
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, len(out), err)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GroupCount counts results grouped by the value of a given tag, and returns an array of {id, count} objects,
+// ordered by count, starting from the largest group. Groups of the same size are ordered by value, the same way as with Order.
+// Results are counted the same way as with Count. Results without the tag are counted in a group with a null id.
+// Signature: (tag)
+//
+// Unlike CountBy, values are returned as is, thus it's more convenient for rendering histograms.
+//
+// Example:
+//	// javascript
+//	// [{"id": "cool_person", "count": 3}, {"id": "smart_person", "count": 2}]
+//	var hist = g.V().out("<status>").groupCount("id")
+func (p *pathObject) GroupCount(tag string) ([]interface{}, error) {
+	if tag == "" {
+		return nil, fmt.Errorf("groupCount: expected a tag name")
+	}
+	it := p.buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+	if tag != p.s.resultTag {
+		tag = p.lastTag(tag)
+	}
+	start := time.Now()
+	counts := make(map[quad.Value]int64)
+	ctx, cancel := p.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
+		var v quad.Value
+		if r, ok := tags[tag]; ok {
+			v = p.s.qs.NameOf(r)
+		}
+		counts[v]++
+	})
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, len(counts), err)
+	if err != nil {
+		return nil, err
+	}
+	type group struct {
+		val quad.Value
+		n   int64
+	}
+	groups := make([]group, 0, len(counts))
+	for v, n := range counts {
+		groups = append(groups, group{val: v, n: n})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].n != groups[j].n {
+			return groups[i].n > groups[j].n
+		}
+		return iterator.CompareValues(groups[i].val, groups[j].val) < 0
+	})
+	out := make([]interface{}, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, map[string]interface{}{
+			"id":    p.s.quadValueToJS(g.val),
+			"count": g.n,
+		})
+	}
+	return out, nil
+}
+
+// Sum returns a sum of all numeric values at the end of the path. Results are counted the same way as with Count.
+// Numeric typed strings are converted to numbers; any other non-numeric value is an error.
+// The sum is an integer, unless at least one of the values is a float.
+//
+// Example:
+//	// javascript
+//	var total = g.V("<order1>").out("<lineItemPrice>").sum()
+func (p *pathObject) Sum() (interface{}, error) {
+	it := p.buildIteratorTree()
+	start := time.Now()
+	var (
+		isum  int64
+		fsum  float64
+		float bool
+		n     int
+		gerr  error
+	)
+	ctx, cancel := p.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, it).Paths(true).Each(func(r graph.Ref) {
+		if gerr != nil {
+			return
+		}
+		v := p.s.qs.NameOf(r)
+		if ts, ok := v.(quad.TypedString); ok {
+			if pv, err := ts.ParseValue(); err == nil {
+				v = pv
+			}
+		}
+		switch v := v.(type) {
+		case quad.Int:
+			isum += int64(v)
+		case quad.Float:
+			fsum += float64(v)
+			float = true
+		default:
+			gerr = errNotNumeric{Val: v}
+			cancel()
+			return
+		}
+		n++
+	})
+	err = p.s.queryErr(ctx, err)
+	if err == nil {
+		err = gerr
+	}
+	p.s.observe(it, start, n, err)
+	if err != nil {
+		return nil, err
+	}
+	if float {
+		return fsum + float64(isum), nil
+	}
+	return isum, nil
+}
+
+// extremum returns the smallest or the largest value at the end of the path, or nil if there are no results.
+func (p *pathObject) extremum(max bool) (interface{}, error) {
+	it := p.buildIteratorTree()
+	start := time.Now()
+	var (
+		best quad.Value
+		n    int
+	)
+	ctx, cancel := p.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, it).Paths(false).EachValue(p.s.qs, func(v quad.Value) {
+		if v == nil {
+			return
+		}
+		n++
+		if best == nil {
+			best = v
+			return
+		}
+		c := iterator.CompareValues(v, best)
+		if (max && c > 0) || (!max && c < 0) {
+			best = v
+		}
+	})
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, n, err)
+	if err != nil {
+		return nil, err
+	} else if best == nil {
+		return nil, nil
+	}
+	return p.s.quadValueToJS(best), nil
+}
+
+// Min returns the smallest value at the end of the path, or null if there are no results.
+// Values are compared the same way as with Order, thus numbers, strings and times are compared naturally.
+//
+// Example:
+//	// javascript
+//	var youngest = g.V().out("<age>").min()
+func (p *pathObject) Min() (interface{}, error) {
+	return p.extremum(false)
+}
+
+// Max returns the largest value at the end of the path, or null if there are no results.
+// Values are compared the same way as with Order, thus numbers, strings and times are compared naturally.
+//
+// Example:
+//	// javascript
+//	var oldest = g.V().has("<age>").out("<age>").max()
+func (p *pathObject) Max() (interface{}, error) {
+	return p.extremum(true)
+}
+
+// CountWindow counts results in a window of the result set, for example to render a page in a paginated list.
+// It returns an object with the number of results in the window (count) and a flag (hasMore)
+// that is set if there are more results after the window.
+// Signature: (offset, limit)
+//
+// Unlike Count, it never reads more than offset + limit + 1 results.
+// Results are counted as nodes, the same way skip() and limit() do, so alternative tag paths for a node are not counted.
+//
+// Example:
+//	// javascript
+//	// results 11-20 and a flag for the next page
+//	var w = g.V().countWindow(10, 10)
+//	g.emit(w.count + (w.hasMore ? "+" : ""))
+func (p *pathObject) CountWindow(offset, limit int) (map[string]interface{}, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("countWindow: expected non-negative offset and limit, got: %d, %d", offset, limit)
+	}
+	np := p.clonePath()
+	if offset > 0 {
+		np = np.Skip(int64(offset))
+	}
+	// peek one result past the window to check if there are more results
+	np = np.Limit(int64(limit) + 1)
+	it := p.new(np).buildIteratorTree()
+
+	// results are counted by scanning, since size estimations for the window may be inaccurate
+	start := time.Now()
+	var n int64
+	ctx, cancel := p.s.context()
+	defer cancel()
+	err := iterator.Iterate(ctx, it).Paths(false).Each(func(graph.Ref) {
+		n++
+	})
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, int(n), err)
+	if err != nil {
+		return nil, err
+	}
+	more := n > int64(limit)
+	if more {
+		n = int64(limit)
+	}
+	return map[string]interface{}{
+		"count":   n,
+		"hasMore": more,
+	}, nil
+}
+
+// CountAtLeast checks if the query returns at least N results. Results are counted the same way as with Count.
+// Signature: (n)
+//
+// Unlike Count, it stops reading results as soon as N results are found,
+// thus it's much cheaper than count() >= n for large result sets.
+//
+// Example:
+//	// javascript
+//	if (g.V().has("<follows>").countAtLeast(1000)) {
+//		g.emit("popular")
+//	}
+func (p *pathObject) CountAtLeast(n int) (bool, error) {
+	if n <= 0 {
+		return true, nil
+	}
+	cnt, err := p.countUpTo(n)
+	if err != nil {
+		return false, err
+	}
+	return cnt >= n, nil
+}
+
+// countUpTo counts results the same way as Count, but stops as soon as n results are found.
+func (p *pathObject) countUpTo(n int) (int, error) {
+	it := p.buildIteratorTree()
+	ctx, cancel := p.s.context()
+	defer cancel()
+	start := time.Now()
+	var cnt int
+	err := iterator.Iterate(ctx, it).Paths(true).Limit(n).Each(func(graph.Ref) {
+		cnt++
+	})
+	if err == nil && cnt < n {
+		// iteration stops silently on cancellation
+		err = ctx.Err()
+	}
+	err = p.s.queryErr(ctx, err)
+	p.s.observe(it, start, cnt, err)
+	if err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
+// CountUpTo is the same as Count, but stops counting as soon as N results are found.
+// It returns the number of results, or N if there are more results than that.
+// Signature: (n)
+//
+// It's useful when only a lower bound of the count matters, since it never reads more than N results.
+//
+// Example:
+//	// javascript
+//	// shows "999+" if there are too many results
+//	var n = g.V().countUpTo(1000)
+//	g.emit(n < 1000 ? n : "999+")
+func (p *pathObject) CountUpTo(n int) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("countUpTo: expected non-negative limit, got: %d", n)
+	} else if n == 0 {
+		return 0, nil
+	}
+	return p.countUpTo(n)
+}
+
+// HasAny checks if the query returns any results. It stops as soon as the first result is found,
+// thus it's much cheaper than count() > 0.
+//
+// Example:
+//	// javascript
+//	if (g.V("<alice>").out("<follows>").hasAny()) {
+//		g.emit("alice follows someone")
+//	}
+func (p *pathObject) HasAny() (bool, error) {
+	it := p.buildIteratorTree()
+	ctx, cancel := p.s.context()
+	defer cancel()
+	start := time.Now()
+	sc := it.Iterate()
+	ok := sc.Next(ctx)
+	err := sc.Err()
+	if cerr := sc.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !ok {
+		// iteration stops silently on cancellation
+		err = ctx.Err()
+	}
+	err = p.s.queryErr(ctx, err)
+	n := 0
+	if ok {
+		n = 1
+	}
+	p.s.observe(it, start, n, err)
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// pathPredicates returns all predicate values referenced by the path.
+//
+// Only predicates that are specified as values are returned. Predicates that are given by a sub-path
+// or are referenced inside a recursive follow are not included.
+func pathPredicates(p *path.Path) []quad.Value {
+	var (
+		out  []quad.Value
+		seen = make(map[quad.Value]struct{})
+	)
+	shape.Walk(p.Shape(), func(s shape.Shape) bool {
+		quads, ok := s.(shape.Quads)
+		if !ok {
+			return true
+		}
+		for _, f := range quads {
+			if f.Dir != quad.Predicate {
+				continue
+			}
+			vals, ok := f.Values.(shape.Lookup)
+			if !ok {
+				continue
+			}
+			for _, v := range vals {
+				if _, ok := seen[v]; !ok {
+					seen[v] = struct{}{}
+					out = append(out, v)
+				}
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// unknownPredicates returns all values from the list that are not used as predicates in the graph.
+func (s *Session) unknownPredicates(preds []quad.Value) ([]quad.Value, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	var out []quad.Value
+	for _, v := range preds {
+		ref := s.qs.ValueOf(v)
+		if ref == nil {
+			out = append(out, v)
+			continue
+		}
+		first, err := iterator.Iterate(ctx, s.qs.QuadIterator(quad.Predicate, ref)).First()
+		if err = s.queryErr(ctx, err); err != nil {
+			return nil, err
+		} else if first == nil {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// Validate checks that all predicates referenced by the path are present in the graph, and returns a sorted list of unknown predicates.
+// It's useful to catch typos in predicate names of saved morphisms, since they will silently produce empty results otherwise.
+//
+// Validation only checks predicates that are given as values. Predicates given as paths and predicates referenced
+// inside a recursive follow are not checked.
+//
+// Example:
+//	// javascript
+//	var friend = g.M().out("<follws>")
+//	// returns ["<follws>"]
+//	friend.validate()
+func (p *pathObject) Validate() ([]interface{}, error) {
+	unknown, err := p.s.unknownPredicates(pathPredicates(p.path))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].String() < unknown[j].String()
+	})
+	out := make([]interface{}, 0, len(unknown))
+	for _, v := range unknown {
+		out = append(out, p.s.quadValueToNative(v))
+	}
+	return out, nil
+}
+
+// defaultProgressInterval is a default number of results between progress reports of CountProgress.
+const defaultProgressInterval = 1000
+
+// CountProgress is the same as Count, but calls a callback with a running count every N results.
+// Signature: (callback, [everyN])
+//
+// Arguments:
+//
+// * `callback`: A javascript function of the form `function(count)`.
+// * `everyN` (Optional): A positive number of results between calls to the callback. Default is 1000.
+//
+// Example:
+//	// javascript
+//	var n = g.V().countProgress(function(n) { g.emit("counted: " + n) }, 100)
+func (p *pathObject) CountProgress(call goja.FunctionCall) goja.Value {
+	if n := len(call.Arguments); n != 1 && n != 2 {
+		return throwErr(p.s.vm, errArgCount{Got: n})
+	}
+	fnc, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("expected js callback function"))
+	}
+	every := defaultProgressInterval
+	if len(call.Arguments) > 1 {
+		every, ok = toInt(call.Argument(1).Export())
+		if !ok || every <= 0 {
+			return throwErr(p.s.vm, fmt.Errorf("expected positive progress interval, got: %v", call.Argument(1)))
+		}
+	}
+	it := p.buildIteratorTree()
+
+	ctx, cancel := p.s.context()
+	defer cancel()
+	start := time.Now()
+	var (
+		cnt  int64
+		gerr error
+	)
+	err := iterator.Iterate(ctx, it).Paths(true).Each(func(graph.Ref) {
+		if gerr != nil {
+			return
+		}
+		cnt++
+		if cnt%int64(every) == 0 {
+			if _, err := fnc(call.This, p.s.vm.ToValue(cnt)); err != nil {
+				gerr = err
+				cancel()
+			}
+		}
+	})
+	err = p.s.queryErr(ctx, err)
+	if gerr != nil {
+		err = gerr
+	}
+	p.s.observe(it, start, int(cnt), err)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return p.s.vm.ToValue(cnt)
+}
+
 // Backwards compatibility
 func (p *pathObject) CapitalizedGetLimit(limit int) error {
 	return p.GetLimit(limit)
 }
-func (p *pathObject) CapitalizedAll() error {
-	return p.All()
+func (p *pathObject) CapitalizedAll(call goja.FunctionCall) goja.Value {
+	return p.All(call)
 }
 func (p *pathObject) CapitalizedtoArray(call goja.FunctionCall, withTags bool) goja.Value {
 	return p.toArray(call, withTags)
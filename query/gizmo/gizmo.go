@@ -18,17 +18,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net/url"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/dop251/goja"
 
+	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/refs"
 	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/query/path"
 	"github.com/cayleygraph/cayley/schema"
 	"github.com/cayleygraph/quad"
 	"github.com/cayleygraph/quad/jsonld"
@@ -46,11 +53,21 @@ func init() {
 	})
 }
 
+// DefaultMaxPathDepth is the default limit on the number of steps in a single path. See WithMaxPathDepth.
+const DefaultMaxPathDepth = 10000
+
 func NewSession(qs graph.QuadStore) *Session {
 	s := &Session{
 		ctx: context.Background(),
 		sch: schema.NewConfig(),
 		qs:  qs, limit: -1,
+
+		resultTag: TopResultTag,
+		metrics:   nopMetrics{},
+		morphisms: NewMorphismRegistry(),
+
+		maxPathDepth: DefaultMaxPathDepth,
+		clock:        time.Now,
 	}
 	if err := s.buildEnv(); err != nil {
 		panic(err)
@@ -63,7 +80,10 @@ func lcFirst(str string) string {
 	return string(unicode.ToLower(rune)) + str[size:]
 }
 
-type fieldNameMapper struct{}
+type fieldNameMapper struct {
+	snakeCase    bool // expose snake_case aliases; see WithSnakeCaseAliases
+	constructors bool // expose constructor aliases; see WithConstructorAliases
+}
 
 func (fieldNameMapper) FieldName(t reflect.Type, f reflect.StructField) string {
 	return lcFirst(f.Name)
@@ -71,8 +91,22 @@ func (fieldNameMapper) FieldName(t reflect.Type, f reflect.StructField) string {
 
 const constructMethodPrefix = "New"
 const backwardsCompatibilityPrefix = "Capitalized"
+const snakeCaseAliasPrefix = "Snake"
+const constructorAliasPrefix = "Alias"
 
-func (fieldNameMapper) MethodName(t reflect.Type, m reflect.Method) string {
+func (fm fieldNameMapper) MethodName(t reflect.Type, m reflect.Method) string {
+	if strings.HasPrefix(m.Name, snakeCaseAliasPrefix) {
+		if !fm.snakeCase {
+			return ""
+		}
+		return snakeCase(lcFirst(strings.TrimPrefix(m.Name, snakeCaseAliasPrefix)))
+	}
+	if strings.HasPrefix(m.Name, constructorAliasPrefix) {
+		if !fm.constructors {
+			return ""
+		}
+		return lcFirst(strings.TrimPrefix(m.Name, constructorAliasPrefix))
+	}
 	if strings.HasPrefix(m.Name, backwardsCompatibilityPrefix) {
 		return strings.TrimPrefix(m.Name, backwardsCompatibilityPrefix)
 	}
@@ -83,25 +117,98 @@ func (fieldNameMapper) MethodName(t reflect.Type, m reflect.Method) string {
 }
 
 type Session struct {
-	qs  graph.QuadStore
-	vm  *goja.Runtime
-	ns  voc.Namespaces
-	sch *schema.Config
-	col query.Collation
+	qs    graph.QuadStore
+	vm    *goja.Runtime
+	names fieldNameMapper
+	ns    voc.Namespaces
+	sch   *schema.Config
+	col   query.Collation
 
 	last string
 	p    *goja.Program
 
-	out   chan *Result
-	ctx   context.Context
-	limit int
-	count int
+	out    chan *Result
+	ctx    context.Context
+	parent context.Context
+	limit  int
+	count  int
+
+	mu     sync.Mutex
+	cancel func()
 
 	err error
+
+	resultTag string
+	metrics   Metrics
+	typed     bool
+
+	base        *url.URL
+	resolveIRIs bool
+	strictPreds bool
+	validLang   bool
+	ignoreCase  bool
+
+	scopedBNodes bool
+	bnodes       map[string]quad.BNode
+
+	multiTags bool
+	tagSeq    int
+
+	emitSeq int // Emit is only called from the script, thus results are numbered in order they are sent
+
+	morphisms *MorphismRegistry
+
+	materialized *path.MaterializeCache // results of materialized paths, reset for each query
+
+	maxPathDepth  int
+	slowQuery     time.Duration
+	queryTimeout  time.Duration
+	scriptTimeout time.Duration
+
+	maxResults int
+
+	maxSteps int64
+	steps    int64
+	stepFunc string
+	evalOrig *evalFuncs
+
+	rnd   *rand.Rand
+	clock func() time.Time
+
+	softErrors bool
+	softErrs   []error
+
+	truncated bool
 }
 
-func (s *Session) context() context.Context {
-	return s.ctx
+// context returns a context for a single query final. If the query timeout is set, the context expires after it.
+// The context must be released with the cancel function when the final is done.
+func (s *Session) context() (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(s.ctx)
+	}
+	return context.WithTimeout(s.ctx, s.queryTimeout)
+}
+
+// queryErr returns a timeout error if the final was stopped by the query timeout.
+// Iterators stop silently when the context is done, thus each final must check the error with it.
+func (s *Session) queryErr(ctx context.Context, err error) error {
+	if err != nil && err != context.DeadlineExceeded {
+		return err
+	}
+	if s.queryTimeout > 0 && ctx.Err() == context.DeadlineExceeded && s.ctx.Err() == nil {
+		return errQueryTimeout{Timeout: s.queryTimeout}
+	}
+	return err
+}
+
+// setNames changes names of Go methods in JS. Names of existing objects cannot be changed,
+// thus the graph object is created again.
+func (s *Session) setNames(names fieldNameMapper) {
+	s.names = names
+	s.vm.SetFieldNameMapper(names)
+	s.vm.Set("graph", &graphObject{s: s})
+	s.vm.Set("g", s.vm.Get("graph"))
 }
 
 func (s *Session) buildEnv() error {
@@ -109,15 +216,23 @@ func (s *Session) buildEnv() error {
 		return nil
 	}
 	s.vm = goja.New()
-	s.vm.SetFieldNameMapper(fieldNameMapper{})
-	s.vm.Set("graph", &graphObject{s: s})
-	s.vm.Set("g", s.vm.Get("graph"))
+	s.setNames(s.names)
 	for name, val := range defaultEnv {
 		fnc := val
 		s.vm.Set(name, func(call goja.FunctionCall) goja.Value {
 			return fnc(s.vm, call)
 		})
 	}
+	s.vm.Set("lang", s.langString)
+	s.vm.Set("bnode", s.blankNode)
+	s.vm.Set("now", s.now)
+	s.vm.Set("curie", s.curie)
+	s.vm.Set("lt", s.cmpOp(iterator.CompareLT))
+	s.vm.Set("lte", s.cmpOp(iterator.CompareLTE))
+	s.vm.Set("gt", s.cmpOp(iterator.CompareGT))
+	s.vm.Set("gte", s.cmpOp(iterator.CompareGTE))
+	s.vm.Set("regex", s.cmpRegexp)
+	s.vm.Set("like", s.cmpWildcard)
 	return nil
 }
 
@@ -135,70 +250,303 @@ func (s *Session) quadValueToNative(v quad.Value) interface{} {
 	return out
 }
 
-func (s *Session) tagsToValueMap(m map[string]graph.Ref) map[string]interface{} {
+// checkPredicates returns an error if strict predicates mode is enabled and any of values is not a known predicate.
+func (s *Session) checkPredicates(via []interface{}) error {
+	if !s.strictPreds {
+		return nil
+	}
+	var preds []quad.Value
+	for _, v := range via {
+		if qv, ok := v.(quad.Value); ok {
+			preds = append(preds, qv)
+		}
+	}
+	unknown, err := s.unknownPredicates(preds)
+	if err != nil {
+		return err
+	} else if len(unknown) != 0 {
+		return errUnknownPredicate{Preds: unknown}
+	}
+	return nil
+}
+
+// resolveValues resolves relative IRIs against the session base, if enabled.
+func (s *Session) resolveValues(vals []quad.Value) []quad.Value {
+	if !s.resolveIRIs || s.base == nil {
+		return vals
+	}
+	for i, v := range vals {
+		iri, ok := v.(quad.IRI)
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(string(iri))
+		if err != nil || u.IsAbs() {
+			continue
+		}
+		vals[i] = quad.IRI(s.base.ResolveReference(u).String())
+	}
+	return vals
+}
+
+// quadValueToJS converts a value to a form that will be passed to JS.
+// It either returns a native value, or a value object, if typed results are enabled.
+func (s *Session) quadValueToJS(v quad.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	if s.typed {
+		return &valueObject{s: s, v: v}
+	}
+	return s.quadValueToNative(v)
+}
+
+// valuePool interns JS representations of values, thus equal values in the result set will share the memory.
+// Pools should be scoped to a single query to avoid unbounded growth.
+type valuePool map[quad.Value]interface{}
+
+// internValue is the same as quadValueToJS, but uses the pool to reuse values. Pool can be nil.
+func (s *Session) internValue(pool valuePool, v quad.Value) interface{} {
+	if pool == nil || v == nil {
+		return s.quadValueToJS(v)
+	}
+	if o, ok := pool[v]; ok {
+		return o
+	}
+	o := s.quadValueToJS(v)
+	pool[v] = o
+	return o
+}
+
+func (s *Session) tagsToValueMap(m map[string]graph.Ref, pool valuePool) map[string]interface{} {
 	outputMap := make(map[string]interface{})
 	for k, v := range m {
-		if o := s.quadValueToNative(s.qs.NameOf(v)); o != nil {
+		if o := s.internValue(pool, s.qs.NameOf(v)); o != nil {
 			outputMap[k] = o
 		}
 	}
 	if len(outputMap) == 0 {
 		return nil
 	}
+	if s.multiTags {
+		outputMap = groupTags(outputMap)
+	}
 	return outputMap
 }
-func (s *Session) runIteratorToArray(it iterator.Shape, limit int) ([]map[string]interface{}, error) {
-	ctx := s.context()
+
+// setTruncated is called when results of a recursive follow are truncated. See Truncated.
+func (s *Session) setTruncated() {
+	s.mu.Lock()
+	s.truncated = true
+	s.mu.Unlock()
+}
+
+// random returns a source of randomness for the session. See WithSeed.
+func (s *Session) random() *rand.Rand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rnd == nil {
+		s.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s.rnd
+}
+
+// slowQueryMaxLen is the maximal length of the query text written to the slow query log.
+const slowQueryMaxLen = 512
+
+// observe reports the query execution to the metrics collector.
+func (s *Session) observe(it iterator.Shape, start time.Time, results int, err error) {
+	dt := time.Since(start)
+	s.metrics.ObserveQuery(dt, results, err)
+	if s.slowQuery > 0 && dt >= s.slowQuery {
+		s.logSlowQuery(it, dt, results)
+	}
+}
+
+// logSlowQuery writes the query that took longer than the threshold to the log. See WithSlowQueryLog.
+func (s *Session) logSlowQuery(it iterator.Shape, dt time.Duration, results int) {
+	qu := s.last
+	if len(qu) > slowQueryMaxLen {
+		// cut on a rune boundary to keep the log valid UTF-8
+		n := slowQueryMaxLen
+		for n > 0 && !utf8.RuneStart(qu[n]) {
+			n--
+		}
+		qu = qu[:n] + "..."
+	}
+	clog.Warningf("gizmo: slow query (%v, %d results): %s", dt, results, qu)
+	if clog.V(2) && it != nil {
+		clog.Infof("gizmo: slow query iterator: %s", it.String())
+	}
+}
+
+func (s *Session) runIteratorToArray(it iterator.Shape, limit int) (_ []map[string]interface{}, err error) {
+	ctx, cancel := s.context()
+	defer cancel()
 
 	output := make([]map[string]interface{}, 0)
-	err := iterator.Iterate(ctx, it).Limit(limit).TagEach(func(tags map[string]graph.Ref) {
-		tm := s.tagsToValueMap(tags)
+	defer func(start time.Time) {
+		s.observe(it, start, len(output), err)
+	}(time.Now())
+	pool := make(valuePool)
+	var gerr error
+	err = iterator.Iterate(ctx, it).Limit(limit).TagEach(func(tags map[string]graph.Ref) {
+		if gerr != nil {
+			return
+		}
+		tm := s.tagsToValueMap(tags, pool)
 		if tm == nil {
 			return
 		}
+		if gerr = s.checkMaxResults(len(output)); gerr != nil {
+			cancel()
+			return
+		}
 		output = append(output, tm)
 	})
-	if err != nil {
+	err = s.queryErr(ctx, err)
+	if gerr != nil {
+		return nil, gerr
+	} else if err != nil {
 		return nil, err
 	}
 	return output, nil
 }
 
-func (s *Session) runIteratorToArrayNoTags(it iterator.Shape, limit int) ([]interface{}, error) {
-	ctx := s.context()
+// checkMaxResults returns an error if an array with n results cannot be extended. See WithMaxResults.
+func (s *Session) checkMaxResults(n int) error {
+	if s.maxResults > 0 && n >= s.maxResults {
+		return errTooManyResults{Max: s.maxResults}
+	}
+	return nil
+}
+
+func (s *Session) runIteratorToArrayNoTags(it iterator.Shape, limit int) (_ []interface{}, err error) {
+	ctx, cancel := s.context()
+	defer cancel()
 
 	output := make([]interface{}, 0)
-	err := iterator.Iterate(ctx, it).Paths(false).Limit(limit).EachValue(s.qs, func(v quad.Value) {
-		if o := s.quadValueToNative(v); o != nil {
-			output = append(output, o)
+	defer func(start time.Time) {
+		s.observe(it, start, len(output), err)
+	}(time.Now())
+	pool := make(valuePool)
+	var gerr error
+	err = iterator.Iterate(ctx, it).Paths(false).Limit(limit).EachValue(s.qs, func(v quad.Value) {
+		if gerr != nil {
+			return
 		}
+		o := s.internValue(pool, v)
+		if o == nil {
+			return
+		}
+		if gerr = s.checkMaxResults(len(output)); gerr != nil {
+			cancel()
+			return
+		}
+		output = append(output, o)
 	})
-	if err != nil {
+	err = s.queryErr(ctx, err)
+	if gerr != nil {
+		return nil, gerr
+	} else if err != nil {
 		return nil, err
 	}
 	return output, nil
 }
 
-func (s *Session) runIteratorWithCallback(it iterator.Shape, callback goja.Value, this goja.FunctionCall, limit int) error {
+// runIteratorWithCallback calls a JS callback for each path of the iterator.
+//
+// If perNode is set, limit bounds the number of distinct nodes at the end of the path,
+// and the callback is called for each path leading to these nodes until a path to a new node is encountered.
+// Otherwise, limit bounds the number of callback invocations.
+//
+// If batch is positive, results are accumulated and the callback is called with an array of up to batch results,
+// which reduces the number of calls to JS. The limit still bounds the number of results, not the number of calls.
+func (s *Session) runIteratorWithCallback(it iterator.Shape, callback goja.Value, this goja.FunctionCall, limit int, perNode bool, batch int) (err error) {
 	fnc, ok := goja.AssertFunction(callback)
 	if !ok {
 		return fmt.Errorf("expected js callback function")
 	}
-	ctx, cancel := context.WithCancel(s.context())
+	ctx, cancel := s.context()
 	defer cancel()
-	var gerr error
-	err := iterator.Iterate(ctx, it).Paths(true).Limit(limit).TagEach(func(tags map[string]graph.Ref) {
-		tm := s.tagsToValueMap(tags)
+	n := 0
+	defer func(start time.Time) {
+		s.observe(it, start, n, err)
+	}(time.Now())
+	var seen map[interface{}]struct{}
+	if perNode {
+		seen = make(map[interface{}]struct{})
+	}
+	var (
+		gerr error
+		stop = limit == 0
+		buf  []interface{}
+	)
+	if stop {
+		return nil
+	}
+	call := func(v interface{}) bool {
+		if _, err := fnc(this.This, s.vm.ToValue(v)); err != nil {
+			gerr = err
+			stop = true
+			cancel()
+			return false
+		}
+		return true
+	}
+	flush := func() bool {
+		if len(buf) == 0 {
+			return true
+		}
+		out := buf
+		buf = make([]interface{}, 0, batch)
+		return call(out)
+	}
+	if batch > 0 {
+		buf = make([]interface{}, 0, batch)
+	}
+	err = iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
+		if stop {
+			return
+		}
+		if perNode {
+			key := refs.ToKey(tags[s.resultTag])
+			if _, ok := seen[key]; !ok {
+				if limit > 0 && len(seen) >= limit {
+					stop = true
+					cancel()
+					return
+				}
+				seen[key] = struct{}{}
+			}
+		}
+		tm := s.tagsToValueMap(tags, nil)
 		if tm == nil {
 			return
 		}
-		if _, err := fnc(this.This, s.vm.ToValue(tm)); err != nil {
-			gerr = err
+		n++
+		if batch > 0 {
+			buf = append(buf, tm)
+			if len(buf) >= batch && !flush() {
+				return
+			}
+		} else if !call(tm) {
+			return
+		}
+		if !perNode && limit > 0 && n >= limit {
+			stop = true
 			cancel()
 		}
 	})
+	err = s.queryErr(ctx, err)
+	if gerr == nil && (err == nil || stop) {
+		flush()
+	}
 	if gerr != nil {
-		err = gerr
+		return gerr
+	} else if stop {
+		// iteration was cancelled by us
+		return nil
 	}
 	return err
 }
@@ -222,30 +570,73 @@ func (s *Session) send(ctx context.Context, r *Result) bool {
 	return s.limit <= 0 || s.count < s.limit
 }
 
-func (s *Session) runIterator(it iterator.Shape) error {
-	ctx, cancel := context.WithCancel(s.context())
+// nextEmitSeq returns a sequence number for the next value added with Emit.
+func (s *Session) nextEmitSeq() int {
+	s.emitSeq++
+	return s.emitSeq
+}
+
+func (s *Session) runIterator(it iterator.Shape) (err error) {
+	ctx, cancel := s.context()
 	defer cancel()
+	n := 0
+	defer func(start time.Time) {
+		s.observe(it, start, n, err)
+	}(time.Now())
 	stop := false
-	err := iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
+	err = iterator.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Ref) {
 		if !s.send(ctx, &Result{Tags: tags}) {
 			cancel()
 			stop = true
+			return
 		}
+		n++
 	})
 	if stop {
 		err = nil
 	}
-	return err
+	return s.queryErr(ctx, err)
 }
 
 func (s *Session) countResults(it iterator.Shape) (int64, error) {
-	return iterator.Iterate(s.context(), it).Paths(true).Count()
+	start := time.Now()
+	ctx, cancel := s.context()
+	defer cancel()
+	n, err := iterator.Iterate(ctx, it).Paths(true).Count()
+	err = s.queryErr(ctx, err)
+	s.observe(it, start, int(n), err)
+	return n, err
 }
 
 type Result struct {
 	Meta bool
 	Val  interface{}
 	Tags map[string]graph.Ref
+	// Seq is a sequence number of a value added with Emit, starting from 1.
+	// It is zero for all other results. Emitted values are always returned in the order of their numbers.
+	Seq int
+	// Metadata is attached to the value with EmitMeta. It's returned under EmitMetaKey in JSON results.
+	Metadata interface{}
+	// Errors is a list of errors collected in soft errors mode. It's set only for the last result.
+	// See WithSoftErrors.
+	Errors []error
+}
+
+// EmitMetaKey is a reserved key for metadata attached to emitted values with EmitMeta.
+const EmitMetaKey = "$meta"
+
+// value returns the emitted value with metadata merged into it.
+func (r *Result) value() interface{} {
+	m, ok := r.Val.(map[string]interface{})
+	if r.Metadata == nil || !ok {
+		return r.Val
+	}
+	out := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[EmitMetaKey] = r.Metadata
+	return out
 }
 
 func (r *Result) Result() interface{} {
@@ -260,8 +651,16 @@ func (s *Session) compile(qu string) error {
 	if s.last == qu && s.last != "" {
 		p = s.p
 	} else {
+		src := qu
+		if s.maxSteps > 0 {
+			var err error
+			src, err = instrument(qu, s.stepFunc)
+			if err != nil {
+				return err
+			}
+		}
 		var err error
-		p, err = goja.Compile("", qu, false)
+		p, err = goja.Compile("", src, false)
 		if err != nil {
 			return err
 		}
@@ -275,6 +674,19 @@ func (s *Session) run() (goja.Value, error) {
 	if e, ok := err.(*goja.Exception); ok && e.Value() != nil {
 		if er, ok := e.Value().Export().(error); ok {
 			err = er
+		} else if o, ok := e.Value().(*goja.Object); ok {
+			// errors returned by Go methods are wrapped into GoError objects
+			if v := o.Get("value"); v != nil {
+				if er, ok := v.Export().(error); ok {
+					err = er
+				}
+			}
+		}
+	}
+	// the script may be interrupted inside of a callback called by a final
+	if e, ok := err.(*goja.InterruptedError); ok {
+		if er, ok := e.Value().(errInstructionLimit); ok {
+			err = er
 		}
 	}
 	return v, err
@@ -290,8 +702,16 @@ func (s *Session) Execute(ctx context.Context, qu string, opt query.Options) (qu
 	}
 	s.limit = opt.Limit
 	s.count = 0
-	ctx, cancel := context.WithCancel(context.Background())
+	s.steps = 0
+	s.emitSeq = 0
+	s.materialized = path.NewMaterializeCache()
+	s.takeSoftErrors()
+	ctx, cancel := s.queryContext(ctx)
 	s.ctx = ctx
+	s.mu.Lock()
+	s.cancel = cancel
+	s.truncated = false
+	s.mu.Unlock()
 	s.col = opt.Collation
 	return &results{
 		col: opt.Collation,
@@ -300,6 +720,44 @@ func (s *Session) Execute(ctx context.Context, qu string, opt query.Options) (qu
 	}, nil
 }
 
+// queryContext returns a context for a single query. The query context inherits the given context,
+// and is also cancelled when the session context set with WithContext is done.
+// If the timeout is set with WithScriptTimeout, the query context expires after it.
+func (s *Session) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var (
+		qctx   context.Context
+		cancel context.CancelFunc
+	)
+	if s.scriptTimeout > 0 {
+		qctx, cancel = context.WithTimeout(ctx, s.scriptTimeout)
+	} else {
+		qctx, cancel = context.WithCancel(ctx)
+	}
+	if parent := s.parent; parent != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+				cancel()
+			case <-qctx.Done():
+			}
+		}()
+	}
+	return qctx, cancel
+}
+
+// Cancel aborts the query that is currently executed by the session.
+// All iterators will be closed and the script execution will be interrupted.
+//
+// It is safe to call Cancel from a different goroutine.
+func (s *Session) Cancel() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
 type results struct {
 	s      *Session
 	col    query.Collation
@@ -337,6 +795,9 @@ func (it *results) Next(ctx context.Context) bool {
 			if !goja.IsNull(v) && !goja.IsUndefined(v) {
 				it.s.send(it.ctx, &Result{Meta: true, Val: v.Export()})
 			}
+			if errs := it.s.takeSoftErrors(); len(errs) != 0 {
+				it.s.send(it.ctx, &Result{Errors: errs})
+			}
 		}()
 	}
 	select {
@@ -344,6 +805,8 @@ func (it *results) Next(ctx context.Context) bool {
 		it.cur = r
 		return true
 	case err := <-it.errc:
+		// the script is done, it must not be interrupted on Close, or the interrupt will fire in the next query
+		it.running = false
 		if err != nil {
 			it.err = err
 		}
@@ -352,6 +815,10 @@ func (it *results) Next(ctx context.Context) bool {
 		it.err = ctx.Err()
 		it.stop(it.err)
 		return false
+	case <-it.ctx.Done():
+		it.err = it.ctx.Err()
+		it.stop(it.err)
+		return false
 	}
 }
 
@@ -375,8 +842,15 @@ func (it *results) jsonResult() interface{} {
 	if data.Meta {
 		return nil
 	}
+	if data.Errors != nil {
+		errs := make([]string, 0, len(data.Errors))
+		for _, err := range data.Errors {
+			errs = append(errs, err.Error())
+		}
+		return map[string]interface{}{SoftErrorsKey: errs}
+	}
 	if data.Val != nil {
-		return data.Val
+		return data.value()
 	}
 	obj := make(map[string]interface{})
 	tags := data.Tags
@@ -392,6 +866,9 @@ func (it *results) jsonResult() interface{} {
 			delete(obj, k)
 		}
 	}
+	if it.s.multiTags {
+		obj = groupTags(obj)
+	}
 	return obj
 }
 
@@ -408,6 +885,13 @@ func (it *results) replResult() interface{} {
 		}
 		return fmt.Sprintln("=>", nil)
 	}
+	if data.Errors != nil {
+		var out string
+		for _, err := range data.Errors {
+			out += fmt.Sprintln("error:", err)
+		}
+		return out
+	}
 	var out string
 	out = fmt.Sprintln("****")
 	if data.Val == nil {
@@ -423,10 +907,11 @@ func (it *results) replResult() interface{} {
 			if k == "$_" {
 				continue
 			}
-			out += fmt.Sprintf("%s : %s\n", k, quadValueToString(it.s.qs.NameOf(tags[k])))
+			name, _ := splitTag(k)
+			out += fmt.Sprintf("%s : %s\n", name, quadValueToString(it.s.qs.NameOf(tags[k])))
 		}
 	} else {
-		switch export := data.Val.(type) {
+		switch export := data.value().(type) {
 		case map[string]string:
 			for k, v := range export {
 				out += fmt.Sprintf("%s : %s\n", k, v)
@@ -16,15 +16,25 @@ package gizmo
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"reflect"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/iterator"
 	_ "github.com/cayleygraph/cayley/graph/memstore"
 	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/query/path"
 	_ "github.com/cayleygraph/cayley/writer"
 	"github.com/cayleygraph/quad"
 
@@ -93,6 +103,28 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<alice>"},
 	},
+	{
+		message: "use .all with limit",
+		query: `
+			g.V("<bob>").tag("target").in("<follows>").all(2)
+		`,
+		tag:    "target",
+		expect: []string{"<bob>", "<bob>"},
+	},
+	{
+		message: "use .all with zero limit",
+		query: `
+			g.V().all(0)
+		`,
+		expect: nil,
+	},
+	{
+		message: "use .all with negative limit",
+		query: `
+			g.V().all(-1)
+		`,
+		err: true,
+	},
 	{
 		message: "use .getLimit",
 		query: `
@@ -100,6 +132,82 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<alice>", "<bob>", "<follows>", "<fred>", "<status>"},
 	},
+	{
+		message: "use .getLimit with zero limit",
+		query: `
+			g.V().getLimit(0)
+		`,
+		expect: nil,
+	},
+	{
+		message: "use .getLimit with negative limit",
+		query: `
+			g.V().getLimit(-1)
+		`,
+		err: true,
+	},
+	{
+		message: "use .tagArray",
+		query: `
+			var a = g.V("<bob>").tag("name").in("<follows>").tagArray()
+			g.emit(a.length)
+			for (var i = 0; i < a.length; i++) {
+				g.emit(a[i]["name"] + " " + a[i]["id"])
+			}
+		`,
+		expect: []string{"3", "<bob> <alice>", "<bob> <charlie>", "<bob> <dani>"},
+	},
+	{
+		message: "use .tagArray with limit",
+		query: `
+			var a = g.V("<bob>").tag("name").in("<follows>").tagArray(2)
+			g.emit(a.length)
+			g.emit(a[0]["name"])
+		`,
+		expect: []string{"2", "<bob>"},
+	},
+	{
+		message: "use .selectTags",
+		query: `
+			var rows = g.V("<bob>").tag("target").in("<follows>").tag("follower").selectTags("target", "missing")
+			for (var i = 0; i < rows.length; i++) {
+				var r = rows[i]
+				g.emit(r.id + " " + r.target + " " + r.missing + " " + ("follower" in r))
+			}
+		`,
+		expect: []string{"<alice> <bob> null false", "<charlie> <bob> null false", "<dani> <bob> null false"},
+	},
+	{
+		message: "use .selectTags without tags",
+		query: `
+			g.V().selectTags()
+		`,
+		err: true,
+	},
+	{
+		message: "use .distinctBy",
+		query: `
+			var rows = g.V("<alice>", "<charlie>", "<dani>").tag("who").out("<follows>").tag("target").distinctBy("target")
+			for (var i = 0; i < rows.length; i++) {
+				g.emit(rows[i].target)
+			}
+		`,
+		expect: []string{"<bob>", "<dani>", "<greg>"},
+	},
+	{
+		message: "use .distinctBy with a missing tag",
+		query: `
+			g.emit(g.V("<alice>", "<charlie>", "<dani>").out("<follows>").distinctBy("missing").length)
+		`,
+		expect: []string{"5"},
+	},
+	{
+		message: "use .distinctBy without a tag",
+		query: `
+			g.V().distinctBy("")
+		`,
+		err: true,
+	},
 	{
 		message: "get a single vertex (IRI)",
 		query: `
@@ -184,6 +292,202 @@ var testQueries = []struct {
 		`,
 		err: true,
 	},
+	{
+		message: "use between",
+		data:    ordersGraph(),
+		query: `
+			g.V().out("<price>").between(3, 5).all()
+		`,
+		expect: []string{intVal(5), intVal(3)},
+	},
+	{
+		message: "use between with floats",
+		data:    ordersGraph(),
+		query: `
+			g.V().out("<price>").between(2.5, 10, false).all()
+		`,
+		expect: []string{intVal(5), intVal(3)},
+	},
+	{
+		message: "use between with times",
+		data: []quad.Quad{
+			quad.Make(quad.IRI("a"), quad.IRI("date"), quad.Time(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)), nil),
+			quad.Make(quad.IRI("b"), quad.IRI("date"), quad.Time(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)), nil),
+			quad.Make(quad.IRI("c"), quad.IRI("date"), quad.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), nil),
+		},
+		query: `
+			g.V().out("<date>").between(new Date("2012-01-01T00:00:00Z"), new Date("2020-01-01T00:00:00Z")).in("<date>").all()
+		`,
+		expect: []string{"<b>", "<c>"},
+	},
+	{
+		message: "use between with mismatched bounds",
+		data:    ordersGraph(),
+		query: `
+			g.V().out("<price>").between(3, new Date()).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use datatype",
+		data:    ordersGraph(),
+		query: `
+			g.V().out("<price>").datatype("xsd:integer").all()
+		`,
+		expect: []string{intVal(10), intVal(5), intVal(3)},
+	},
+	{
+		message: "use datatype with multiple types",
+		data:    ordersGraph(),
+		query: `
+			g.emit(g.V().out("<price>").datatype("<http://www.w3.org/2001/XMLSchema#integer>", iri("xsd:double")).count())
+		`,
+		expect: []string{"4"},
+	},
+	{
+		message: "use datatype with plain strings",
+		data:    ordersGraph(),
+		query: `
+			g.emit(g.V().out("<price>").datatype("xsd:string").count())
+			g.emit(g.V().out("<price>").datatype("xsd:string", true).count())
+		`,
+		expect: []string{"0", "1"},
+	},
+	{
+		message: "use datatype without types",
+		query: `
+			g.V().datatype(true).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use langMatches",
+		data:    labelsGraph(),
+		query: `
+			g.V().out("<label>").langMatches("en").all()
+		`,
+		expect: []string{`"color"@en`, `"colour"@en-GB`},
+	},
+	{
+		message: "use langMatches with a wildcard",
+		data:    labelsGraph(),
+		query: `
+			g.V().out("<label>").langMatches("*").all()
+		`,
+		expect: []string{`"color"@en`, `"colour"@en-GB`, `"couleur"@fr`, `"colr"@eng`},
+	},
+	{
+		message: "use langMatches with an invalid range",
+		data:    labelsGraph(),
+		query: `
+			g.V().out("<label>").langMatches("en_US").all()
+		`,
+		err: true,
+	},
+	{
+		message: "use hasPrefix",
+		query: `
+			g.V().hasPrefix("f").all()
+		`,
+		expect: []string{"<follows>", "<fred>"},
+	},
+	{
+		message: "use hasPrefix on strings",
+		query: `
+			g.V().out("<status>").hasPrefix("smart_").all()
+		`,
+		expect: []string{"smart_person", "smart_person"},
+	},
+	{
+		message: "use hasPrefix with wildcards",
+		query: `
+			g.V().hasPrefix("f%").all()
+		`,
+		expect: nil,
+	},
+	{
+		message: "use hasPrefix with a number",
+		query: `
+			g.V().hasPrefix(1).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use .filter() with a callback",
+		query: `
+			g.V("<bob>").in("<follows>").filter(function(v) { return v.indexOf("li") >= 0 }).all()
+		`,
+		expect: []string{"<alice>", "<charlie>"},
+	},
+	{
+		message: "use .filter() with multiple callbacks",
+		query: `
+			var n = 0
+			var arr = g.V("<bob>").in("<follows>").filter(
+				function(v) { return v == "<alice>" },
+				function(v) { n++; return true }
+			).toArray()
+			g.emit(arr.join(",") + " " + n)
+		`,
+		expect: []string{"<alice> 1"},
+	},
+	{
+		message: "use .filter() with a callback and a filter",
+		query: `
+			g.V("<bob>").in("<follows>").filter(gt(iri("b")), function(v) { return v != "<dani>" }).all()
+		`,
+		expect: []string{"<charlie>"},
+	},
+	{
+		message: "use .filter() with a throwing callback",
+		query: `
+			g.V("<bob>").in("<follows>").filter(function(v) { throw new Error("fail") }).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use .filter() with an invalid argument",
+		query: `
+			g.V("<bob>").in("<follows>").filter(1).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use .filterOr()",
+		query: `
+			g.V("<bob>").in("<follows>").filterOr(lt(iri("b")), function(v) { return v.indexOf("li") >= 0 }).all()
+		`,
+		expect: []string{"<alice>", "<charlie>"},
+	},
+	{
+		message: "use .filterOr() with regex and range",
+		data:    ordersGraph(),
+		query: `
+			g.V().out("<price>").filterOr(regex("^fr"), gte(10)).all()
+		`,
+		expect: []string{`"10"^^<xsd:integer>`, "free"},
+	},
+	{
+		message: "use .filterOr() keeps duplicates",
+		query: `
+			g.V().out("<status>").filterOr(like("cool%"), like("%cool%")).all()
+		`,
+		expect: []string{"cool_person", "cool_person", "cool_person"},
+	},
+	{
+		message: "use .filterOr() with a throwing callback",
+		query: `
+			g.V("<bob>").in("<follows>").filterOr(function(v) { return false }, function(v) { throw new Error("fail") }).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use .filter(regex) with unknown option",
+		query: `
+			g.V("<bob>").in("<follows>").filter(regex("ar?li.*e", {refs: true})).all()
+		`,
+		err: true,
+	},
 	{
 		message: "use .in() with .filter(regex,gt)",
 		query: `
@@ -213,6 +517,118 @@ var testQueries = []struct {
 		tag:    "pred",
 		expect: []string{"<follows>", "<follows>", "<follows>"},
 	},
+	{
+		message: "use geo point",
+		data: []quad.Quad{
+			quad.Make(quad.IRI("nyc"), quad.IRI("location"), quad.TypedString{
+				Value: "POINT(-74 40.7)", Type: "http://www.opengis.net/ont/geosparql#wktLiteral",
+			}, nil),
+			quad.Make(quad.IRI("paris"), quad.IRI("location"), quad.TypedString{
+				Value: "POINT(2.35 48.86)", Type: "http://www.opengis.net/ont/geosparql#wktLiteral",
+			}, nil),
+		},
+		query: `
+			g.V().has("<location>", geo(40.7, -74.0)).all()
+		`,
+		expect: []string{"<nyc>"},
+	},
+	{
+		message: "use geo point out of range",
+		query: `
+			geo(91, 0)
+		`,
+		err: true,
+	},
+	{
+		message: "use geo point with a string",
+		query: `
+			geo("40.7", -74)
+		`,
+		err: true,
+	},
+	{
+		message: "use duration",
+		query: `
+			g.emit(duration("24h").toString())
+			g.emit(duration("1h30m1.5s").toString())
+			g.emit(duration("-90s").toString())
+			g.emit(duration("0s").toString())
+		`,
+		expect: []string{
+			`"PT24H"^^<xsd:duration>`,
+			`"PT1H30M1.5S"^^<xsd:duration>`,
+			`"-PT1M30S"^^<xsd:duration>`,
+			`"PT0S"^^<xsd:duration>`,
+		},
+	},
+	{
+		message: "use invalid duration",
+		query: `
+			duration("a day")
+		`,
+		err: true,
+	},
+	{
+		message: "use time shift with a non-duration",
+		query: `
+			timeAdd(now(), 5)
+		`,
+		err: true,
+	},
+	{
+		message: "use uuid",
+		query: `
+			var a = uuid(), b = uuid()
+			g.emit(a.toString() != b.toString())
+			g.emit(/^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$/.test(a.toString()))
+			var c = uuid("ex:")
+			g.emit(/^ex:[0-9a-f-]{36}$/.test(c.toString()))
+			g.emit(g.fromValue(a).type() + " " + g.fromValue(c).type())
+		`,
+		expect: []string{"true", "true", "true", "bnode iri"},
+	},
+	{
+		message: "use uuid with a non-string prefix",
+		query: `
+			uuid(1)
+		`,
+		err: true,
+	},
+	{
+		message: "use parseTyped",
+		query: `
+			var t = parseTyped(typed("1.5", "http://www.w3.org/2001/XMLSchema#decimal"))
+			g.emit(t.value + " " + t.type)
+			t = parseTyped(geo(40.7, -74))
+			g.emit(t.value + " " + t.type)
+		`,
+		expect: []string{
+			"1.5 http://www.w3.org/2001/XMLSchema#decimal",
+			"POINT(-74 40.7) http://www.opengis.net/ont/geosparql#wktLiteral",
+		},
+	},
+	{
+		message: "use parseTyped with a non-typed value",
+		query: `
+			parseTyped(str("a"))
+		`,
+		err: true,
+	},
+	{
+		message: "use .bothDir()",
+		query: `
+			g.V("<fred>").bothDir("<follows>", "dir").all()
+		`,
+		tag:    "dir",
+		expect: []string{"in", "in", "out"},
+	},
+	{
+		message: "use .bothDir() without direction tag",
+		query: `
+			g.V("<fred>").bothDir("<follows>").all()
+		`,
+		err: true,
+	},
 	{
 		message: "use .tag()-.is()-.back()",
 		query: `
@@ -228,6 +644,13 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<bob>"},
 	},
+	{
+		message: "use .back() with an unknown tag",
+		query: `
+			g.V("<bob>").in("<follows>").tag("foo").out("<status>").back("bar").all()
+		`,
+		err: true,
+	},
 	{
 		message: "do multiple .back()",
 		query: `
@@ -320,6 +743,29 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<charlie>"},
 	},
+	{
+		message: "show intersection of multiple paths",
+		query: `
+			function follows(x) { return g.V(x).out("<follows>") }
+			follows("<charlie>").intersect(follows("<dani>"), follows("<alice>")).all()
+		`,
+		expect: []string{"<bob>"},
+	},
+	{
+		message: "show intersection with a non-path",
+		query: `
+			g.V("<charlie>").out("<follows>").intersect(g.V("<dani>").out("<follows>"), "<bob>").all()
+		`,
+		err: true,
+	},
+	{
+		message: "show intersection with a materialized path",
+		query: `
+			var cool = g.V().has("<status>", "cool_person").materialize()
+			g.V("<bob>").in("<follows>").intersect(cool).union(cool).all()
+		`,
+		expect: []string{"<dani>", "<bob>", "<dani>", "<greg>"},
+	},
 	{
 		message: "test Or()",
 		query: `
@@ -327,6 +773,13 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<fred>", "<bob>", "<greg>", "<dani>"},
 	},
+	{
+		message: "test Or() with multiple paths",
+		query: `
+			g.V("<charlie>").out("<follows>").or(g.V("<dani>").out("<follows>"), g.V("<alice>").out("<follows>")).all()
+		`,
+		expect: []string{"<bob>", "<dani>", "<bob>", "<greg>", "<bob>"},
+	},
 
 	// Has tests.
 	{
@@ -357,7 +810,89 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<bob>", "<dani>", "<emily>", "<fred>"},
 	},
-
+	{
+		message: "show a Has with values and filters",
+		query: `
+				g.V().has("<follows>", "<bob>", gt("<f>")).all()
+		`,
+		// dani follows both bob and greg
+		expect: []string{"<alice>", "<bob>", "<charlie>", "<dani>", "<dani>", "<emily>", "<fred>"},
+	},
+	{
+		message: "show a Has with values and several filters",
+		query: `
+				g.V().has("<follows>", gt("<f>"), "<alice>", lt("<g>")).all()
+		`,
+		expect: []string{"<bob>", "<emily>"},
+	},
+	{
+		message: "show a HasR with values and filters",
+		query: `
+				g.V().hasR("<follows>", "<alice>", regex("^e", true)).all()
+		`,
+		expect: []string{"<bob>", "<fred>"},
+	},
+	{
+		message: "show a simple HasNot",
+		query: `
+				g.V("<alice>", "<bob>", "<charlie>", "<dani>").hasNot("<status>", "cool_person").all()
+		`,
+		expect: []string{"<alice>", "<charlie>"},
+	},
+	{
+		message: "show a HasNot with predicate only",
+		query: `
+				g.V().has("<follows>").unique().hasNot("<status>").all()
+		`,
+		expect: []string{"<alice>", "<charlie>", "<fred>"},
+	},
+	{
+		message: "show a HasNot with filter",
+		query: `
+				g.V("<alice>", "<bob>", "<dani>", "<emily>").hasNot("<follows>", gt("<f>")).all()
+		`,
+		expect: []string{"<alice>"},
+	},
+	{
+		message: "show a HasNot in a morphism",
+		query: `
+				var m = g.M().out("<follows>").hasNot("<status>", "cool_person")
+				g.V("<charlie>", "<emily>").follow(m).all()
+		`,
+		expect: []string{"<fred>"},
+	},
+	{
+		message: "show HasNot with no arguments",
+		query: `
+				g.V().hasNot().all()
+		`,
+		err: true,
+	},
+
+	{
+		message: "use exceptBy",
+		query: `
+			var blocked = g.V("<bob>").tag("target")
+			g.V("<alice>", "<charlie>", "<dani>").tag("who").out("<follows>").tag("target").exceptBy(blocked, "target").all()
+		`,
+		tag:    "who",
+		expect: []string{"<charlie>", "<dani>"},
+	},
+	{
+		message: "use exceptBy with a tag not on the excluded path",
+		query: `
+			g.V("<alice>", "<charlie>").tag("who").out("<follows>").exceptBy(g.V("<alice>"), "who").all()
+		`,
+		expect: []string{"<bob>", "<bob>", "<dani>"},
+	},
+	{
+		message: "use exceptBy without a tag",
+		query: `
+			g.V().exceptBy(g.V(), "")
+		`,
+		err: true,
+	},
+
 	// Skip/Limit tests.
 	{
 		message: "use Limit",
@@ -367,477 +902,2633 @@ var testQueries = []struct {
 		expect: []string{"<bob>", "<dani>"},
 	},
 	{
-		message: "use Skip",
+		message: "use negative Limit",
 		query: `
-				g.V().has("<status>", "cool_person").skip(2).all()
+				g.V().has("<status>", "cool_person").limit(-1).all()
 		`,
-		expect: []string{"<greg>"},
+		expect: []string{"<bob>", "<dani>"},
 	},
 	{
-		message: "use Skip and Limit",
+		message: "use negative Limit larger than the result",
 		query: `
-				g.V().has("<status>", "cool_person").skip(1).limit(1).all()
+				g.V().has("<status>", "cool_person").limit(-5).all()
 		`,
-		expect: []string{"<dani>"},
+		expect: nil,
 	},
-
 	{
-		message: "show Count",
+		message: "use zero Limit",
 		query: `
-				g.V().has("<status>").count()
+				g.V().has("<status>", "cool_person").limit(0).all()
 		`,
-		expect: []string{"5"},
+		expect: []string{"<bob>", "<dani>", "<greg>"},
 	},
 	{
-		message: "use Count value",
+		message: "use negative Limit with intersection",
 		query: `
-				g.emit(g.V().has("<status>").count()+1)
+				g.V("<bob>", "<greg>").and(g.V().has("<status>", "cool_person").limit(-1)).all()
 		`,
-		expect: []string{"6"},
+		expect: []string{"<bob>"},
 	},
-
-	// Tag tests.
 	{
-		message: "show a simple save",
+		message: "use FollowAny",
 		query: `
-			g.V().save("<status>", "somecool").all()
+			var follows = g.M().out("<follows>")
+			var followers = g.M().in("<follows>")
+			g.V("<bob>").followAny([follows, null, followers]).all()
 		`,
-		tag:    "somecool",
-		expect: []string{"cool_person", "cool_person", "cool_person", "smart_person", "smart_person"},
+		expect: []string{"<alice>", "<charlie>", "<dani>", "<fred>"},
 	},
 	{
-		message: "show a simple save optional",
+		message: "use FollowAny with a single morphism",
 		query: `
-			g.V("<bob>","<charlie>").out("<follows>").saveOpt("<status>", "somecool").all()
+			g.V("<bob>").followAny([g.M().out("<follows>")]).all()
 		`,
-		tag:    "somecool",
-		expect: []string{"cool_person", "cool_person"},
+		expect: []string{"<fred>"},
 	},
 	{
-		message: "save iri no tag",
+		message: "use FollowAny with an empty array",
 		query: `
-			g.V().save(g.IRI("status")).all()
+			g.V("<bob>").followAny([]).all()
 		`,
-		tag:    "<status>",
-		expect: []string{"cool_person", "cool_person", "cool_person", "smart_person", "smart_person"},
+		expect: nil,
 	},
 	{
-		message: "show a simple saveR",
+		message: "use FollowAny in a morphism",
 		query: `
-			g.V("cool_person").saveR("<status>", "who").all()
+			var any = g.M().followAny([g.M().out("<follows>"), g.M().out("<status>")])
+			g.V("<dani>").follow(any).all()
 		`,
-		tag:    "who",
-		expect: []string{"<greg>", "<dani>", "<bob>"},
+		expect: []string{"<bob>", "<greg>", "cool_person"},
 	},
 	{
-		message: "show an out save",
+		message: "use If",
 		query: `
-			g.V("<dani>").out(null, "pred").all()
+			var cool = g.M().has("<status>", "cool_person")
+			g.V("<alice>", "<bob>", "<charlie>", "<dani>").if(cool, g.M().out("<follows>")).all()
 		`,
-		tag:    "pred",
-		expect: []string{"<follows>", "<follows>", "<status>"},
+		expect: []string{"<alice>", "<bob>", "<charlie>", "<fred>", "<greg>"},
 	},
 	{
-		message: "show a tag list",
+		message: "use If with else",
 		query: `
-			g.V("<dani>").out(null, ["pred", "foo", "bar"]).all()
+			var cool = g.M().has("<status>", "cool_person")
+			g.V("<alice>", "<bob>", "<charlie>", "<dani>").if(cool, g.M().out("<status>"), g.M().out("<follows>")).all()
 		`,
-		tag:    "foo",
-		expect: []string{"<follows>", "<follows>", "<status>"},
+		expect: []string{"<bob>", "<bob>", "<dani>", "cool_person", "cool_person"},
 	},
 	{
-		message: "show a pred list",
+		message: "use If in reverse",
 		query: `
-			g.V("<dani>").out(["<follows>", "<status>"]).all()
+			var cool = g.M().has("<status>", "cool_person")
+			g.V("<fred>").followR(g.M().if(cool, g.M().out("<follows>"))).all()
 		`,
-		expect: []string{"<bob>", "<greg>", "cool_person"},
+		expect: []string{"<bob>", "<fred>"},
 	},
 	{
-		message: "show a predicate path",
+		message: "use If without a branch",
 		query: `
-			g.V("<dani>").out(g.V("<follows>"), "pred").all()
+			g.V().if(g.M(), null).all()
 		`,
-		expect: []string{"<bob>", "<greg>"},
+		err: true,
 	},
 	{
-		message: "list all bob's incoming predicates",
+		message: "use Repeat",
 		query: `
-		  g.V("<bob>").inPredicates().all()
+			g.V("<charlie>").repeat(g.M().out("<follows>"), 2).all()
 		`,
-		expect: []string{"<follows>"},
+		expect: []string{"<bob>", "<fred>", "<greg>"},
 	},
 	{
-		message: "save all bob's incoming predicates",
+		message: "use Repeat (compare with FollowRecursive)",
 		query: `
-		  g.V("<bob>").saveInPredicates("pred").all()
+			g.V("<charlie>").followRecursive(g.M().out("<follows>"), 2).all()
 		`,
-		expect: []string{"<follows>", "<follows>", "<follows>"},
-		tag:    "pred",
+		expect: []string{"<bob>", "<dani>", "<fred>", "<greg>"},
 	},
 	{
-		message: "list all labels",
+		message: "use Repeat with 3 steps",
 		query: `
-		  g.V().labels().all()
+			g.V("<charlie>").repeat(g.M().out("<follows>"), 3).all()
 		`,
-		expect: []string{"<smart_graph>"},
+		expect: []string{"<fred>", "<greg>"},
 	},
 	{
-		message: "list all in predicates",
+		message: "use Repeat with zero steps",
 		query: `
-		  g.V().inPredicates().all()
+			g.V("<charlie>").repeat(g.M().out("<follows>"), 0).all()
 		`,
-		expect: []string{"<are>", "<follows>", "<status>"},
+		expect: []string{"<charlie>"},
 	},
 	{
-		message: "list all out predicates",
+		message: "use Repeat with negative steps",
 		query: `
-		  g.V().outPredicates().all()
+			g.V("<charlie>").repeat(g.M().out("<follows>"), -1).all()
 		`,
-		expect: []string{"<are>", "<follows>", "<status>"},
+		err: true,
 	},
 	{
-		message: "traverse using LabelContext",
+		message: "use diff",
 		query: `
-			g.V("<greg>").labelContext("<smart_graph>").out("<status>").all()
+			var d = g.diff(g.V("<alice>", "<dani>").out("<follows>"), g.V("<charlie>").out("<follows>"))
+			g.emit("left: " + d.onlyLeft.sort().join(","))
+			g.emit("right: " + d.onlyRight.sort().join(","))
+			g.emit("both: " + d.both.sort().join(","))
 		`,
-		expect: []string{"smart_person"},
+		expect: []string{"both: <bob>", "left: <greg>", "right: <dani>"},
 	},
 	{
-		message: "open and close a LabelContext",
+		message: "use diff with morphism",
 		query: `
-			g.V().labelContext("<smart_graph>").in("<status>").labelContext(null).in("<follows>").all()
+			g.diff(g.V("<alice>"), g.M().out("<follows>"))
 		`,
-		expect: []string{"<dani>", "<fred>"},
+		err: true,
 	},
 	{
-		message: "issue #254",
-		query:   `g.V({"id":"<alice>"}).all()`,
-		expect:  nil, err: true,
+		message: "count at least",
+		query: `
+			g.emit(g.V("<alice>").out("<follows>").countAtLeast(1))
+			g.emit(g.V("<alice>").out("<follows>").countAtLeast(2))
+			g.emit(g.V().countAtLeast(5))
+			g.emit(g.V("<bob>").in("<follows>").countAtLeast(3))
+			g.emit(g.V("<bob>").in("<follows>").countAtLeast(4))
+		`,
+		expect: []string{"true", "false", "true", "true", "false"},
 	},
 	{
-		message: "roundtrip values",
+		message: "count up to",
 		query: `
-		v = g.V("<bob>").toValue()
-		s = g.V(v).out("<status>").toValue()
-		g.V(s).all()
+			g.emit(g.V("<bob>").in("<follows>").countUpTo(2))
+			g.emit(g.V("<bob>").in("<follows>").countUpTo(3))
+			g.emit(g.V("<bob>").in("<follows>").countUpTo(10))
+			g.emit(g.V("<alice>").in("<follows>").countUpTo(1))
+			g.emit(g.V().countUpTo(0))
 		`,
-		expect: []string{"cool_person"},
+		expect: []string{"2", "3", "3", "0", "0"},
 	},
 	{
-		message: "roundtrip values (tag map)",
+		message: "has any",
 		query: `
-		v = g.V("<bob>").tagValue()
-		s = g.V(v.id).out("<status>").tagValue()
-		g.V(s.id).all()
+			g.emit(g.V("<alice>").out("<follows>").hasAny())
+			g.emit(g.V("<alice>").in("<follows>").hasAny())
+			g.emit(g.V().has("<status>", "cool_person").hasAny())
+			g.emit(g.V("<not-there>").hasAny())
 		`,
-		expect: []string{"cool_person"},
+		expect: []string{"true", "false", "true", "false"},
 	},
 	{
-		message: "show ToArray",
+		message: "count up to negative",
 		query: `
-			arr = g.V("<bob>").in("<follows>").toArray()
-			for (i in arr) g.emit(arr[i]);
+			g.V().countUpTo(-1)
 		`,
-		expect: []string{"<alice>", "<charlie>", "<dani>"},
+		err: true,
 	},
 	{
-		message: "show ToArray with limit",
+		message: "count by tag",
 		query: `
-			arr = g.V("<bob>").in("<follows>").toArray(2)
-			for (i in arr) g.emit(arr[i]);
+			var c = g.V().out("<status>").countBy("id")
+			g.emit(c['"cool_person"'] + " " + c['"smart_person"'])
+			c = g.V("<bob>", "<greg>").tag("who").out("<status>").countBy("who")
+			g.emit(c["<bob>"] + " " + c["<greg>"])
+			g.emit(Object.keys(g.V("<alice>").out("<status>").countBy("id")).length)
 		`,
-		expect: []string{"<alice>", "<dani>"},
+		expect: []string{"3 2", "1 2", "0"},
 	},
 	{
-		message: "show ForEach",
+		message: "paginate",
 		query: `
-			g.V("<bob>").in("<follows>").forEach(function(o){g.emit(o.id)});
+			function ids(page) {
+				var out = []
+				for (var i = 0; i < page.results.length; i++) {
+					out.push(page.results[i].id)
+				}
+				return page.total + " " + out.join(",")
+			}
+			var p = g.V("<bob>").in("<follows>").order()
+			g.emit(ids(p.paginate(0, 2)))
+			g.emit(ids(p.paginate(1, 2)))
+			g.emit(ids(p.paginate(5, 2)))
 		`,
-		expect: []string{"<alice>", "<charlie>", "<dani>"},
+		expect: []string{"3 <alice>,<charlie>", "3 <charlie>,<dani>", "3 "},
 	},
 	{
-		message: "show ForEach with limit",
+		message: "paginate without limit",
 		query: `
-			g.V("<bob>").in("<follows>").forEach(2, function(o){g.emit(o.id)});
+			g.V("<bob>").in("<follows>").paginate(1)
 		`,
-		expect: []string{"<alice>", "<dani>"},
+		err: true,
 	},
 	{
-		message: "clone paths",
+		message: "group count",
 		query: `
-			var alice = g.V('<alice>')
-			g.emit(alice.toValue())
-			var out = alice.out('<follows>')
-			g.emit(out.toValue())
-			g.emit(alice.toValue())
+			var hist = g.V().out("<status>").groupCount("id")
+			for (var i = 0; i < hist.length; i++) {
+				g.emit(hist[i].id + " " + hist[i].count)
+			}
 		`,
-		expect: []string{"<alice>", "<bob>", "<alice>"},
+		expect: []string{"cool_person 3", "smart_person 2"},
 	},
 	{
-		message: "default namespaces",
+		message: "group count without tag",
 		query: `
-			g.addDefaultNamespaces()
-			g.emit(g.IRI('rdf:type'))
+			var hist = g.V("<bob>", "<dani>", "<fred>").out("<status>").tag("st").back("st").
+				union(g.V("<alice>")).groupCount("st")
+			for (var i = 0; i < hist.length; i++) {
+				g.emit(hist[i].id + " " + hist[i].count)
+			}
 		`,
-		expect: []string{"<http://www.w3.org/1999/02/22-rdf-syntax-ns#type>"},
+		expect: []string{"cool_person 2", "null 1"},
 	},
 	{
-		message: "add namespace",
+		message: "use has with a path of predicates",
 		query: `
-			g.addNamespace('ex','http://example.net/')
-			g.emit(g.IRI('ex:alice'))
+			g.V().has(g.V("<follows>"), "<fred>").all()
 		`,
-		expect: []string{"<http://example.net/alice>"},
+		expect: []string{"<bob>", "<emily>"},
 	},
 	{
-		message: "recursive follow",
+		message: "use hasAll",
 		query: `
-			g.V("<charlie>").followRecursive("<follows>").all();
+			g.V().hasAll([["<follows>", "<bob>"], ["<status>", "cool_person"]]).all()
 		`,
-		expect: []string{"<bob>", "<dani>", "<fred>", "<greg>"},
+		expect: []string{"<dani>"},
 	},
 	{
-		message: "recursive follow tag",
+		message: "use hasAll with filters",
+		data:    ordersGraph(),
 		query: `
-			g.V("<charlie>").followRecursive("<follows>", "depth").all();
+			g.V().hasAll([["<price>", gt(3)], ["<price>", lt(10)]]).all()
 		`,
-		tag:    "depth",
-		expect: []string{intVal(1), intVal(1), intVal(2), intVal(2)},
+		expect: []string{"<item2>"},
 	},
 	{
-		message: "recursive follow path",
+		message: "use hasAll with an invalid pair",
 		query: `
-			g.V("<charlie>").followRecursive(g.V().out("<follows>")).all();
+			g.V().hasAll([["<follows>", "<bob>"], ["<status>"]]).all()
 		`,
-		expect: []string{"<bob>", "<dani>", "<fred>", "<greg>"},
+		err: true,
 	},
 	{
-		message: "find non-existent",
+		message: "use hasAll without an array",
 		query: `
-			g.V('<not-existing>').forEach(function(d){ g.emit(d); })
+			g.V().hasAll("<follows>", "<bob>").all()
 		`,
-		expect: nil,
+		err: true,
 	},
 	{
-		message: "default limit All",
+		message: "use hasFilter with a filter function",
+		data:    ordersGraph(),
 		query: `
-			g.V().all()
+			g.V().hasFilter("<price>", gt, 4).all()
 		`,
-		limit:  issue718Limit,
-		data:   issue718Graph(),
-		expect: issue718Nodes(),
+		expect: []string{"<item1>", "<item2>"},
 	},
 	{
-		message: "issue #758. Verify saveOpt respects label context",
+		message: "use hasFilter with an operator name",
+		data:    ordersGraph(),
 		query: `
-			g.V("<greg>").labelContext("<smart_graph>").saveOpt("<status>", "statusTag").all()
+			g.V().hasFilter("<price>", "<=", 5).all()
 		`,
-		tag:    "statusTag",
-		file:   multiGraphTestFile,
-		expect: []string{"smart_person"},
+		expect: []string{"<item2>", "<item3>"},
 	},
 	{
-		message: "issue #758. Verify saveR respects label context.",
+		message: "use hasFilter with like",
+		data:    ordersGraph(),
 		query: `
-			g.V("smart_person").labelContext("<other_graph>").saveR("<status>", "who").all()
+			g.V().hasFilter("<price>", like, "fr%").all()
 		`,
-		tag:    "who",
-		file:   multiGraphTestFile,
-		expect: []string{"<fred>"},
+		expect: []string{"<item5>"},
 	},
 	{
-		message: "use order",
+		message: "use hasFilter with an unknown operator",
+		data:    ordersGraph(),
 		query: `
-			g.V().order().all()
+			g.V().hasFilter("<price>", "~", 5).all()
 		`,
-		expect: []string{
-			"<alice>",
-			"<are>",
-			"<bob>",
-			"<charlie>",
-			"<dani>",
-			"<emily>",
-			"<follows>",
-			"<fred>",
-			"<greg>",
-			"<predicates>",
-			"<smart_graph>",
-			"<status>",
-			"cool_person",
-			"smart_person",
-		},
+		err: true,
 	},
 	{
-		message: "use order tags",
+		message: "use hasFilter with a non-filter function",
+		data:    ordersGraph(),
 		query: `
-			g.V().Tag("target").order().all()
+			g.V().hasFilter("<price>", function(v) { return v }, 5).all()
 		`,
-		tag: "target",
-		expect: []string{
-			"<alice>",
-			"<are>",
-			"<bob>",
-			"<charlie>",
-			"<dani>",
-			"<emily>",
-			"<follows>",
-			"<fred>",
-			"<greg>",
-			"<predicates>",
-			"<smart_graph>",
-			"<status>",
-			"cool_person",
-			"smart_person",
-		},
+		err: true,
 	},
-}
-
-func runQueryGetTag(rec func(), g []quad.Quad, qu string, tag string, limit int) ([]string, error) {
-	js := makeTestSession(g)
-	ctx := context.TODO()
-	it, err := js.Execute(ctx, qu, query.Options{
+	{
+		message: "sum integers",
+		data:    ordersGraph(),
+		query: `
+			g.emit(g.V("<order1>").out("<lineItem>").out("<price>").sum())
+		`,
+		expect: []string{"15"},
+	},
+	{
+		message: "sum with floats",
+		data:    ordersGraph(),
+		query: `
+			g.emit(g.V("<order1>", "<order2>").out("<lineItem>").out("<price>").sum())
+		`,
+		expect: []string{"20.5"},
+	},
+	{
+		message: "sum of nothing",
+		data:    ordersGraph(),
+		query: `
+			g.emit(g.V("<order4>").out("<lineItem>").out("<price>").sum())
+		`,
+		expect: []string{"0"},
+	},
+	{
+		message: "sum non-numeric values",
+		data:    ordersGraph(),
+		query: `
+			g.emit(g.V("<order3>").out("<lineItem>").out("<price>").sum())
+		`,
+		err: true,
+	},
+	{
+		message: "min and max of numbers",
+		data:    ordersGraph(),
+		query: `
+			var prices = g.V("<order1>", "<order2>").out("<lineItem>").out("<price>")
+			g.emit(prices.min())
+			g.emit(prices.max())
+		`,
+		expect: []string{"2.5", "10"},
+	},
+	{
+		message: "min and max of times",
+		data:    asOfGraph(),
+		query: `
+			var from = g.V().out("<validFrom>")
+			g.emit(from.min())
+			g.emit(from.max())
+		`,
+		expect: []string{"2010-01-01 00:00:00 +0000 UTC", "2019-01-01 00:00:00 +0000 UTC"},
+	},
+	{
+		message: "min and max of strings",
+		query: `
+			var st = g.V().out("<status>")
+			g.emit(st.min())
+			g.emit(st.max())
+		`,
+		expect: []string{"cool_person", "smart_person"},
+	},
+	{
+		message: "min and max of nothing",
+		query: `
+			g.emit(g.V("<alice>").out("<status>").min() === null)
+			g.emit(g.V("<alice>").out("<status>").max() === null)
+		`,
+		expect: []string{"true", "true"},
+	},
+	{
+		message: "use toObject",
+		query: `
+			var o = g.V("<dani>").tag("person").out("<follows>").tag("follows").
+				back("person").out("<status>").tag("status").toObject("person")
+			g.emit(o.person + " " + o.follows.sort().join(",") + " " + o.status)
+		`,
+		expect: []string{"<dani> <bob>,<greg> cool_person"},
+	},
+	{
+		message: "use toObject without results",
+		query: `
+			g.emit(g.V("<nobody>").tag("person").toObject("person") === null)
+		`,
+		expect: []string{"true"},
+	},
+	{
+		message: "use toObject with multiple entities",
+		query: `
+			g.V("<alice>", "<bob>").tag("person").toObject("person")
+		`,
+		err: true,
+	},
+	{
+		message: "use fixedSet",
+		query: `
+			var s = g.fixedSet("<alice>", "<dani>", "<nobody>")
+			s.out("<follows>").all()
+			s.in("<follows>").all()
+		`,
+		expect: []string{"<bob>", "<bob>", "<charlie>", "<greg>"},
+	},
+	{
+		message: "use empty fixedSet",
+		query: `
+			g.fixedSet().all()
+		`,
+		expect: nil,
+	},
+	{
+		message: "use followRecursive with max results",
+		query: `
+			var people = g.V("<charlie>").followRecursive(g.M().out("<follows>"), 0, 2).toArray()
+			g.emit(people.sort().join(",") + " " + g.truncated())
+		`,
+		expect: []string{"<bob>,<dani> true"},
+	},
+	{
+		message: "use followRecursive with max results and tags",
+		query: `
+			g.V("<charlie>").followRecursive("<follows>", 1, 10, "depth").all()
+			g.emit(g.truncated())
+		`,
+		tag:    "depth",
+		expect: []string{intVal(1), intVal(1), "false"},
+	},
+	{
+		message: "use followRecursive with max results and depth",
+		query: `
+			var people = g.V("<charlie>").followRecursive(g.M().out("<follows>"), 2, 3).toArray()
+			g.emit(people.length + " " + g.truncated())
+		`,
+		expect: []string{"3 true"},
+	},
+	{
+		message: "use Skip",
+		query: `
+				g.V().has("<status>", "cool_person").skip(2).all()
+		`,
+		expect: []string{"<greg>"},
+	},
+	{
+		message: "use Skip and Limit",
+		query: `
+				g.V().has("<status>", "cool_person").skip(1).limit(1).all()
+		`,
+		expect: []string{"<dani>"},
+	},
+
+	{
+		message: "show Count",
+		query: `
+				g.V().has("<status>").count()
+		`,
+		expect: []string{"5"},
+	},
+	{
+		message: "use Count value",
+		query: `
+				g.emit(g.V().has("<status>").count()+1)
+		`,
+		expect: []string{"6"},
+	},
+
+	// Tag tests.
+	{
+		message: "show a simple save",
+		query: `
+			g.V().save("<status>", "somecool").all()
+		`,
+		tag:    "somecool",
+		expect: []string{"cool_person", "cool_person", "cool_person", "smart_person", "smart_person"},
+	},
+	{
+		message: "show a simple save optional",
+		query: `
+			g.V("<bob>","<charlie>").out("<follows>").saveOpt("<status>", "somecool").all()
+		`,
+		tag:    "somecool",
+		expect: []string{"cool_person", "cool_person"},
+	},
+	{
+		message: "save iri no tag",
+		query: `
+			g.V().save(g.IRI("status")).all()
+		`,
+		tag:    "<status>",
+		expect: []string{"cool_person", "cool_person", "cool_person", "smart_person", "smart_person"},
+	},
+	{
+		message: "save a path",
+		query: `
+			g.V("<dani>").save(g.V("<follows>"), "target").all()
+		`,
+		tag:    "target",
+		expect: []string{"<bob>", "<greg>"},
+	},
+	{
+		message: "save a path without tag",
+		query: `
+			g.V("<dani>").save(g.V("<follows>")).all()
+		`,
+		err: true,
+	},
+	{
+		message: "save without arguments",
+		query: `
+			g.V("<dani>").save().all()
+		`,
+		err: true,
+	},
+	{
+		message: "save with invalid tag",
+		query: `
+			g.V("<dani>").save("<follows>", 1).all()
+		`,
+		err: true,
+	},
+	{
+		message: "show a simple saveR",
+		query: `
+			g.V("cool_person").saveR("<status>", "who").all()
+		`,
+		tag:    "who",
+		expect: []string{"<greg>", "<dani>", "<bob>"},
+	},
+	{
+		message: "show a simple saveReverse",
+		query: `
+			g.V("cool_person").saveReverse("<status>", "who").all()
+		`,
+		tag:    "who",
+		expect: []string{"<greg>", "<dani>", "<bob>"},
+	},
+	{
+		message: "saveReverse a path",
+		query: `
+			g.V("cool_person").saveReverse(g.V("<status>"), "who").all()
+		`,
+		tag:    "who",
+		expect: []string{"<greg>", "<dani>", "<bob>"},
+	},
+	{
+		message: "saveReverse without tag",
+		query: `
+			g.V("cool_person").saveReverse("<status>").all()
+		`,
+		err: true,
+	},
+	{
+		message: "show an out save",
+		query: `
+			g.V("<dani>").out(null, "pred").all()
+		`,
+		tag:    "pred",
+		expect: []string{"<follows>", "<follows>", "<status>"},
+	},
+	{
+		message: "show a tag list",
+		query: `
+			g.V("<dani>").out(null, ["pred", "foo", "bar"]).all()
+		`,
+		tag:    "foo",
+		expect: []string{"<follows>", "<follows>", "<status>"},
+	},
+	{
+		message: "show a pred list",
+		query: `
+			g.V("<dani>").out(["<follows>", "<status>"]).all()
+		`,
+		expect: []string{"<bob>", "<greg>", "cool_person"},
+	},
+	{
+		message: "show a predicate path",
+		query: `
+			g.V("<dani>").out(g.V("<follows>"), "pred").all()
+		`,
+		expect: []string{"<bob>", "<greg>"},
+	},
+	{
+		message: "list all bob's incoming predicates",
+		query: `
+		  g.V("<bob>").inPredicates().all()
+		`,
+		expect: []string{"<follows>"},
+	},
+	{
+		message: "save all bob's incoming predicates",
+		query: `
+		  g.V("<bob>").saveInPredicates("pred").all()
+		`,
+		expect: []string{"<follows>", "<follows>", "<follows>"},
+		tag:    "pred",
+	},
+	{
+		message: "list all labels",
+		query: `
+		  g.V().labels().all()
+		`,
+		expect: []string{"<smart_graph>"},
+	},
+	{
+		message: "list all in predicates",
+		query: `
+		  g.V().inPredicates().all()
+		`,
+		expect: []string{"<are>", "<follows>", "<status>"},
+	},
+	{
+		message: "list all out predicates",
+		query: `
+		  g.V().outPredicates().all()
+		`,
+		expect: []string{"<are>", "<follows>", "<status>"},
+	},
+	{
+		message: "traverse using LabelContext",
+		query: `
+			g.V("<greg>").labelContext("<smart_graph>").out("<status>").all()
+		`,
+		expect: []string{"smart_person"},
+	},
+	{
+		message: "open and close a LabelContext",
+		query: `
+			g.V().labelContext("<smart_graph>").in("<status>").labelContext(null).in("<follows>").all()
+		`,
+		expect: []string{"<dani>", "<fred>"},
+	},
+	{
+		message: "open and clear a LabelContext",
+		query: `
+			g.V().labelContext("<smart_graph>").in("<status>").clearLabelContext().in("<follows>").all()
+		`,
+		expect: []string{"<dani>", "<fred>"},
+	},
+	{
+		message: "use tag with a list of tags",
+		query: `
+			g.V("<bob>").tag(["start", "person"]).out("<status>").all()
+		`,
+		tag:    "person",
+		expect: []string{"<bob>"},
+	},
+	{
+		message: "use tag with multiple tags",
+		query: `
+			g.V("<bob>").tag("start", "person").out("<status>").all()
+		`,
+		tag:    "start",
+		expect: []string{"<bob>"},
+	},
+	{
+		message: "issue #254",
+		query:   `g.V({"id":"<alice>"}).all()`,
+		expect:  nil, err: true,
+	},
+	{
+		message: "roundtrip values",
+		query: `
+		v = g.V("<bob>").toValue()
+		s = g.V(v).out("<status>").toValue()
+		g.V(s).all()
+		`,
+		expect: []string{"cool_person"},
+	},
+	{
+		message: "roundtrip values (tag map)",
+		query: `
+		v = g.V("<bob>").tagValue()
+		s = g.V(v.id).out("<status>").tagValue()
+		g.V(s.id).all()
+		`,
+		expect: []string{"cool_person"},
+	},
+	{
+		message: "use toValueTags",
+		query: `
+		v = g.V("<dani>").save("<status>", "status").toValueTags()
+		g.emit(v.id + " " + v.status)
+		g.emit(g.V("<alice>").out("<status>").toValueTags())
+		`,
+		expect: []string{"<dani> cool_person"},
+	},
+	{
+		message: "use forEachTags",
+		query: `
+			g.V("<bob>", "<dani>", "<greg>").save("<status>", "status").forEachTags(2, function(o) {
+				g.emit(o.id + " " + o.status)
+			})
+		`,
+		expect: []string{"<bob> cool_person", "<dani> cool_person"},
+	},
+	{
+		message: "show ToArray",
+		query: `
+			arr = g.V("<bob>").in("<follows>").toArray()
+			for (i in arr) g.emit(arr[i]);
+		`,
+		expect: []string{"<alice>", "<charlie>", "<dani>"},
+	},
+	{
+		message: "show ToArray with limit",
+		query: `
+			arr = g.V("<bob>").in("<follows>").toArray(2)
+			for (i in arr) g.emit(arr[i]);
+		`,
+		expect: []string{"<alice>", "<dani>"},
+	},
+	{
+		message: "show InValues",
+		query: `
+			arr = g.V("<bob>").inValues("<follows>")
+			for (i in arr) g.emit(arr[i]);
+		`,
+		expect: []string{"<alice>", "<charlie>", "<dani>"},
+	},
+	{
+		message: "show OutValues",
+		query: `
+			arr = g.V("<dani>").outValues(["<follows>", "<status>"])
+			for (i in arr) g.emit(arr[i]);
+		`,
+		expect: []string{"<bob>", "<greg>", "cool_person"},
+	},
+	{
+		message: "show OutValues with limit",
+		query: `
+			g.emit(g.V("<dani>").outValues("<follows>", 1).length)
+		`,
+		expect: []string{"1"},
+	},
+	{
+		message: "show ForEach",
+		query: `
+			g.V("<bob>").in("<follows>").forEach(function(o){g.emit(o.id)});
+		`,
+		expect: []string{"<alice>", "<charlie>", "<dani>"},
+	},
+	{
+		message: "show ForEach with limit",
+		query: `
+			g.V("<bob>").in("<follows>").forEach(2, function(o){g.emit(o.id)});
+		`,
+		expect: []string{"<alice>", "<dani>"},
+	},
+	{
+		message: "use .forEach() with a limit on nodes",
+		query: `
+			g.V("<dani>").save("<follows>", "target").forEach(1, true, function(o){g.emit(o.target)});
+		`,
+		expect: []string{"<bob>", "<greg>"},
+	},
+	{
+		message: "use .forEach() with a limit on nodes (multiple nodes)",
+		query: `
+			g.V("<dani>", "<charlie>").save("<follows>", "target").order().forEach(1, true, function(o){g.emit(o.target)});
+		`,
+		expect: []string{"<bob>", "<dani>"},
+	},
+	{
+		message: "use .forEach() with a limit on callbacks",
+		query: `
+			g.V("<dani>").save("<follows>", "target").forEach(1, false, function(o){g.emit(o.id)});
+		`,
+		expect: []string{"<dani>"},
+	},
+	{
+		message: "use .countProgress()",
+		query: `
+			var n = g.V().out("<follows>").countProgress(function(n){ g.emit("at " + n) }, 3)
+			g.emit(n)
+		`,
+		expect: []string{"at 3", "at 6", "8"},
+	},
+	{
+		message: "use .countProgress() with invalid interval",
+		query: `
+			g.V().countProgress(function(n){}, 0)
+		`,
+		err: true,
+	},
+	{
+		message: "clone paths",
+		query: `
+			var alice = g.V('<alice>')
+			g.emit(alice.toValue())
+			var out = alice.out('<follows>')
+			g.emit(out.toValue())
+			g.emit(alice.toValue())
+		`,
+		expect: []string{"<alice>", "<bob>", "<alice>"},
+	},
+	{
+		message: "default namespaces",
+		query: `
+			g.addDefaultNamespaces()
+			g.emit(g.IRI('rdf:type'))
+		`,
+		expect: []string{"<http://www.w3.org/1999/02/22-rdf-syntax-ns#type>"},
+	},
+	{
+		message: "add namespace",
+		query: `
+			g.addNamespace('ex','http://example.net/')
+			g.emit(g.IRI('ex:alice'))
+		`,
+		expect: []string{"<http://example.net/alice>"},
+	},
+	{
+		message: "expand curie",
+		query: `
+			g.addNamespace('ex','http://example.net/')
+			g.emit(curie('ex:alice'))
+			g.emit(curie('foo:bar'))
+			g.emit(curie('http://example.org/bob'))
+		`,
+		expect: []string{"<http://example.net/alice>", "<foo:bar>", "<http://example.org/bob>"},
+	},
+	{
+		message: "recursive follow",
+		query: `
+			g.V("<charlie>").followRecursive("<follows>").all();
+		`,
+		expect: []string{"<bob>", "<dani>", "<fred>", "<greg>"},
+	},
+	{
+		message: "recursive follow tag",
+		query: `
+			g.V("<charlie>").followRecursive("<follows>", "depth").all();
+		`,
+		tag:    "depth",
+		expect: []string{intVal(1), intVal(1), intVal(2), intVal(2)},
+	},
+	{
+		message: "recursive follow tag with depth",
+		query: `
+			g.V("<charlie>").followRecursive(g.M().out("<follows>"), 2, "hops").forEach(function(o) {
+				g.emit(o.id + " " + o.hops)
+			})
+		`,
+		expect: []string{"<bob> 1", "<dani> 1", "<fred> 2", "<greg> 2"},
+	},
+	{
+		message: "recursive follow path",
+		query: `
+			g.V("<charlie>").followRecursive(g.V().out("<follows>")).all();
+		`,
+		expect: []string{"<bob>", "<dani>", "<fred>", "<greg>"},
+	},
+	{
+		message: "find non-existent",
+		query: `
+			g.V('<not-existing>').forEach(function(d){ g.emit(d); })
+		`,
+		expect: nil,
+	},
+	{
+		message: "default limit All",
+		query: `
+			g.V().all()
+		`,
+		limit:  issue718Limit,
+		data:   issue718Graph(),
+		expect: issue718Nodes(),
+	},
+	{
+		message: "issue #758. Verify saveOpt respects label context",
+		query: `
+			g.V("<greg>").labelContext("<smart_graph>").saveOpt("<status>", "statusTag").all()
+		`,
+		tag:    "statusTag",
+		file:   multiGraphTestFile,
+		expect: []string{"smart_person"},
+	},
+	{
+		message: "issue #758. Verify saveR respects label context.",
+		query: `
+			g.V("smart_person").labelContext("<other_graph>").saveR("<status>", "who").all()
+		`,
+		tag:    "who",
+		file:   multiGraphTestFile,
+		expect: []string{"<fred>"},
+	},
+	{
+		message: "use order",
+		query: `
+			g.V().order().all()
+		`,
+		expect: []string{
+			"<alice>",
+			"<are>",
+			"<bob>",
+			"<charlie>",
+			"<dani>",
+			"<emily>",
+			"<follows>",
+			"<fred>",
+			"<greg>",
+			"<predicates>",
+			"<smart_graph>",
+			"<status>",
+			"cool_person",
+			"smart_person",
+		},
+	},
+	{
+		message: "use descending order",
+		query: `
+			g.emit(g.V("<bob>", "<alice>", "<greg>", "<dani>").order(true).toArray())
+		`,
+		expect: []string{"[<greg> <dani> <bob> <alice>]"},
+	},
+	{
+		message: "use ascending order explicitly",
+		query: `
+			g.emit(g.V("<bob>", "<alice>", "<greg>", "<dani>").order(false).toArray())
+		`,
+		expect: []string{"[<alice> <bob> <dani> <greg>]"},
+	},
+	{
+		message: "checkpoint and resume",
+		query: `
+			var page = g.V("<alice>", "<bob>", "<charlie>").checkpoint(2)
+			g.emit(page.results)
+			page = g.V("<alice>", "<bob>", "<charlie>").checkpoint(2, page.token)
+			g.emit(page.results)
+			g.emit(page.token)
+		`,
+		expect: []string{"[<alice> <bob>]", "[<charlie>]"},
+	},
+	{
+		message: "resume from token",
+		query: `
+			var page = g.V().out("<follows>").checkpoint(2)
+			g.emit(page.results)
+			g.V().out("<follows>").resumeFrom(page.token).all()
+		`,
+		expect: []string{"[<bob> <bob> <bob>]", "<dani>", "<fred>", "<fred>", "<greg>", "<greg>"},
+	},
+	{
+		message: "resume from token of another query",
+		query: `
+			var page = g.V().out("<follows>").checkpoint(1)
+			g.V().in("<follows>").resumeFrom(page.token).all()
+		`,
+		err: true,
+	},
+	{
+		message: "resume from token of a query with a different literal",
+		query: `
+			var page = g.V("<alice>", "<bob>", "0xdead").checkpoint(1)
+			g.V("<alice>", "<bob>", "0xbeef").resumeFrom(page.token).all()
+		`,
+		err: true,
+	},
+	{
+		message: "validate morphism predicates",
+		query: `
+			var m = g.M().out("<follows>").out("<follws>").has("<status>", "cool_person").in(["<follows>", "<likes>"])
+			g.emit(m.validate())
+		`,
+		expect: []string{"[<follws> <likes>]"},
+	},
+	{
+		message: "use named morphism",
+		query: `
+			g.saveMorphism("friendOfFriend", g.M().out("<follows>").out("<follows>"))
+			g.V("<charlie>").follow(g.namedMorphism("friendOfFriend")).has("<status>", "cool_person").all()
+		`,
+		expect: []string{"<bob>", "<greg>"},
+	},
+	{
+		message: "use unknown named morphism",
+		query: `
+			g.V("<charlie>").follow(g.namedMorphism("friendOfFriend")).all()
+		`,
+		err: true,
+	},
+	{
+		message: "use named morphism with tags and sub-paths",
+		query: `
+			g.saveMorphism("coolFriend", g.M().out("<follows>").tag("friend").and(g.V().has("<status>", "cool_person")).back("friend"))
+			g.V("<charlie>").follow(g.namedMorphism("coolFriend")).all()
+		`,
+		expect: []string{"<bob>", "<dani>"},
+	},
+	{
+		message: "save morphism with a filter",
+		query: `
+			g.saveMorphism("filtered", g.M().out("<follows>").filter(regex("ob")))
+		`,
+		err: true,
+	},
+	{
+		message: "save morphism with a fixed set",
+		query: `
+			g.saveMorphism("fixed", g.M().and(g.fixedSet("<alice>")))
+		`,
+		err: true,
+	},
+	{
+		message: "save query path as a morphism",
+		query: `
+			g.saveMorphism("path", g.V("<charlie>").out("<follows>"))
+		`,
+		err: true,
+	},
+	{
+		message: "list methods",
+		query: `
+			g.methods().forEach(function(m) {
+				if (m.name == "follow" || m.name == "tag" || m.name == "V") g.emit(m.object + "." + m.name + m.signature)
+			})
+		`,
+		expect: []string{"graph.V(...)", "path.follow(path) path", "path.tag(...string) path"},
+	},
+	{
+		message: "as of date",
+		data:    asOfGraph(),
+		query: `
+			g.V("<acme>").in("<worksAt>").asOf(new Date("2018-01-01T00:00:00Z"), "<validFrom>", "<validTo>").all()
+		`,
+		expect: []string{"<alice>", "<bob>", "<dani>"},
+	},
+	{
+		message: "as of date without end predicate",
+		data:    asOfGraph(),
+		query: `
+			g.V("<acme>").in("<worksAt>").asOf(new Date("2018-01-01T00:00:00Z"), "<validFrom>").all()
+		`,
+		expect: []string{"<alice>", "<bob>", "<charlie>", "<dani>"},
+	},
+	{
+		message: "compare with a path",
+		data:    asOfGraph(),
+		query: `
+			g.V().has("<validFrom>", gt(g.V("<alice>").out("<validFrom>"))).all()
+		`,
+		expect: []string{"<bob>", "<emily>"},
+	},
+	{
+		message: "compare with a path with multiple values",
+		data:    asOfGraph(),
+		query: `
+			g.V().has("<validFrom>", gt(g.V("<alice>", "<bob>").out("<validFrom>"))).all()
+		`,
+		err: true,
+	},
+	{
+		message: "compare with a path without values",
+		data:    asOfGraph(),
+		query: `
+			g.V().has("<validFrom>", lte(g.V("<dani>").out("<validFrom>"))).all()
+		`,
+		err: true,
+	},
+	{
+		message: "as of invalid date",
+		data:    asOfGraph(),
+		query: `
+			g.V("<acme>").in("<worksAt>").asOf("2018", "<validFrom>", "<validTo>").all()
+		`,
+		err: true,
+	},
+	{
+		message: "for each batch",
+		query: `
+			g.V("<alice>", "<bob>", "<charlie>").forEachBatch(2, function(b) { g.emit(b.length) })
+		`,
+		expect: []string{"2", "1"},
+	},
+	{
+		message: "for each batch with limit",
+		query: `
+			g.V("<alice>", "<bob>", "<charlie>", "<dani>").forEachBatch(3, 2, function(b) { g.emit(b.length) })
+		`,
+		expect: []string{"2", "1"},
+	},
+	{
+		message: "graph stats",
+		query: `
+			var st = g.stats()
+			g.emit(st.quads + " " + st.nodes + " " + st.exact)
+		`,
+		expect: []string{"15 14 true"},
+	},
+	{
+		message: "count window",
+		query: `
+			var w = g.V().countWindow(0, 5)
+			g.emit(w.count + " " + w.hasMore)
+			w = g.V().countWindow(10, 5)
+			g.emit(w.count + " " + w.hasMore)
+			w = g.V().countWindow(9, 5)
+			g.emit(w.count + " " + w.hasMore)
+		`,
+		expect: []string{"5 true", "4 false", "5 false"},
+	},
+	{
+		message: "count window ignores alternative tag paths",
+		query: `
+			var w = g.V("<bob>").tag("a").both().back("a").countWindow(0, 1)
+			g.emit(w.count + " " + w.hasMore)
+		`,
+		expect: []string{"1 false"},
+	},
+	{
+		message: "use order tags",
+		query: `
+			g.V().Tag("target").order().all()
+		`,
+		tag: "target",
+		expect: []string{
+			"<alice>",
+			"<are>",
+			"<bob>",
+			"<charlie>",
+			"<dani>",
+			"<emily>",
+			"<follows>",
+			"<fred>",
+			"<greg>",
+			"<predicates>",
+			"<smart_graph>",
+			"<status>",
+			"cool_person",
+			"smart_person",
+		},
+	},
+}
+
+func asOfGraph() []quad.Quad {
+	date := func(y int) quad.Time {
+		return quad.Time(time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	return []quad.Quad{
+		quad.MakeIRI("alice", "worksAt", "acme", ""),
+		quad.Make(quad.IRI("alice"), quad.IRI("validFrom"), date(2015), nil),
+		quad.MakeIRI("bob", "worksAt", "acme", ""),
+		quad.Make(quad.IRI("bob"), quad.IRI("validFrom"), date(2018), nil),
+		quad.Make(quad.IRI("bob"), quad.IRI("validTo"), date(2020), nil),
+		quad.MakeIRI("charlie", "worksAt", "acme", ""),
+		quad.Make(quad.IRI("charlie"), quad.IRI("validFrom"), date(2010), nil),
+		quad.Make(quad.IRI("charlie"), quad.IRI("validTo"), date(2018), nil),
+		quad.MakeIRI("dani", "worksAt", "acme", ""),
+		quad.MakeIRI("emily", "worksAt", "acme", ""),
+		quad.Make(quad.IRI("emily"), quad.IRI("validFrom"), date(2019), nil),
+	}
+}
+
+func labelsGraph() []quad.Quad {
+	return []quad.Quad{
+		quad.Make(quad.IRI("color"), quad.IRI("label"), quad.LangString{Value: "color", Lang: "en"}, nil),
+		quad.Make(quad.IRI("color"), quad.IRI("label"), quad.LangString{Value: "colour", Lang: "en-GB"}, nil),
+		quad.Make(quad.IRI("color"), quad.IRI("label"), quad.LangString{Value: "couleur", Lang: "fr"}, nil),
+		quad.Make(quad.IRI("color"), quad.IRI("label"), quad.String("color"), nil),
+		quad.Make(quad.IRI("color"), quad.IRI("label"), quad.LangString{Value: "colr", Lang: "eng"}, nil),
+	}
+}
+
+func ordersGraph() []quad.Quad {
+	return []quad.Quad{
+		quad.MakeIRI("order1", "lineItem", "item1", ""),
+		quad.MakeIRI("order1", "lineItem", "item2", ""),
+		quad.MakeIRI("order2", "lineItem", "item3", ""),
+		quad.MakeIRI("order2", "lineItem", "item4", ""),
+		quad.MakeIRI("order3", "lineItem", "item5", ""),
+		quad.Make(quad.IRI("item1"), quad.IRI("price"), quad.Int(10), nil),
+		quad.Make(quad.IRI("item2"), quad.IRI("price"), quad.Int(5), nil),
+		quad.Make(quad.IRI("item3"), quad.IRI("price"), quad.Int(3), nil),
+		quad.Make(quad.IRI("item4"), quad.IRI("price"), quad.Float(2.5), nil),
+		quad.Make(quad.IRI("item5"), quad.IRI("price"), quad.String("free"), nil),
+	}
+}
+
+func runQueryGetTag(rec func(), g []quad.Quad, qu string, tag string, limit int) ([]string, error) {
+	js := makeTestSession(g)
+	ctx := context.TODO()
+	it, err := js.Execute(ctx, qu, query.Options{
 		Collation: query.Raw,
 		Limit:     limit,
 	})
 	if err != nil {
-		return nil, err
+		return nil, err
+	}
+	defer it.Close()
+	defer rec()
+
+	var results []string
+	for it.Next(ctx) {
+		data := it.Result().(*Result)
+		if data.Val == nil {
+			if val := data.Tags[tag]; val != nil {
+				results = append(results, quadValueToString(js.qs.NameOf(val)))
+			}
+		} else {
+			switch v := data.Val.(type) {
+			case string:
+				results = append(results, v)
+			default:
+				results = append(results, fmt.Sprint(v))
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func TestGizmo(t *testing.T) {
+
+	simpleGraph := testutil.LoadGraph(t, "../../data/testdata.nq")
+	multiGraph := testutil.LoadGraph(t, multiGraphTestFile)
+
+	for _, test := range testQueries {
+		test := test
+		t.Run(test.message, func(t *testing.T) {
+			rec := func() {
+				if r := recover(); r != nil {
+					t.Errorf("Unexpected panic on %s: %v", test.message, r)
+				}
+			}
+			defer rec()
+			if test.tag == "" {
+				test.tag = TopResultTag
+			}
+			quads := simpleGraph
+			if test.file == multiGraphTestFile {
+				quads = multiGraph
+			}
+
+			if test.data != nil {
+				quads = test.data
+			}
+			limit := test.limit
+			if limit == 0 {
+				limit = -1
+			}
+			got, err := runQueryGetTag(rec, quads, test.query, test.tag, limit)
+			if err != nil {
+				if test.err {
+					return //expected
+				}
+				t.Error(err)
+			}
+			sort.Strings(got)
+			sort.Strings(test.expect)
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("got: %v expected: %v", got, test.expect)
+			}
+		})
+	}
+}
+
+var issue160TestGraph = []quad.Quad{
+	quad.MakeRaw("alice", "follows", "bob", ""),
+	quad.MakeRaw("bob", "follows", "alice", ""),
+	quad.MakeRaw("charlie", "follows", "bob", ""),
+	quad.MakeRaw("dani", "follows", "charlie", ""),
+	quad.MakeRaw("dani", "follows", "alice", ""),
+	quad.MakeRaw("alice", "is", "cool", ""),
+	quad.MakeRaw("bob", "is", "not cool", ""),
+	quad.MakeRaw("charlie", "is", "cool", ""),
+	quad.MakeRaw("danie", "is", "not cool", ""),
+}
+
+func TestIssue160(t *testing.T) {
+	qu := `g.V().tag('query').out(raw('follows')).out(raw('follows')).forEach(function (item) {
+		if (item.id !== item.query) g.emit({ id: item.id });
+	})`
+	expect := []string{
+		"****\nid : alice\n",
+		"****\nid : bob\n",
+		"****\nid : bob\n",
+	}
+
+	ses := makeTestSession(issue160TestGraph)
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, qu, query.Options{
+		Collation: query.REPL,
+		Limit:     100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next(ctx) {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Unexpected panic: %v", r)
+				}
+			}()
+			got = append(got, it.Result().(string))
+		}()
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected result, got: %q expected: %q", got, expect)
+	}
+}
+
+const issue718Limit = 5
+
+func issue718Graph() []quad.Quad {
+	var quads []quad.Quad
+	for i := 0; i < issue718Limit; i++ {
+		n := fmt.Sprintf("n%d", i+1)
+		quads = append(quads, quad.MakeIRI("a", "b", n, ""))
+	}
+	return quads
+}
+
+func issue718Nodes() []string {
+	var nodes []string
+	nodes = append(nodes, "<a>", "<b>")
+	for i := 0; i < issue718Limit-2; i++ {
+		n := fmt.Sprintf("<n%d>", i+1)
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+type testMetrics struct {
+	queries   int
+	results   int
+	iterators int
+	kinds     []string
+}
+
+func (m *testMetrics) ObserveQuery(dt time.Duration, results int, err error) {
+	m.queries++
+	m.results += results
+}
+
+func (m *testMetrics) IncIterator(kind string) {
+	m.iterators++
+	m.kinds = append(m.kinds, kind)
+}
+
+func TestMetrics(t *testing.T) {
+	var m testMetrics
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).WithMetrics(&m)
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, `
+		g.V("<bob>").in("<follows>").toArray()
+		g.V("<bob>").in("<follows>").count()
+	`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for it.Next(ctx) {
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if m.queries != 2 || m.iterators != 2 || m.results != 6 {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+	for _, kind := range m.kinds {
+		if kind == "" || strings.ContainsAny(kind, "( ") {
+			t.Errorf("unexpected iterator kind: %q", kind)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ses := makeTestSession(nil)
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, `while (true) {}`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	time.AfterFunc(50*time.Millisecond, ses.Cancel)
+	if it.Next(ctx) {
+		t.Fatal("expected no results")
+	}
+	if err := it.Err(); err != context.Canceled {
+		t.Fatalf("expected cancellation error, got: %v", err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	pctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).WithContext(pctx)
+	type ctxKey struct{}
+	ctx := context.WithValue(context.TODO(), ctxKey{}, "value")
+	it, err := ses.Execute(ctx, `
+		var n = 0
+		while (true) {
+			n += g.V().out("<follows>").count()
+		}
+	`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if v := ses.ctx.Value(ctxKey{}); v != "value" {
+		t.Fatalf("values of the query context are lost, got: %v", v)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if it.Next(ctx) {
+		t.Fatal("expected no results")
+	}
+	if err := it.Err(); err != context.Canceled {
+		t.Fatalf("expected cancellation error, got: %v", err)
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	ses := makeTestSession(nil).WithScriptTimeout(50 * time.Millisecond)
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, `while (true) {}`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if it.Next(ctx) {
+		t.Fatal("expected no results")
+	}
+	if err := it.Err(); err != context.DeadlineExceeded {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	qs := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).qs
+	for _, c := range []struct {
+		query string
+		err   bool
+	}{
+		{query: `g.V("<bob>").in("<follows>").toArray()`},
+		{query: `g.V("<bob>").in("<follows>").tagArray()`},
+		{query: `g.V().toArray()`, err: true},
+		{query: `g.V().tagArray()`, err: true},
+		{query: `g.V().toArray(3)`},
+		{query: `g.V().outValues("<follows>")`, err: true},
+		{query: `g.V().all()`},
+	} {
+		_, err := runSessionQuery(NewSession(qs).WithMaxResults(3), c.query)
+		if !c.err {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %v", c.query, err)
+			}
+			continue
+		}
+		if e, ok := err.(errTooManyResults); !ok || e.Max != 3 {
+			t.Errorf("expected too many results error for %q, got: %v", c.query, err)
+		}
+	}
+}
+
+func TestInstructionLimit(t *testing.T) {
+	qs := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).qs
+	newSession := func() *Session {
+		return NewSession(qs).WithInstructionLimit(1000)
+	}
+	limitErr := errInstructionLimit{Limit: 1000}
+	for _, c := range []struct {
+		query string
+		err   error
+	}{
+		{query: `while (true) {}`, err: limitErr},
+		{query: `for (;;);`, err: limitErr},
+		{query: `var i = 0; do i++; while (true)`, err: limitErr},
+		{query: `while (true) { try { while (true) {} } catch (e) {} }`, err: limitErr},
+		{query: `function f() { return f() }; f()`, err: limitErr},
+		{query: `g.V().forEach(function(d) { while (true) {} })`, err: limitErr},
+		{query: `for (;;) if (true) g.V()`, err: limitErr},
+		{query: `for (;;) while (false);`, err: limitErr},
+		{query: `var i = 0; for (;;) i++`, err: limitErr},
+		{query: `for (var k in {a: 1}) do k++; while (false)`},
+		{query: `eval("while (true) {}")`, err: errEvalDisabled},
+		{query: `new Function("while (true) {}")()`, err: errEvalDisabled},
+		{query: `(function() {}).constructor("while (true) {}")()`, err: errEvalDisabled},
+		{query: `for (var i = 0; i < 100; i++) { g.V("<alice>").all() }`},
+		{query: `g.V().forEach(function(d) { for (var k in d) {} })`},
+		{query: `g.V("<alice>").forEach(function(d) { for (var k in d) if (k) g.emit(k) })`},
+		{query: `var f = function() {}; if (!(f instanceof Function)) throw new Error("not a function")`},
+	} {
+		_, err := runSessionQuery(newSession(), c.query)
+		if err != c.err {
+			t.Errorf("unexpected error for %q: %v", c.query, err)
+		}
+	}
+
+	// eval is restored when the limit is disabled
+	if _, err := runSessionQuery(newSession().WithInstructionLimit(0), `eval("g.V()")`); err != nil {
+		t.Error(err)
+	}
+}
+
+// blockingStore is a quad store that blocks on listing all nodes until the context is done.
+type blockingStore struct {
+	graph.QuadStore
+}
+
+func (qs blockingStore) NodesAllIterator() iterator.Shape {
+	return &blockingIterator{}
+}
+
+type blockingIterator struct {
+	iterator.Null
+}
+
+func (it *blockingIterator) Iterate() iterator.Scanner {
+	return it
+}
+
+func (it *blockingIterator) Optimize(ctx context.Context) (iterator.Shape, bool) {
+	return it, false
+}
+
+func (it *blockingIterator) Next(ctx context.Context) bool {
+	<-ctx.Done()
+	return false
+}
+
+func TestTimeout(t *testing.T) {
+	qs := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).qs
+	got, err := runSessionQuery(NewSession(qs).WithTimeout(time.Minute), `g.V("<bob>").in("<follows>").all()`)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != 3 {
+		t.Fatalf("unexpected number of results: %d", len(got))
+	}
+
+	for _, qu := range []string{
+		`g.V().all()`,
+		`g.V().toArray()`,
+		`g.emit(g.V().count())`,
+		`g.emit(g.V().hasAny())`,
+		`g.V().forEach(function(d) {})`,
+	} {
+		// iteration blocks until the context is done, thus the final always runs out of time
+		_, err = runSessionQuery(NewSession(blockingStore{qs}).WithTimeout(time.Millisecond), qu)
+		if _, ok := err.(errQueryTimeout); !ok {
+			t.Fatalf("%s: expected timeout error, got: %v", qu, err)
+		}
+	}
+}
+
+func TestResultTag(t *testing.T) {
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).WithResultTag("@id")
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, `
+		g.V("<alice>").tag("id").out("<follows>").all()
+	`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next(ctx) {
+		tags := it.Result().(*Result).Tags
+		got = append(got, quadValueToString(ses.qs.NameOf(tags["@id"])), quadValueToString(ses.qs.NameOf(tags["id"])))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"<bob>", "<alice>"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v expected: %v", got, expect)
+	}
+}
+
+func TestRelativeIRIResolution(t *testing.T) {
+	base, _ := url.Parse("http://example.com/docs/")
+	ses := makeTestSession([]quad.Quad{
+		{
+			Subject:   quad.IRI("http://example.com/docs/page.html"),
+			Predicate: quad.IRI("http://example.com/title"),
+			Object:    quad.String("Page"),
+		},
+		{
+			Subject:   quad.String("page.html"),
+			Predicate: quad.IRI("http://example.com/title"),
+			Object:    quad.String("Literal"),
+		},
+	}).WithBase(base).WithRelativeIRIResolution(true)
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, `
+		g.emit(g.V("<page.html>").out("<http://example.com/title>").toValue())
+		g.emit(g.V(iri("../docs/page.html")).out("<http://example.com/title>").toValue())
+		g.emit(g.V("page.html").out("<http://example.com/title>").toValue())
+	`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next(ctx) {
+		got = append(got, fmt.Sprint(it.Result().(*Result).Val))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"Page", "Page", "Literal"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v expected: %v", got, expect)
+	}
+}
+
+func TestStrictPredicates(t *testing.T) {
+	quads := testutil.LoadGraph(t, "../../data/testdata.nq")
+	ctx := context.TODO()
+	run := func(qu string) ([]string, error) {
+		ses := makeTestSession(quads).WithStrictPredicates(true)
+		it, err := ses.Execute(ctx, qu, query.Options{Collation: query.Raw})
+		if err != nil {
+			return nil, err
+		}
+		defer it.Close()
+		var got []string
+		for it.Next(ctx) {
+			got = append(got, fmt.Sprint(it.Result().(*Result).Val))
+		}
+		return got, it.Err()
+	}
+	got, err := run(`g.emit(g.V("<alice>").out("<follows>").toValue())`)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []string{"<bob>"}) {
+		t.Errorf("unexpected result: %v", got)
+	}
+	got, err = run(`g.emit(g.predicates().sort())`)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []string{"[<are> <follows> <status>]"}) {
+		t.Errorf("unexpected result: %v", got)
+	}
+	for _, qu := range []string{
+		`g.V().out("<follws>").all()`,
+		`g.V().in(["<follows>", "<likes>"]).all()`,
+		`g.V().has("<stats>", "cool_person").all()`,
+	} {
+		_, err = run(qu)
+		if _, ok := err.(errUnknownPredicate); !ok {
+			t.Errorf("expected unknown predicate error for %q, got: %v", qu, err)
+		}
+	}
+}
+
+func BenchmarkInternValues(b *testing.B) {
+	var quads []quad.Quad
+	for i := 0; i < 1000; i++ {
+		quads = append(quads, quad.MakeIRI(fmt.Sprintf("n%d", i), "type", "Person", ""))
+	}
+	ses := makeTestSession(quads)
+	it := ses.vm.Get("g").Export().(*graphObject).NewM().path.Out(quad.IRI("type")).BuildIteratorOn(context.TODO(), ses.qs)
+	vals, err := iterator.Iterate(context.TODO(), it).AllValues(ses.qs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		pool func() valuePool
+	}{
+		{"plain", func() valuePool { return nil }},
+		{"interned", func() valuePool { return make(valuePool) }},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pool := c.pool()
+				out := make([]interface{}, 0, len(vals))
+				for _, v := range vals {
+					out = append(out, ses.internValue(pool, v))
+				}
+			}
+		})
+	}
+}
+
+// runSessionQuery runs a query on a given session and returns sorted result nodes.
+func runSessionQuery(ses *Session, qu string) ([]string, error) {
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, qu, query.Options{Collation: query.Raw})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var got []string
+	for it.Next(ctx) {
+		data := it.Result().(*Result)
+		got = append(got, quadValueToString(ses.qs.NameOf(data.Tags[TopResultTag])))
+	}
+	sort.Strings(got)
+	return got, it.Err()
+}
+
+func TestSharedMorphisms(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	reg := NewMorphismRegistry()
+	run := func(qu string) []string {
+		got, err := runSessionQuery(makeTestSession(qs).WithMorphismRegistry(reg), qu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	run(`g.saveMorphism("friendOfFriend", g.M().out("<follows>").out("<follows>"))`)
+	got := run(`g.V("<charlie>").follow(g.namedMorphism("friendOfFriend")).has("<status>", "cool_person").all()`)
+	if exp := []string{"<bob>", "<greg>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+
+	// registry can be saved and loaded by a different process
+	data, err := json.Marshal(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg = NewMorphismRegistry()
+	if err = json.Unmarshal(data, reg); err != nil {
+		t.Fatal(err)
+	}
+	got = run(`g.V("<charlie>").follow(g.namedMorphism("friendOfFriend")).has("<status>", "cool_person").all()`)
+	if exp := []string{"<bob>", "<greg>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+}
+
+func TestSnakeCaseAliases(t *testing.T) {
+	for _, c := range []struct {
+		name, exp string
+	}{
+		{"outPredicates", "out_predicates"},
+		{"followR", "follow_r"},
+		{"saveOptR", "save_opt_r"},
+		{"saveIRIValue", "save_iri_value"},
+		{"V", "v"},
+	} {
+		if got := snakeCase(c.name); got != c.exp {
+			t.Errorf("unexpected name for %q: %q vs %q", c.name, got, c.exp)
+		}
+	}
+
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	exp := []string{"<follows>", "<status>"}
+
+	for _, qu := range []string{
+		`g.V("<bob>").outPredicates().all()`,
+		`g.V("<bob>").out_predicates().all()`,
+	} {
+		got, err := runSessionQuery(makeTestSession(qs).WithSnakeCaseAliases(true), qu)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, exp) {
+			t.Errorf("got: %v expected: %v", got, exp)
+		}
+	}
+
+	if _, err := runSessionQuery(makeTestSession(qs), `g.V("<bob>").out_predicates().all()`); err == nil {
+		t.Error("expected an error without aliases")
+	}
+
+	// aliases must not affect other objects
+	got, err := runSessionQuery(makeTestSession(qs).WithSnakeCaseAliases(true), `
+		var o = {}
+		o.out_predicates = "<bob>"
+		g.V(o.out_predicates).all()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"<bob>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+
+	// each multi-word method must have an alias
+	names := fieldNameMapper{snakeCase: true}
+	for _, rt := range []reflect.Type{reflect.TypeOf(&graphObject{}), rtPathObject} {
+		meths := jsMethods(rt)
+		aliases := make(map[string]bool)
+		for i := 0; i < rt.NumMethod(); i++ {
+			if m := rt.Method(i); strings.HasPrefix(m.Name, snakeCaseAliasPrefix) {
+				aliases[names.MethodName(rt, m)] = true
+			}
+		}
+		exp := make(map[string]bool)
+		for name := range meths {
+			if alias := snakeCase(name); meths[alias].Name == "" && strings.Contains(alias, "_") {
+				exp[alias] = true
+			}
+		}
+		if !reflect.DeepEqual(aliases, exp) {
+			t.Errorf("aliases don't match methods:\n%v\nvs\n%v", aliases, exp)
+		}
+	}
+}
+
+func TestConstructorAliases(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	exp := []string{"<bob>"}
+	for _, qu := range []string{
+		`g.V("<bob>").all()`,
+		`g.vertex("<bob>").all()`,
+		`g.newV("<bob>").all()`,
+		`g.newVertex("<bob>").all()`,
+		`g.V("<alice>").follow(g.morphism().out("<follows>")).all()`,
+		`g.V("<alice>").follow(g.newM().out("<follows>")).all()`,
+	} {
+		got, err := runSessionQuery(makeTestSession(qs).WithConstructorAliases(true), qu)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, exp) {
+			t.Errorf("got: %v expected: %v", got, exp)
+		}
+	}
+	if _, err := runSessionQuery(makeTestSession(qs), `g.vertex("<bob>").all()`); err == nil {
+		t.Error("expected an error without aliases")
+	}
+
+	// aliases must not affect other objects
+	got, err := runSessionQuery(makeTestSession(qs).WithConstructorAliases(true), `
+		var o = {}
+		var names = ["vertex", "morphism", "newV", "newM", "newVertex", "newMorphism", "newIRI"]
+		for (var i = 0; i < names.length; i++) {
+			o[names[i]] = "<bob>"
+		}
+		var vertex = "<dani>"
+		for (var i = 0; i < names.length; i++) {
+			if (o[names[i]] !== "<bob>") {
+				throw new Error("unexpected value of " + names[i] + ": " + o[names[i]])
+			}
+		}
+		g.V(o.vertex, vertex).all()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"<bob>", "<dani>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+}
+
+func TestLangValidation(t *testing.T) {
+	data := []quad.Quad{
+		quad.Make(quad.IRI("a"), quad.IRI("name"), quad.LangString{Value: "hi", Lang: "en-US"}, nil),
+		quad.Make(quad.IRI("b"), quad.IRI("name"), quad.LangString{Value: "hi", Lang: "not_a_lang"}, nil),
+	}
+	const (
+		valid   = `g.V(lang("hi", "en-US")).in("<name>").all()`
+		invalid = `g.V(lang("hi", "not_a_lang")).in("<name>").all()`
+	)
+	got, err := runSessionQuery(makeTestSession(data).WithLangValidation(true), valid)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"<a>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+	_, err = runSessionQuery(makeTestSession(data).WithLangValidation(true), invalid)
+	if err == nil || !strings.Contains(err.Error(), "invalid language tag") {
+		t.Errorf("expected an invalid tag error, got: %v", err)
+	}
+	// lenient by default
+	got, err = runSessionQuery(makeTestSession(data), invalid)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"<b>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+}
+
+func BenchmarkForEachBatch(b *testing.B) {
+	const rows = 1000000
+	quads := make([]quad.Quad, 0, rows)
+	for i := 0; i < rows; i++ {
+		quads = append(quads, quad.MakeIRI(fmt.Sprintf("n%d", i), "type", "Person", ""))
+	}
+	qs := makeTestSession(quads).qs
+	for _, c := range []struct {
+		name  string
+		query string
+	}{
+		{"forEach", `var n = 0; g.V("<Person>").in("<type>").forEach(function(d) { n++ }); g.emit(n)`},
+		{"batch=100", `var n = 0; g.V("<Person>").in("<type>").forEachBatch(100, function(d) { n += d.length }); g.emit(n)`},
+		{"batch=1000", `var n = 0; g.V("<Person>").in("<type>").forEachBatch(1000, function(d) { n += d.length }); g.emit(n)`},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ses := NewSession(qs)
+				ctx := context.TODO()
+				it, err := ses.Execute(ctx, c.query, query.Options{Collation: query.Raw})
+				if err != nil {
+					b.Fatal(err)
+				}
+				for it.Next(ctx) {
+				}
+				if err = it.Err(); err != nil {
+					b.Fatal(err)
+				}
+				it.Close()
+			}
+		})
+	}
+}
+
+func TestBlankNodeScope(t *testing.T) {
+	run := func(ses *Session, qu string) []string {
+		ctx := context.TODO()
+		it, err := ses.Execute(ctx, qu, query.Options{Collation: query.Raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var got []string
+		for it.Next(ctx) {
+			if v := it.Result().(*Result).Val; v != nil {
+				got = append(got, fmt.Sprint(v))
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	const qu = `g.emit(bnode("x") == bnode("x") ? "same" : "different"); g.emit(bnode("x") == bnode("y") ? "same" : "different"); g.emit(bnode("x"))`
+
+	got := run(makeTestSession(nil), qu)
+	if exp := []string{"same", "different", "_:x"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+
+	ses := makeTestSession(nil).WithBlankNodeScope(true)
+	got = run(ses, qu)
+	if got[0] != "same" || got[1] != "different" || got[2] == "_:x" {
+		t.Errorf("unexpected result: %v", got)
+	}
+	if b := ses.bnodes["x"]; got[2] != b.String() {
+		t.Errorf("unexpected node: %v vs %v", got[2], b)
+	}
+	ses.ResetBlankNodes()
+	if len(ses.bnodes) != 0 {
+		t.Errorf("expected no labels after reset, got: %v", ses.bnodes)
+	}
+
+	// labels are scoped to the session
+	got2 := run(makeTestSession(nil).WithBlankNodeScope(true), `g.emit(bnode("x"))`)
+	if got2[0] == got[2] {
+		t.Errorf("expected a different node in another session, got: %v", got2)
+	}
+}
+
+func TestMultiTags(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	const qu = `g.V("<alice>").tag("x").out("<follows>").tag("x").back("x").all()`
+	run := func(ses *Session) []interface{} {
+		ctx := context.TODO()
+		it, err := ses.Execute(ctx, qu, query.Options{Collation: query.JSON})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var got []interface{}
+		for it.Next(ctx) {
+			got = append(got, it.Result())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	got := run(makeTestSession(qs))
+	exp := []interface{}{
+		map[string]interface{}{"id": "<bob>", "x": "<bob>"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %#v expected: %#v", got, exp)
+	}
+	got = run(makeTestSession(qs).WithMultiTags(true))
+	exp = []interface{}{
+		map[string]interface{}{"id": "<bob>", "x": []interface{}{"<alice>", "<bob>"}},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %#v expected: %#v", got, exp)
+	}
+}
+
+func TestEmitSeq(t *testing.T) {
+	ses := makeTestSession(nil)
+	ctx := context.TODO()
+	it, err := ses.Execute(ctx, `for (var i = 0; i < 3; i++) { g.emit(i) }`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seq []int
+	for it.Next(ctx) {
+		seq = append(seq, it.Result().(*Result).Seq)
+	}
+	it.Close()
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	} else if exp := []int{1, 2, 3}; !reflect.DeepEqual(seq, exp) {
+		t.Errorf("got: %v expected: %v", seq, exp)
+	}
+}
+
+func TestMaxPathDepth(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	chain := func(n int) string {
+		return `g.V("<alice>")` + strings.Repeat(`.is("<alice>")`, n) + `.all()`
+	}
+	got, err := runSessionQuery(makeTestSession(qs).WithMaxPathDepth(20), chain(10))
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"<alice>"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
 	}
-	defer it.Close()
-	defer rec()
+	_, err = runSessionQuery(makeTestSession(qs).WithMaxPathDepth(20), chain(30))
+	if err == nil || !strings.Contains(err.Error(), errPathTooDeep{Max: 20}.Error()) {
+		t.Errorf("expected a path depth error, got: %v", err)
+	}
+}
 
-	var results []string
-	for it.Next(ctx) {
-		data := it.Result().(*Result)
-		if data.Val == nil {
-			if val := data.Tags[tag]; val != nil {
-				results = append(results, quadValueToString(js.qs.NameOf(val)))
+func TestValueConversion(t *testing.T) {
+	cases := []struct {
+		expr string
+		typ  string
+		str  string
+	}{
+		{`g.toValue("<bob>")`, "iri", `<bob>`},
+		{`g.toValue("bob", "iri")`, "iri", `<bob>`},
+		{`g.toValue("_:b1", "bnode")`, "bnode", `_:b1`},
+		{`g.toValue("<bob>", "string")`, "string", `"<bob>"`},
+		{`g.toValue("hi", "lang", "en")`, "lang", `"hi"@en`},
+		{`g.toValue("5", "typed", "xsd:integer")`, "typed", `"5"^^<xsd:integer>`},
+		{`g.toValue(1)`, "int", `"1"^^<xsd:integer>`},
+		{`g.toValue(1, "float")`, "float", `"1E+00"^^<xsd:double>`},
+		{`g.toValue("2", "int")`, "int", `"2"^^<xsd:integer>`},
+		{`g.toValue("true", "bool")`, "bool", `"True"^^<xsd:boolean>`},
+		{`g.toValue("2018-01-01T00:00:00Z", "time")`, "time", `"2018-01-01T00:00:00Z"^^<xsd:dateTime>`},
+		{`g.toValue(new Date(Date.UTC(2018, 0, 1)), "time")`, "time", `"2018-01-01T00:00:00Z"^^<xsd:dateTime>`},
+		{`g.fromValue(1.5)`, "float", `"1.5E+00"^^<xsd:double>`},
+		{`g.fromValue(g.toValue(1, "float"))`, "float", `"1E+00"^^<xsd:double>`},
+		{`g.fromValue(g.V("<alice>").toArray()[0])`, "iri", `<alice>`},
+	}
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			ses := makeTestSession(qs)
+			ctx := context.TODO()
+			it, err := ses.Execute(ctx, `var v = `+c.expr+`; g.emit([v.type(), v.toString()])`, query.Options{Collation: query.JSON})
+			if err != nil {
+				t.Fatal(err)
 			}
-		} else {
-			switch v := data.Val.(type) {
-			case string:
-				results = append(results, v)
-			default:
-				results = append(results, fmt.Sprint(v))
+			defer it.Close()
+			var got []interface{}
+			for it.Next(ctx) {
+				got = append(got, it.Result())
+			}
+			if err = it.Err(); err != nil {
+				t.Fatal(err)
+			} else if exp := []interface{}{[]interface{}{c.typ, c.str}}; !reflect.DeepEqual(got, exp) {
+				t.Errorf("got: %v expected: %v", got, exp)
 			}
+		})
+	}
+	for _, qu := range []string{
+		`g.toValue(1.5, "int")`,
+		`g.toValue("x", "bool")`,
+		`g.toValue(1, "iri")`,
+		`g.toValue(1, "unknown")`,
+		`g.toValue("x", "typed")`,
+	} {
+		_, err := runSessionQuery(makeTestSession(qs), qu)
+		if err == nil {
+			t.Errorf("expected an error for %s", qu)
+		}
+	}
+}
+
+type testLogger struct {
+	clog.Logger
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) Warningf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func (l *testLogger) V(int) bool { return false }
+
+func TestSlowQueryLog(t *testing.T) {
+	lg := &testLogger{}
+	clog.SetLogger(lg)
+	defer clog.SetLogger(nil)
+
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	const qu = `g.V("<alice>").out("<follows>").all()`
+	_, err := runSessionQuery(makeTestSession(qs).WithSlowQueryLog(time.Hour), qu)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(lg.msgs) != 0 {
+		t.Fatalf("unexpected log messages: %q", lg.msgs)
+	}
+	_, err = runSessionQuery(makeTestSession(qs).WithSlowQueryLog(time.Nanosecond), qu)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(lg.msgs) != 1 {
+		t.Fatalf("expected one log message, got: %q", lg.msgs)
+	} else if msg := lg.msgs[0]; !strings.Contains(msg, qu) || !strings.Contains(msg, "1 results") {
+		t.Errorf("unexpected log message: %q", msg)
+	}
+
+	// long queries are truncated without splitting multi-byte characters
+	lg.msgs = nil
+	long := `g.V("<alice>").out("<follows>").is("a` + strings.Repeat("ä", slowQueryMaxLen) + `").all()`
+	_, err = runSessionQuery(makeTestSession(qs).WithSlowQueryLog(time.Nanosecond), long)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(lg.msgs) != 1 {
+		t.Fatalf("expected one log message, got: %q", lg.msgs)
+	} else if msg := lg.msgs[0]; !utf8.ValidString(msg) || !strings.HasSuffix(msg, "...") {
+		t.Errorf("unexpected log message: %q", msg)
+	}
+}
+
+func TestBothUnique(t *testing.T) {
+	data := []quad.Quad{
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("b", "follows", "a", ""),
+		quad.MakeIRI("a", "follows", "c", ""),
+		quad.MakeIRI("d", "likes", "a", ""),
+	}
+	for _, c := range []struct {
+		query  string
+		expect []string
+	}{
+		{`g.V("<a>").both("<follows>").all()`, []string{"<b>", "<b>", "<c>"}},
+		{`g.V("<a>").bothUnique("<follows>").all()`, []string{"<b>", "<c>"}},
+		{`g.V("<a>").bothUnique().all()`, []string{"<b>", "<c>", "<d>"}},
+		{`g.V("<a>").bothUnique("<follows>").bothUnique("<follows>").all()`, []string{"<a>"}},
+	} {
+		got, err := runSessionQuery(makeTestSession(data), c.query)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: got: %v expected: %v", c.query, got, c.expect)
 		}
 	}
+}
+
+func TestMaterializeCache(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	ses := makeTestSession(qs)
+	ctx := context.TODO()
+	// the filter callback counts evaluations of the materialized path
+	it, err := ses.Execute(ctx, `
+		var n = 0
+		var cool = g.V().has("<status>", "cool_person").filter(function(v) { n++; return true }).materialize()
+		cool.count()
+		var first = n
+		g.V("<bob>").in("<follows>").intersect(cool).union(cool).count()
+		g.V().follow(g.M().in("<follows>")).intersect(cool).count()
+		g.emit([first, n])
+	`, query.Options{Collation: query.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []interface{}
+	for it.Next(ctx) {
+		got = append(got, it.Result().(*Result).Val)
+	}
 	if err := it.Err(); err != nil {
-		return results, err
+		t.Fatal(err)
+	} else if exp := []interface{}{[]interface{}{int64(3), int64(3)}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %#v expected: %#v", got, exp)
+	}
+
+	// cached results are not used when the path is followed from other nodes
+	res, err := runSessionQuery(makeTestSession(qs), `
+		var follows = g.V().out("<follows>").materialize()
+		follows.count()
+		g.V("<alice>").follow(follows).all()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"<bob>"}; !reflect.DeepEqual(res, exp) {
+		t.Errorf("got: %v expected: %v", res, exp)
+	}
+
+	// cached results are not reused by the next query, which may see new data
+	ses = makeTestSession(qs)
+	emitted := func(qu string) []interface{} {
+		it, err := ses.Execute(ctx, qu, query.Options{Collation: query.Raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var got []interface{}
+		for it.Next(ctx) {
+			got = append(got, it.Result().(*Result).Val)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	got = emitted(`
+		var cool = g.V().has("<status>", "cool_person").materialize()
+		g.emit(cool.count())
+	`)
+	if exp := []interface{}{int64(3)}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %#v expected: %#v", got, exp)
+	}
+	w, _ := graph.NewQuadWriter("single", ses.qs, nil)
+	if err := w.AddQuad(quad.Make(quad.IRI("zed"), quad.IRI("status"), quad.String("cool_person"), nil)); err != nil {
+		t.Fatal(err)
+	}
+	got = emitted(`g.emit(cool.count())`)
+	if exp := []interface{}{int64(4)}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %#v expected: %#v", got, exp)
 	}
-	return results, nil
 }
 
-func TestGizmo(t *testing.T) {
+func TestSeededSample(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	const qu = `g.V().sample(3).all()`
+	s1, err := runSessionQuery(makeTestSession(qs).WithSeed(42), qu)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(s1) != 3 {
+		t.Fatalf("expected 3 results, got: %v", s1)
+	}
+	s2, err := runSessionQuery(makeTestSession(qs).WithSeed(42), qu)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(s1, s2) {
+		t.Errorf("expected the same sample, got: %v and %v", s1, s2)
+	}
+}
 
-	simpleGraph := testutil.LoadGraph(t, "../../data/testdata.nq")
-	multiGraph := testutil.LoadGraph(t, multiGraphTestFile)
+func TestNow(t *testing.T) {
+	date := func(y int) quad.Time {
+		return quad.Time(time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	qs := []quad.Quad{
+		quad.Make(quad.IRI("old"), quad.IRI("expires"), date(2020), nil),
+		quad.Make(quad.IRI("new"), quad.IRI("expires"), date(2030), nil),
+	}
+	clock := func() time.Time { return time.Time(date(2025)) }
+	got, err := runSessionQuery(makeTestSession(qs).WithClock(clock), `g.V().has("<expires>", gt(now())).all()`)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []string{"<new>"}) {
+		t.Errorf("unexpected result: %v", got)
+	}
+	got, err = runSessionQuery(makeTestSession(qs).WithClock(clock), `g.V().has("<expires>", gt(timeSub(now(), duration("48000h")))).all()`)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []string{"<new>", "<old>"}) {
+		t.Errorf("unexpected result: %v", got)
+	}
+	got, err = runSessionQuery(makeTestSession(qs).WithClock(clock), `g.V().has("<expires>", lt(timeAdd(now(), "24h"))).all()`)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []string{"<old>"}) {
+		t.Errorf("unexpected result: %v", got)
+	}
+	_, err = runSessionQuery(makeTestSession(qs), `g.V().has("<expires>", gt(now(1))).all()`)
+	if err == nil {
+		t.Error("expected an error for now() with arguments")
+	}
+}
 
-	for _, test := range testQueries {
-		test := test
-		t.Run(test.message, func(t *testing.T) {
-			rec := func() {
-				if r := recover(); r != nil {
-					t.Errorf("Unexpected panic on %s: %v", test.message, r)
-				}
-			}
-			defer rec()
-			if test.tag == "" {
-				test.tag = TopResultTag
-			}
-			quads := simpleGraph
-			if test.file == multiGraphTestFile {
-				quads = multiGraph
-			}
+func TestDurationComparison(t *testing.T) {
+	dur := func(s string) quad.Value {
+		return quad.TypedString{Value: quad.String(s), Type: xsdDuration}
+	}
+	qs := []quad.Quad{
+		quad.Make(quad.IRI("short"), quad.IRI("takes"), dur("PT2H"), nil),
+		quad.Make(quad.IRI("long"), quad.IRI("takes"), dur("PT10H"), nil),
+		quad.Make(quad.IRI("text"), quad.IRI("takes"), quad.String("PT5H"), nil),
+	}
+	for _, c := range []struct {
+		query  string
+		expect []string
+	}{
+		{`g.V().has("<takes>", gt(duration("3h"))).all()`, []string{"<long>"}},
+		{`g.V().has("<takes>", lt(duration("3h"))).all()`, []string{"<short>"}},
+		{`g.V().has("<takes>", gte(duration("2h"))).all()`, []string{"<long>", "<short>"}},
+		{`g.V().has("<takes>", lte(duration("90m"))).all()`, nil},
+	} {
+		got, err := runSessionQuery(makeTestSession(qs), c.query)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: got: %v expected: %v", c.query, got, c.expect)
+		}
+	}
+}
 
-			if test.data != nil {
-				quads = test.data
-			}
-			limit := test.limit
-			if limit == 0 {
-				limit = -1
-			}
-			got, err := runQueryGetTag(rec, quads, test.query, test.tag, limit)
-			if err != nil {
-				if test.err {
-					return //expected
-				}
-				t.Error(err)
-			}
-			sort.Strings(got)
-			sort.Strings(test.expect)
-			if !reflect.DeepEqual(got, test.expect) {
-				t.Errorf("got: %v expected: %v", got, test.expect)
-			}
-		})
+func TestEmitMeta(t *testing.T) {
+	const qu = `g.emitMeta({name: "bob"}, {source: "friends"})`
+	run := func(col query.Collation) interface{} {
+		ses := makeTestSession(nil)
+		ctx := context.TODO()
+		it, err := ses.Execute(ctx, qu, query.Options{Collation: col})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var got []interface{}
+		for it.Next(ctx) {
+			got = append(got, it.Result())
+		}
+		if err = it.Err(); err != nil {
+			t.Fatal(err)
+		} else if len(got) != 1 {
+			t.Fatalf("expected one result, got: %v", got)
+		}
+		return got[0]
+	}
+	exp := map[string]interface{}{
+		"name":      "bob",
+		EmitMetaKey: map[string]interface{}{"source": "friends"},
+	}
+	if got := run(query.JSON); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got: %v expected: %v", got, exp)
+	}
+	// data and metadata are separate in raw results
+	r := run(query.Raw).(*Result)
+	if exp := map[string]interface{}{"name": "bob"}; !reflect.DeepEqual(r.Val, exp) {
+		t.Errorf("got: %v expected: %v", r.Val, exp)
+	}
+	if exp := map[string]interface{}{"source": "friends"}; !reflect.DeepEqual(r.Metadata, exp) {
+		t.Errorf("got: %v expected: %v", r.Metadata, exp)
+	}
+	for _, qu := range []string{
+		`g.emitMeta({"$meta": 1}, {source: "friends"})`,
+		`g.emit({"$meta": 1})`,
+		`g.emitMeta("bob", {source: "friends"})`,
+	} {
+		if _, err := runSessionQuery(makeTestSession(nil), qu); err == nil {
+			t.Errorf("expected an error for %s", qu)
+		}
 	}
 }
 
-var issue160TestGraph = []quad.Quad{
-	quad.MakeRaw("alice", "follows", "bob", ""),
-	quad.MakeRaw("bob", "follows", "alice", ""),
-	quad.MakeRaw("charlie", "follows", "bob", ""),
-	quad.MakeRaw("dani", "follows", "charlie", ""),
-	quad.MakeRaw("dani", "follows", "alice", ""),
-	quad.MakeRaw("alice", "is", "cool", ""),
-	quad.MakeRaw("bob", "is", "not cool", ""),
-	quad.MakeRaw("charlie", "is", "cool", ""),
-	quad.MakeRaw("danie", "is", "not cool", ""),
+func TestCaseInsensitive(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	for _, c := range []struct {
+		query  string
+		ci     bool
+		expect []string
+	}{
+		{query: `g.V().filter(like("AL%")).all()`, ci: false, expect: nil},
+		{query: `g.V().filter(like("AL%")).all()`, ci: true, expect: []string{"<alice>"}},
+		{query: `g.V().filter(like("AL%", false)).all()`, ci: true, expect: nil},
+		{query: `g.V().filter(like("AL%", true)).all()`, ci: false, expect: []string{"<alice>"}},
+		{query: `g.V().hasPrefix("AL").all()`, ci: false, expect: nil},
+		{query: `g.V().hasPrefix("AL").all()`, ci: true, expect: []string{"<alice>"}},
+		{query: `g.V().hasPrefix("AL", false).all()`, ci: true, expect: nil},
+		{query: `g.V().hasPrefix("AL", true).all()`, ci: false, expect: []string{"<alice>"}},
+		{query: `g.V().filter(regex("^AL", true)).all()`, ci: false, expect: nil},
+		{query: `g.V().filter(regex("^AL", true)).all()`, ci: true, expect: []string{"<alice>"}},
+		{query: `g.V().filter(regex("^AL", true, false)).all()`, ci: true, expect: nil},
+		{query: `g.V().filter(regex("^COOL", false, true)).all()`, ci: false, expect: []string{"cool_person"}},
+		{query: `g.V().filter(regex("^COOL", {caseInsensitive: true})).all()`, ci: false, expect: []string{"cool_person"}},
+		{query: `g.V().filter(regex("^AL", {caseInsensitive: true, includeIRIs: true})).all()`, ci: false, expect: []string{"<alice>"}},
+		{query: `g.V().filter(regex("^AL", {includeIRIs: true})).all()`, ci: true, expect: []string{"<alice>"}},
+		{query: `g.V().filter(regex("^AL", {caseInsensitive: false, includeIRIs: true})).all()`, ci: true, expect: nil},
+		// flags in the expression take precedence
+		{query: `g.V().filter(regex("(?i)^COOL", {caseInsensitive: false})).all()`, ci: false, expect: []string{"cool_person"}},
+		// exact matching is not affected
+		{query: `g.V("<ALICE>").all()`, ci: true, expect: nil},
+	} {
+		got, err := runSessionQuery(makeTestSession(qs).WithCaseInsensitive(c.ci), c.query)
+		if err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s (case insensitive: %v): got: %v, expected: %v", c.query, c.ci, got, c.expect)
+		}
+	}
 }
 
-func TestIssue160(t *testing.T) {
-	qu := `g.V().tag('query').out(raw('follows')).out(raw('follows')).forEach(function (item) {
-		if (item.id !== item.query) g.emit({ id: item.id });
-	})`
-	expect := []string{
-		"****\nid : alice\n",
-		"****\nid : bob\n",
-		"****\nid : bob\n",
+func TestSoftErrors(t *testing.T) {
+	qs := testutil.LoadGraph(t, "../../data/testdata.nq")
+	const qu = `
+		g.V("<bob>").in("<follows>").filter(regex("("), like("al%")).all()
+		g.V("<bob>").in("<follows>").filterOr(regex("("), like("al%")).all()
+		g.V("<charlie>").has("<follows>", lt(g.V("<alice>", "<dani>"))).unique().all()
+	`
+	_, err := runSessionQuery(makeTestSession(qs), qu)
+	if err == nil {
+		t.Fatal("expected an error")
 	}
 
-	ses := makeTestSession(issue160TestGraph)
+	ses := makeTestSession(qs).WithSoftErrors(true)
 	ctx := context.TODO()
-	it, err := ses.Execute(ctx, qu, query.Options{
-		Collation: query.REPL,
-		Limit:     100,
-	})
+	it, err := ses.Execute(ctx, qu, query.Options{Collation: query.JSON})
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer it.Close()
-	var got []string
+	var got []interface{}
 	for it.Next(ctx) {
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					t.Errorf("Unexpected panic: %v", r)
-				}
-			}()
-			got = append(got, it.Result().(string))
-		}()
+		got = append(got, it.Result())
+	}
+	if err = it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// invalid filters match nothing, except when combined with valid ones in filterOr
+	expect := []interface{}{
+		map[string]interface{}{"id": "<alice>"},
+		map[string]interface{}{SoftErrorsKey: []string{
+			"error parsing regexp: missing closing ): `(`",
+			"error parsing regexp: missing closing ): `(`",
+			errNotSingleValue{Got: 2}.Error(),
+		}},
 	}
-	sort.Strings(got)
 	if !reflect.DeepEqual(got, expect) {
-		t.Errorf("Unexpected result, got: %q expected: %q", got, expect)
+		t.Errorf("unexpected results:\n%#v\nvs\n%#v", got, expect)
 	}
 }
 
-const issue718Limit = 5
+func TestFixedSetOtherStore(t *testing.T) {
+	data := testutil.LoadGraph(t, "../../data/testdata.nq")
+	ses := makeTestSession(data)
+	if _, err := runSessionQuery(ses, `var fixed = g.fixedSet("<alice>")`); err != nil {
+		t.Fatal(err)
+	}
+	fixed := ses.vm.Get("fixed").Export().(*pathObject).path
+	run := func(qs graph.QuadStore) ([]quad.Value, error) {
+		it := path.StartMorphism().Follow(fixed).BuildIteratorOn(context.TODO(), qs)
+		return iterator.Iterate(context.TODO(), it).AllValues(qs)
+	}
+	got, err := run(ses.qs)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []quad.Value{quad.IRI("alice")}) {
+		t.Fatalf("unexpected result: %v", got)
+	}
+	_, err = run(makeTestSession(data).qs)
+	if err != path.ErrStoreMismatch {
+		t.Fatalf("expected store mismatch error, got: %v", err)
+	}
+}
 
-func issue718Graph() []quad.Quad {
-	var quads []quad.Quad
-	for i := 0; i < issue718Limit; i++ {
-		n := fmt.Sprintf("n%d", i+1)
-		quads = append(quads, quad.MakeIRI("a", "b", n, ""))
+func TestExec(t *testing.T) {
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq"))
+	res, err := ses.Exec(context.TODO(), `
+		g.V("<alice>").tag("person").out("<follows>").all()
+		g.emit({name: "bob"})
+		g.V("<bob>").in("<follows>").toArray().sort()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &ExecResult{
+		Paths: []map[string]quad.Value{
+			{"person": quad.IRI("alice"), TopResultTag: quad.IRI("bob")},
+		},
+		Emitted: []interface{}{map[string]interface{}{"name": "bob"}},
+		Value:   []interface{}{"<alice>", "<charlie>", "<dani>"},
+	}
+	if !reflect.DeepEqual(res, expect) {
+		t.Errorf("unexpected result:\n%#v\nvs\n%#v", res, expect)
+	}
+
+	ses = makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).WithTypedResults(true)
+	res, err = ses.Exec(context.TODO(), `g.V("<alice>").out("<follows>").toArray()`)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []interface{}{quad.IRI("bob")}; !reflect.DeepEqual(res.Value, exp) {
+		t.Errorf("unexpected value: %#v", res.Value)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ses.Exec(ctx, `g.V().all()`)
+	if err != context.Canceled {
+		t.Errorf("expected context error, got: %v", err)
 	}
-	return quads
 }
 
-func issue718Nodes() []string {
-	var nodes []string
-	nodes = append(nodes, "<a>", "<b>")
-	for i := 0; i < issue718Limit-2; i++ {
-		n := fmt.Sprintf("<n%d>", i+1)
-		nodes = append(nodes, n)
+func TestTypedResults(t *testing.T) {
+	quads := []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.Make(quad.IRI("bob"), quad.IRI("status"), quad.String("cool_person"), nil),
+		quad.Make(quad.IRI("bob"), quad.IRI("age"), quad.Int(42), nil),
+		quad.Make(quad.IRI("bob"), quad.IRI("name"), quad.LangString{Value: "Bob", Lang: "en"}, nil),
+	}
+	const qu = `
+		var vals = g.V("<alice>").out("<follows>").toArray()
+		vals = vals.concat(g.V("<bob>").out(["<status>", "<age>", "<name>"]).toArray())
+		vals.forEach(function(v) {
+			g.emit([typeof v, v.type(), v.value(), v.toString()].join(" "))
+		})
+	`
+	ctx := context.TODO()
+	run := func(ses *Session, qu string) []string {
+		it, err := ses.Execute(ctx, qu, query.Options{Collation: query.Raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var got []string
+		for it.Next(ctx) {
+			got = append(got, fmt.Sprint(it.Result().(*Result).Val))
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		return got
+	}
+	got := run(makeTestSession(quads).WithTypedResults(true), qu)
+	expect := []string{
+		`object int 42 "42"^^<xsd:integer>`,
+		`object iri <bob> <bob>`,
+		`object lang Bob "Bob"@en`,
+		`object string cool_person "cool_person"`,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %q expected: %q", got, expect)
+	}
+
+	// values are not wrapped by default
+	got = run(makeTestSession(quads), `g.emit(typeof g.V("<alice>").out("<follows>").toValue())`)
+	if expect := []string{"string"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %q expected: %q", got, expect)
+	}
+}
+
+func TestPathFingerprint(t *testing.T) {
+	qs := makeTestSession(nil).qs
+	paths := []*path.Path{
+		path.StartPath(qs).Has(quad.IRI("status"), quad.String("0xdead")),
+		path.StartPath(qs).Has(quad.IRI("status"), quad.String("0xbeef")),
+		path.StartPath(qs).Has(quad.IRI("status"), quad.Int(1)),
+		path.StartPath(qs).Out(quad.IRI("status")).Regex(regexp.MustCompile("^a")),
+		path.StartPath(qs).Out(quad.IRI("status")).Regex(regexp.MustCompile("^b")),
+	}
+	seen := make(map[string]int)
+	for i, p := range paths {
+		fp := pathFingerprint(p)
+		if j, ok := seen[fp]; ok {
+			t.Errorf("paths %d and %d have the same fingerprint", j, i)
+		}
+		seen[fp] = i
+		// the same path built again must have the same fingerprint
+		if fp2 := pathFingerprint(p.Clone()); fp != fp2 {
+			t.Errorf("unstable fingerprint for path %d", i)
+		}
+	}
+}
+
+func TestValidatePathValueMethods(t *testing.T) {
+	meths := jsMethods(reflect.TypeOf(&graphObject{}))
+	for name, m := range jsMethods(rtPathObject) {
+		meths[name] = m
+	}
+	for name := range pathValueMethods {
+		m, ok := meths[name]
+		if !ok {
+			t.Errorf("unknown method: %s", name)
+			continue
+		}
+		ret := false
+		for i := 0; i < m.Type.NumOut(); i++ {
+			ret = ret || m.Type.Out(i) == rtGojaValue
+		}
+		if !ret {
+			t.Errorf("method %s doesn't return a JS value", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		script string
+		snake  bool
+		err    *ScriptError
+	}{
+		{script: `g.V("<alice>").out("<follows>").all()`},
+		{script: `var p = g.V().toArray()
+			p.map(function(x) { return x.foo() })`},
+		{script: `g.V().tag("x").selectTags("x").slice(1)`},
+		{script: `g.V().paginate(0, 10).results.slice(1)`},
+		{script: `g.V().tag("x").distinctBy("x").slice(1)`},
+		{script: `g.V().all().slice(1)`},
+		{script: `g.V().forEachTags(function(m) {}).foo()`},
+		{script: `g.V().hasPrefix("a").outt()`, err: &ScriptError{Line: 1, Column: 22, Message: "unknown path method: outt"}},
+		{script: `g.V().out_predicates().all()`, snake: true},
+		{script: `g.V().out_predicates().all()`, err: &ScriptError{Line: 1, Column: 7, Message: "unknown path method: out_predicates"}},
+		{script: "g.V()\n\t.out(", err: &ScriptError{Line: 2, Column: 7, Message: "Unexpected end of input"}},
+		{script: `g.V().out("<follows>").outt("<x>").all()`, err: &ScriptError{Line: 1, Column: 24, Message: "unknown path method: outt"}},
+		{script: "function f() {\n  return graph.Vertx()\n}", err: &ScriptError{Line: 2, Column: 16, Message: "unknown graph method: Vertx"}},
+	} {
+		ses := makeTestSession(nil).WithSnakeCaseAliases(c.snake)
+		err := ses.Validate(c.script)
+		if c.err == nil {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", c.script, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(err, c.err) {
+			t.Errorf("%q: unexpected error: %#v, expected: %#v", c.script, err, c.err)
+		}
 	}
-	return nodes
 }
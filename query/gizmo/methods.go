@@ -0,0 +1,142 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dop251/goja"
+)
+
+var (
+	rtFunctionCall = reflect.TypeOf(goja.FunctionCall{})
+	rtGojaValue    = reflect.TypeOf((*goja.Value)(nil)).Elem()
+	rtPathObject   = reflect.TypeOf(&pathObject{})
+	rtError        = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// jsTypeName returns a name of the JS type that corresponds to a Go type of the method argument.
+func jsTypeName(rt reflect.Type) string {
+	switch rt {
+	case rtPathObject:
+		return "path"
+	case rtGojaValue:
+		return "any"
+	}
+	switch rt.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Func:
+		return "function"
+	case reflect.Slice:
+		return "array"
+	case reflect.Map, reflect.Struct, reflect.Ptr:
+		return "object"
+	}
+	return "any"
+}
+
+// methodSignature returns a signature of a method as seen from JS.
+// Methods that accept raw call arguments have a variable signature, which is written as "(...)".
+func methodSignature(m reflect.Method) string {
+	ft := m.Type
+	// first argument is a receiver
+	if ft.NumIn() == 2 && ft.In(1) == rtFunctionCall {
+		return "(...)"
+	}
+	args := make([]string, 0, ft.NumIn()-1)
+	for i := 1; i < ft.NumIn(); i++ {
+		if i == ft.NumIn()-1 && ft.IsVariadic() {
+			args = append(args, "..."+jsTypeName(ft.In(i).Elem()))
+		} else {
+			args = append(args, jsTypeName(ft.In(i)))
+		}
+	}
+	sig := "(" + strings.Join(args, ", ") + ")"
+	for i := 0; i < ft.NumOut(); i++ {
+		if rt := ft.Out(i); rt != rtError {
+			sig += " " + jsTypeName(rt)
+			break
+		}
+	}
+	return sig
+}
+
+// listMethods returns names and signatures of all methods of a given object, as they are exposed to JS.
+// Deprecated aliases that are kept for backward compatibility are skipped.
+func listMethods(object string, rt reflect.Type) []interface{} {
+	var names fieldNameMapper
+	out := make([]interface{}, 0, rt.NumMethod())
+	for i := 0; i < rt.NumMethod(); i++ {
+		m := rt.Method(i)
+		name := names.MethodName(rt, m)
+		if name == "" || strings.HasPrefix(m.Name, backwardsCompatibilityPrefix) {
+			continue
+		}
+		out = append(out, map[string]interface{}{
+			"object":    object,
+			"name":      name,
+			"signature": methodSignature(m),
+		})
+	}
+	return out
+}
+
+// Methods returns a list of all methods available on graph and path objects.
+// Each item has the following fields: object ("graph" or "path"), name and signature.
+//
+// This is intended for tools like editors and REPLs that need a list of methods for autocompletion.
+//
+//	// javascript
+//	g.emit(g.methods())
+func (g *graphObject) Methods() []interface{} {
+	out := listMethods("graph", reflect.TypeOf(g))
+	out = append(out, listMethods("path", rtPathObject)...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].(map[string]interface{}), out[j].(map[string]interface{})
+		if a["object"] != b["object"] {
+			return a["object"].(string) < b["object"].(string)
+		}
+		return a["name"].(string) < b["name"].(string)
+	})
+	return out
+}
+
+// snakeCase converts a camelCase method name to snake_case, for example outPredicates becomes out_predicates.
+// Acronyms are kept together: saveIRIValue becomes save_iri_value.
+func snakeCase(name string) string {
+	rs := []rune(name)
+	var sb strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := rs[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(rs) && unicode.IsLower(rs[i+1])) {
+				sb.WriteRune('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/cayleygraph/cayley/query/path"
+)
+
+// MorphismRegistry stores named morphisms.
+//
+// A registry can be shared between sessions (see WithMorphismRegistry) to reuse morphisms across queries.
+//
+// Morphisms are stored as a description of their steps (see path.Step), thus a registry can be saved with
+// json.Marshal and loaded by a different process. Only morphisms built from constant values can be described:
+// steps that use JS callbacks, regular expressions, value filters or nodes resolved by g.fixedSet cannot be
+// stored and are rejected by Set.
+type MorphismRegistry struct {
+	mu sync.RWMutex
+	m  map[string]namedMorphism
+}
+
+type namedMorphism struct {
+	steps []path.Step
+	path  *path.Path // restored from steps
+}
+
+func newNamedMorphism(steps []path.Step) (namedMorphism, error) {
+	p, err := path.MorphismFromSteps(steps)
+	if err != nil {
+		return namedMorphism{}, err
+	}
+	return namedMorphism{steps: steps, path: p}, nil
+}
+
+// NewMorphismRegistry creates an empty morphism registry.
+func NewMorphismRegistry() *MorphismRegistry {
+	return &MorphismRegistry{m: make(map[string]namedMorphism)}
+}
+
+// Set saves a morphism under a given name, replacing the old one, if any.
+// It returns path.ErrNotSerializable if the morphism has steps that cannot be stored.
+func (r *MorphismRegistry) Set(name string, m *path.Path) error {
+	steps, err := m.Steps()
+	if err != nil {
+		return err
+	}
+	nm, err := newNamedMorphism(steps)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.m[name] = nm
+	r.mu.Unlock()
+	return nil
+}
+
+// Get returns a morphism with a given name, or nil if it doesn't exist.
+func (r *MorphismRegistry) Get(name string) *path.Path {
+	r.mu.RLock()
+	nm, ok := r.m[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return nm.path.Clone()
+}
+
+// Names returns names of all morphisms in the registry.
+func (r *MorphismRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.m))
+	for name := range r.m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// MarshalJSON implements json.Marshaler. Morphisms are encoded as a map from the name to a list of steps.
+func (r *MorphismRegistry) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m := make(map[string][]path.Step, len(r.m))
+	for name, nm := range r.m {
+		m[name] = nm.steps
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Loaded morphisms replace morphisms with the same names.
+func (r *MorphismRegistry) UnmarshalJSON(data []byte) error {
+	var m map[string][]path.Step
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	loaded := make(map[string]namedMorphism, len(m))
+	for name, steps := range m {
+		nm, err := newNamedMorphism(steps)
+		if err != nil {
+			return fmt.Errorf("morphism %q: %v", name, err)
+		}
+		loaded[name] = nm
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.m == nil {
+		r.m = make(map[string]namedMorphism, len(loaded))
+	}
+	for name, nm := range loaded {
+		r.m[name] = nm
+	}
+	return nil
+}
+
+// SaveMorphism saves a morphism under a given name, so it can be referenced later with g.namedMorphism.
+// Signature: (name, morphism)
+//
+// The morphism is kept in the session registry; it is not written to the graph. Morphisms that use callbacks,
+// regular expressions, value filters or g.fixedSet cannot be saved, see MorphismRegistry.
+//
+//	// javascript
+//	g.saveMorphism("friendOfFriend", g.M().out("<follows>").out("<follows>"))
+func (g *graphObject) SaveMorphism(name string, m *pathObject) error {
+	if name == "" {
+		return errEmptyMorphismName
+	} else if m == nil || m.finals {
+		return errNotMorphism
+	}
+	if err := g.s.morphisms.Set(name, m.path); err != nil {
+		return errMorphismNotSerializable{Name: name, Err: err}
+	}
+	return nil
+}
+
+// NamedMorphism returns a morphism previously saved with g.saveMorphism.
+// Signature: (name)
+//
+//	// javascript
+//	g.V("<alice>").follow(g.namedMorphism("friendOfFriend")).all()
+func (g *graphObject) NamedMorphism(name string) (*pathObject, error) {
+	m := g.s.morphisms.Get(name)
+	if m == nil {
+		return nil, errUnknownMorphism{Name: name}
+	}
+	return &pathObject{s: g.s, path: m}, nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+// Session options. Each option modifies the session and returns it to allow chaining.
+
+import (
+	"context"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Metrics is an interface for collecting query statistics.
+//
+// It allows to export query activity to any monitoring system without depending on a specific metrics library.
+type Metrics interface {
+	// ObserveQuery is called each time a query final (toArray, forEach, count, etc.) is executed.
+	// Results is the number of results read by the final, for example the count returned by count().
+	ObserveQuery(dt time.Duration, results int, err error)
+	// IncIterator is called each time an iterator tree of a given kind is built for a path.
+	// The kind is a type name of the root iterator, for example "And" or "Fixed".
+	IncIterator(kind string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveQuery(dt time.Duration, results int, err error) {}
+func (nopMetrics) IncIterator(kind string)                               {}
+
+// WithContext sets a context for all queries executed by the session. Nil value resets it.
+//
+// Queries are cancelled when either this context or the context passed to Execute is done.
+// It allows to cancel queries from outside. Values are still taken from the context passed to Execute.
+func (s *Session) WithContext(ctx context.Context) *Session {
+	s.parent = ctx
+	return s
+}
+
+// WithTimeout limits the execution time of each query final (toArray, forEach, count, etc.),
+// for example to stop any query that runs longer than a few seconds. Zero or negative value disables the timeout.
+//
+// The timeout applies to each final separately, not to the whole script (see WithScriptTimeout).
+// When it expires, the iteration stops and the query fails with a timeout error that wraps context.DeadlineExceeded.
+//
+// Each final derives its deadline from the context of the running query and releases it when the final returns.
+// The query context itself is released by closing the query iterator or by calling Cancel, which must be done
+// before the session is discarded.
+func (s *Session) WithTimeout(d time.Duration) *Session {
+	s.queryTimeout = d
+	return s
+}
+
+// WithMetrics sets a metrics collector for the session. Nil value disables metrics.
+func (s *Session) WithMetrics(m Metrics) *Session {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	s.metrics = m
+	return s
+}
+
+// WithResultTag changes the name of the tag used for the node at the end of the path. Default is "id".
+//
+// The default tag will collide with user tags (and predicates saved to tags) that are also named "id",
+// in which case one of the values is silently lost. Names like "@id" help to avoid this.
+func (s *Session) WithResultTag(tag string) *Session {
+	if tag == "" {
+		tag = TopResultTag
+	}
+	s.resultTag = tag
+	return s
+}
+
+// WithTypedResults enables wrapping of values returned to JS into objects with type information.
+//
+// Each value will have the following methods: type() returns a value type (see typeOf),
+// value() returns a native JS value and toString() returns a string representation of the value.
+func (s *Session) WithTypedResults(enable bool) *Session {
+	s.typed = enable
+	return s
+}
+
+// WithBase sets a base IRI for the session. See WithRelativeIRIResolution.
+func (s *Session) WithBase(base *url.URL) *Session {
+	s.base = base
+	return s
+}
+
+// WithRelativeIRIResolution enables resolution of relative IRIs against the base IRI set with WithBase.
+//
+// Only IRI values are resolved, for example "<page.html>" or iri("page.html").
+// Plain strings like "page.html" are string literals and are never resolved.
+// IRIs that have a scheme (including prefixed names like "rdf:type") are considered absolute and are left as-is.
+//
+// Resolution applies to nodes passed to V, Is and Has.
+func (s *Session) WithRelativeIRIResolution(enable bool) *Session {
+	s.resolveIRIs = enable
+	return s
+}
+
+// WithStrictPredicates enables checks for predicates used in Out, In, Both and Has.
+// If any of predicates given as values does not exist in the graph, the query will fail with an error.
+//
+// This is useful to catch typos during development, since unknown predicates will silently produce empty results otherwise.
+// Known predicates can be listed with g.predicates().
+func (s *Session) WithStrictPredicates(enable bool) *Session {
+	s.strictPreds = enable
+	return s
+}
+
+// WithMorphismRegistry sets a registry for named morphisms. By default, each session has its own registry.
+//
+// Sharing a registry between sessions allows to save a morphism in one query and use it in the next one.
+func (s *Session) WithMorphismRegistry(r *MorphismRegistry) *Session {
+	if r == nil {
+		r = NewMorphismRegistry()
+	}
+	s.morphisms = r
+	return s
+}
+
+// WithSnakeCaseAliases enables snake_case aliases for all multi-word methods, for example out_predicates for outPredicates.
+// CamelCase names are still available. Aliases that collide with existing method names are not defined.
+//
+// This is useful when queries are generated from languages that use snake_case, like Python.
+func (s *Session) WithSnakeCaseAliases(enable bool) *Session {
+	names := s.names
+	names.snakeCase = enable
+	s.setNames(names)
+	return s
+}
+
+// WithConstructorAliases enables additional names for constructor methods of the graph object.
+// Each constructor is also available with the "new" prefix (newV for V, newMorphism for Morphism),
+// and constructors with full-word names are also available in lower case (vertex for Vertex).
+//
+// Existing names are not affected.
+func (s *Session) WithConstructorAliases(enable bool) *Session {
+	names := s.names
+	names.constructors = enable
+	s.setNames(names)
+	return s
+}
+
+// WithLangValidation enables validation of language tags passed to lang(value, tag).
+// Tags must be well-formed BCP 47 tags with known subtags, for example "en" or "en-US".
+//
+// By default any string is accepted as a language tag.
+func (s *Session) WithLangValidation(enable bool) *Session {
+	s.validLang = enable
+	return s
+}
+
+// WithCaseInsensitive sets the default case sensitivity for string matching filters: like, regex and hasPrefix.
+// The default can be overridden for each filter with the ignoreCase argument.
+//
+// It does not affect exact matching, for example is() and has() with values.
+func (s *Session) WithCaseInsensitive(enable bool) *Session {
+	s.ignoreCase = enable
+	return s
+}
+
+// WithBlankNodeScope enables session-scoped blank node labels.
+//
+// When enabled, bnode(label) returns a new unique blank node for each label the first time it is used,
+// and the same node for all following calls with this label during the session. Thus, labels can be used
+// to refer to the same node across calls without colliding with blank nodes already stored in the graph.
+// Labels can be forgotten with ResetBlankNodes.
+func (s *Session) WithBlankNodeScope(enable bool) *Session {
+	s.scopedBNodes = enable
+	return s
+}
+
+// WithMultiTags changes how tags assigned more than once on a single path are reported.
+//
+// By default, the last assigned value of a tag overwrites previous ones. When enabled, all values
+// of such a tag are collected into an array in order of assignment, while tags assigned once
+// are reported as usual. Back(tag) refers to the last assignment of the tag in both modes.
+//
+// Results with the raw collation will contain internal tag names in this mode.
+func (s *Session) WithMultiTags(enable bool) *Session {
+	s.multiTags = enable
+	return s
+}
+
+// WithMaxPathDepth sets the maximal number of steps in a single path. Adding a step to the path
+// that already reached this limit results in an error. Zero or negative value disables the check.
+//
+// Extremely long paths may exhaust the stack when the query is executed, thus the default is set
+// to DefaultMaxPathDepth.
+func (s *Session) WithMaxPathDepth(n int) *Session {
+	s.maxPathDepth = n
+	return s
+}
+
+// WithSlowQueryLog enables logging of slow queries. Each query final that runs longer than the threshold
+// writes a warning with the query text (truncated if it's too long), duration and the number of results.
+// The iterator tree is logged as well if verbose logging is enabled. Zero threshold disables the log.
+func (s *Session) WithSlowQueryLog(threshold time.Duration) *Session {
+	s.slowQuery = threshold
+	return s
+}
+
+// WithScriptTimeout limits the execution time of the whole script, including JS code that doesn't call any finals.
+// When it expires, the script is interrupted and the query fails with context.DeadlineExceeded.
+// Zero or negative value disables the timeout.
+//
+// The deadline is released when the query iterator is closed or when Cancel is called.
+func (s *Session) WithScriptTimeout(d time.Duration) *Session {
+	s.scriptTimeout = d
+	return s
+}
+
+// WithMaxResults limits the number of results collected into a single array by finals like toArray and tagArray.
+// If a query returns more results, the final fails with an error instead of returning a truncated array.
+// Zero or negative value disables the limit.
+//
+// It protects the server from running out of memory because of a single query. Results sent to the caller,
+// for example with all(), are not limited by this option.
+func (s *Session) WithMaxResults(n int) *Session {
+	s.maxResults = n
+	return s
+}
+
+// WithInstructionLimit limits the number of steps a single script can make, to stop runaway scripts,
+// for example tight loops that never call any finals. Zero or negative value disables the limit.
+//
+// A step is one loop iteration or one function call, thus the limit is approximate. When the limit is reached,
+// the script is aborted with an error that cannot be caught by the script. With the limit enabled,
+// eval and Function constructor are disabled, and columns in script error positions may shift.
+func (s *Session) WithInstructionLimit(n int64) *Session {
+	if n > 0 && s.stepFunc == "" {
+		name, err := newStepFunc()
+		if err != nil {
+			panic(err)
+		}
+		err = s.vm.GlobalObject().DefineDataProperty(name, s.vm.ToValue(s.step), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		if err != nil {
+			panic(err)
+		}
+		s.stepFunc = name
+	}
+	if err := s.restrictEval(n > 0); err != nil {
+		panic(err)
+	}
+	s.maxSteps = n
+	// scripts must be instrumented again
+	s.last, s.p = "", nil
+	return s
+}
+
+// WithSeed sets a seed for a random source used by the session, for example by sample().
+// Sessions with the same seed will return the same samples for the same queries and data.
+//
+// By default, the random source is seeded with the current time.
+func (s *Session) WithSeed(seed int64) *Session {
+	s.mu.Lock()
+	s.rnd = rand.New(rand.NewSource(seed))
+	s.mu.Unlock()
+	return s
+}
+
+// WithClock sets a time source used by the session, for example by now(). Nil value resets it to time.Now.
+func (s *Session) WithClock(now func() time.Time) *Session {
+	if now == nil {
+		now = time.Now
+	}
+	s.clock = now
+	return s
+}
+
+// WithSoftErrors enables soft errors mode. In this mode, invalid arguments of filters (lt, gt, like, regex, etc)
+// do not abort the script. Instead, the error is recorded and the filter matches no values in filter() and has().
+// Recorded errors are returned as the last result of the query, under SoftErrorsKey in JSON results.
+//
+// Other errors, including errors returned by the quad store, still abort the script.
+func (s *Session) WithSoftErrors(enable bool) *Session {
+	s.softErrors = enable
+	return s
+}
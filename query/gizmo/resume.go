@@ -0,0 +1,295 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+// Resume tokens allow to split a long scan into multiple queries.
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/query/path"
+	"github.com/cayleygraph/cayley/query/shape"
+	"github.com/cayleygraph/quad"
+	"github.com/cayleygraph/quad/pquads"
+)
+
+// resumeToken is a serialized position in the ordered result set of a path.
+//
+// Results are ordered the same way as Order does it, see iterator.CompareValues.
+type resumeToken struct {
+	// Query is a fingerprint of the path the token was created for.
+	Query string `json:"q"`
+	// After is the last node that was returned, encoded with pquads.
+	After []byte `json:"a"`
+}
+
+func (t resumeToken) encode() string {
+	data, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeResumeToken(s string) (*resumeToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidResumeToken{Reason: err.Error()}
+	}
+	var t resumeToken
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, errInvalidResumeToken{Reason: err.Error()}
+	}
+	return &t, nil
+}
+
+// pathFingerprint returns a stable identifier of the path shape.
+// It is used to make sure that the resume token is not applied to a different query.
+func pathFingerprint(p *path.Path) string {
+	var buf bytes.Buffer
+	describeValue(&buf, reflect.ValueOf(p.Shape()))
+	h := sha1.Sum(buf.Bytes())
+	return hex.EncodeToString(h[:])
+}
+
+var (
+	rtShape       = reflect.TypeOf((*shape.Shape)(nil)).Elem()
+	rtValueFilter = reflect.TypeOf((*shape.ValueFilter)(nil)).Elem()
+	rtRegexp      = reflect.TypeOf(regexp.Regexp{})
+	rtLocation    = reflect.TypeOf(time.Location{})
+)
+
+// describeValue writes a deterministic description of the shape tree to the buffer.
+//
+// Unlike %#v, it never prints addresses: pointers to shapes and filters are followed, and other pointers,
+// functions and channels are described only by their type. The latter usually refer to the quad store
+// or to the session, and their state must not affect the fingerprint.
+func describeValue(w *bytes.Buffer, rv reflect.Value) {
+	if !rv.IsValid() {
+		w.WriteString("nil")
+		return
+	}
+	rt := rv.Type()
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			w.WriteString("nil")
+			return
+		}
+		describeValue(w, rv.Elem())
+	case reflect.Ptr:
+		if rv.IsNil() {
+			fmt.Fprintf(w, "(%v)(nil)", rt)
+		} else if rt.Elem() == rtRegexp {
+			fmt.Fprintf(w, "regexp(%q)", rv.Elem().FieldByName("expr").String())
+		} else if rt.Elem() == rtLocation {
+			fmt.Fprintf(w, "location(%q)", rv.Elem().FieldByName("name").String())
+		} else if rt.Implements(rtShape) || rt.Implements(rtValueFilter) {
+			w.WriteString("&")
+			describeValue(w, rv.Elem())
+		} else {
+			fmt.Fprintf(w, "(%v)", rt)
+		}
+	case reflect.Struct:
+		fmt.Fprintf(w, "%v{", rt)
+		for i := 0; i < rv.NumField(); i++ {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(rt.Field(i).Name)
+			w.WriteString(":")
+			describeValue(w, rv.Field(i))
+		}
+		w.WriteString("}")
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			fmt.Fprintf(w, "%v(nil)", rt)
+			return
+		}
+		fmt.Fprintf(w, "%v{", rt)
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			describeValue(w, rv.Index(i))
+		}
+		w.WriteString("}")
+	case reflect.Map:
+		// map iteration order is random, thus entries are sorted by their descriptions
+		entries := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			var buf bytes.Buffer
+			describeValue(&buf, k)
+			buf.WriteString(":")
+			describeValue(&buf, rv.MapIndex(k))
+			entries = append(entries, buf.String())
+		}
+		sort.Strings(entries)
+		fmt.Fprintf(w, "%v{%s}", rt, strings.Join(entries, ", "))
+	case reflect.String:
+		fmt.Fprintf(w, "%v(%q)", rt, rv.String())
+	case reflect.Bool:
+		fmt.Fprintf(w, "%v(%v)", rt, rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(w, "%v(%d)", rt, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		fmt.Fprintf(w, "%v(%d)", rt, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(w, "%v(%v)", rt, rv.Float())
+	case reflect.Complex64, reflect.Complex128:
+		fmt.Fprintf(w, "%v(%v)", rt, rv.Complex())
+	default:
+		// functions, channels and unsafe pointers
+		fmt.Fprintf(w, "(%v)", rt)
+	}
+}
+
+// resumeAfter is a value filter that passes only values sorted after a given one.
+type resumeAfter struct {
+	after quad.Value
+}
+
+func (f resumeAfter) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		if v == nil {
+			return false, nil
+		}
+		return iterator.CompareValues(v, f.after) > 0, nil
+	})
+}
+
+var _ shape.ValueFilter = resumeAfter{}
+
+// resumePath orders the path and skips all results that were returned before the token was generated.
+// Empty token means "start from the beginning".
+func resumePath(p *path.Path, token string) (*path.Path, error) {
+	if token == "" {
+		return p.Order(), nil
+	}
+	t, err := decodeResumeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if t.Query != pathFingerprint(p) {
+		return nil, errInvalidResumeToken{Reason: "token was created for a different query"}
+	}
+	after, err := pquads.UnmarshalValue(t.After)
+	if err != nil {
+		return nil, errInvalidResumeToken{Reason: err.Error()}
+	}
+	return p.Filters(resumeAfter{after: after}).Order(), nil
+}
+
+// ResumeFrom orders the path and continues it after the position saved in the resume token.
+// Token can be obtained from Checkpoint.
+//
+// The token is bound to the path it was created for, thus it must be applied at the same point of the path
+// as Checkpoint was called.
+//
+// Signature: (token)
+//
+// Example:
+//	// javascript
+//	// Continue the scan started with g.V().out("<follows>").checkpoint(100)
+//	g.V().out("<follows>").resumeFrom(token).all()
+func (p *pathObject) ResumeFrom(token string) (*pathObject, error) {
+	np, err := resumePath(p.clonePath(), token)
+	if err != nil {
+		return nil, err
+	}
+	return p.new(np), nil
+}
+
+// Checkpoint returns `limit` ordered values and a token to resume the scan from the last returned value.
+// Returned token is null if there are no more results.
+// Signature: (limit, [token])
+//
+// Results are ordered by the node value, and the scan is resumed on the node granularity.
+// Thus, the page may contain more than `limit` results if the last node was reached via multiple paths.
+//
+// Example:
+//	// javascript
+//	var page = g.V().checkpoint(100)
+//	while (page.token) {
+//		page = g.V().checkpoint(100, page.token)
+//	}
+func (p *pathObject) Checkpoint(limit int, token string) (map[string]interface{}, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("checkpoint: expected positive limit, got: %d", limit)
+	}
+	fp := pathFingerprint(p.path)
+	np, err := resumePath(p.path.Clone(), token)
+	if err != nil {
+		return nil, err
+	}
+	it := p.new(np).buildIteratorTree()
+	it = iterator.Tag(it, p.s.resultTag)
+
+	ctx, cancel := p.s.context()
+	defer cancel()
+	start := time.Now()
+	var (
+		results = make([]interface{}, 0)
+		last    quad.Value
+		more    bool
+	)
+	// equal values are always returned on the same page, otherwise the token will skip the rest of them
+	err = iterator.Iterate(ctx, it).Paths(false).EachValue(p.s.qs, func(v quad.Value) {
+		if more {
+			return
+		}
+		if len(results) >= limit && iterator.CompareValues(v, last) != 0 {
+			more = true
+			cancel()
+			return
+		}
+		last = v
+		if o := p.s.quadValueToJS(v); o != nil {
+			results = append(results, o)
+		}
+	})
+	err = p.s.queryErr(ctx, err)
+	if more {
+		err = nil
+	}
+	p.s.observe(it, start, len(results), err)
+	if err != nil {
+		return nil, err
+	}
+	var next interface{}
+	if more {
+		after, err := pquads.MarshalValue(last)
+		if err != nil {
+			return nil, err
+		}
+		next = resumeToken{Query: fp, After: after}.encode()
+	}
+	return map[string]interface{}{
+		"results": results,
+		"token":   next,
+	}, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"errors"
+
+	"github.com/dop251/goja"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/query/shape"
+)
+
+// SoftErrorsKey is a reserved key for errors collected in soft errors mode. See WithSoftErrors.
+const SoftErrorsKey = "$errors"
+
+var errInvalidFilter = errors.New("invalid argument type in filter()")
+
+// softError records a recoverable error if soft errors are enabled. It returns false if the error
+// must be returned to the caller instead.
+func (s *Session) softError(err error) bool {
+	if !s.softErrors {
+		return false
+	}
+	s.mu.Lock()
+	s.softErrs = append(s.softErrs, err)
+	s.mu.Unlock()
+	return true
+}
+
+// takeSoftErrors returns all recorded errors and resets the list.
+func (s *Session) takeSoftErrors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := s.softErrs
+	s.softErrs = nil
+	return errs
+}
+
+// filterErr is called by filter builtins when arguments are invalid.
+// In soft errors mode it returns an invalid filter that will match no values in filter() and has().
+// Otherwise, it throws an error.
+func (s *Session) filterErr(err error) goja.Value {
+	if !s.softErrors {
+		return throwErr(s.vm, err)
+	}
+	return s.vm.ToValue(valFilter{err: err})
+}
+
+// valueFilters returns filters from valFilter arguments. Invalid filters are replaced with
+// nothingFilter in soft errors mode.
+func (s *Session) valueFilters(args []valFilter) ([]shape.ValueFilter, error) {
+	filt := make([]shape.ValueFilter, 0, len(args))
+	for _, f := range args {
+		if f.f != nil {
+			filt = append(filt, f.f)
+			continue
+		}
+		err := f.err
+		if err == nil {
+			err = errInvalidFilter
+		}
+		if !s.softError(err) {
+			return nil, err
+		}
+		filt = append(filt, nothingFilter{})
+	}
+	return filt, nil
+}
+
+var _ shape.ValueFilter = nothingFilter{}
+
+// nothingFilter is used instead of an invalid filter in soft errors mode. It matches no values,
+// so the condition with an invalid argument fails instead of being ignored.
+type nothingFilter struct{}
+
+func (nothingFilter) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	return iterator.NewNull()
+}
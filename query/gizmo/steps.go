@@ -0,0 +1,268 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+// Instruction limit for scripts. The JS engine has no hooks for counting executed instructions,
+// thus the script is instrumented instead: each loop iteration and each function call invokes
+// a step function that counts steps and interrupts the script when the limit is reached.
+// Code compiled at runtime with eval or Function is not instrumented, thus both are disabled.
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+)
+
+// newStepFunc returns a random name for the step function, thus scripts cannot redefine or shadow it.
+func newStepFunc() (string, error) {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "__step_" + hex.EncodeToString(b[:]), nil
+}
+
+// step is called by the instrumented script on each loop iteration and function call.
+func (s *Session) step(call goja.FunctionCall) goja.Value {
+	s.steps++
+	if s.steps > s.maxSteps {
+		s.vm.Interrupt(errInstructionLimit{Limit: s.maxSteps})
+	}
+	return goja.Undefined()
+}
+
+// evalFuncs holds the original functions replaced by restrictEval.
+type evalFuncs struct {
+	eval     goja.Value
+	function *goja.Object
+}
+
+// restrictEval replaces eval and the Function constructor with a function that fails, or restores them.
+func (s *Session) restrictEval(enable bool) error {
+	if enable == (s.evalOrig != nil) {
+		return nil
+	}
+	global := s.vm.GlobalObject()
+	var eval, function goja.Value
+	if enable {
+		s.evalOrig = &evalFuncs{
+			eval:     global.Get("eval"),
+			function: global.Get("Function").ToObject(s.vm),
+		}
+		disabled := s.vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+			throwErr(s.vm, errEvalDisabled)
+			return nil
+		}).ToObject(s.vm)
+		// keep instanceof Function working
+		if err := disabled.Set("prototype", s.evalOrig.function.Get("prototype")); err != nil {
+			return err
+		}
+		eval, function = disabled, disabled
+	} else {
+		eval, function = s.evalOrig.eval, s.evalOrig.function
+	}
+	// Function constructor is also available as a constructor property of any function
+	proto := s.evalOrig.function.Get("prototype").ToObject(s.vm)
+	if !enable {
+		s.evalOrig = nil
+	}
+	if err := global.DefineDataProperty("eval", eval, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+	if err := global.DefineDataProperty("Function", function, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+	return proto.DefineDataProperty("constructor", function, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
+
+type insertion struct {
+	off  int
+	text string
+}
+
+type instrumenter struct {
+	src  string
+	base int
+	call string
+	ins  []insertion
+	err  error
+}
+
+// instrument inserts a call of the step function at the beginning of each loop iteration and function body.
+//
+// Code is only inserted in the middle of existing lines, thus line numbers in error messages are preserved.
+func instrument(src, step string) (string, error) {
+	prg, err := parser.ParseFile(nil, "", src, 0)
+	if err != nil {
+		return "", err
+	}
+	v := &instrumenter{src: src, base: prg.File.Base(), call: step + "()"}
+	v.walk(reflect.ValueOf(prg))
+	if v.err != nil {
+		return "", v.err
+	}
+	sort.SliceStable(v.ins, func(i, j int) bool {
+		return v.ins[i].off < v.ins[j].off
+	})
+	buf := make([]byte, 0, len(src)+len(v.ins)*(len(v.call)+2))
+	last := 0
+	for _, in := range v.ins {
+		buf = append(buf, src[last:in.off]...)
+		buf = append(buf, in.text...)
+		last = in.off
+	}
+	buf = append(buf, src[last:]...)
+	return string(buf), nil
+}
+
+func (v *instrumenter) insert(idx file.Idx, text string) {
+	v.ins = append(v.ins, insertion{off: int(idx) - v.base, text: text})
+}
+
+// loop instruments a loop with a given body and an optional test expression.
+func (v *instrumenter) loop(body ast.Statement, test ast.Expression) {
+	switch b := body.(type) {
+	case *ast.BlockStatement:
+		v.insert(b.LeftBrace+1, v.call+";")
+		return
+	case *ast.EmptyStatement:
+		v.insert(b.Semicolon, v.call)
+		return
+	}
+	if test != nil {
+		v.insert(exprStart(test), v.call+", ")
+	} else if b, ok := body.(*ast.ExpressionStatement); ok {
+		v.insert(exprStart(b.Expression), v.call+", ")
+	} else if off, ok := v.start(body); ok {
+		// a single statement without a block; the end of statements is not always known,
+		// thus it is guarded with a condition instead of being wrapped into a block
+		v.ins = append(v.ins, insertion{off: off, text: "if (" + v.call + ", true) "})
+	} else if v.err == nil {
+		line, col := position(v.src, int(body.Idx0())-v.base)
+		v.err = &ScriptError{Line: line, Column: col, Message: "loop body must be a block with the instruction limit enabled"}
+	}
+}
+
+// start returns an offset of the statement in the source. The parser doesn't set positions of some statements,
+// thus it is found before the first nested node of the statement.
+func (v *instrumenter) start(st ast.Statement) (int, bool) {
+	var (
+		keyword string
+		off     int
+	)
+	switch st := st.(type) {
+	case *ast.ExpressionStatement:
+		return int(exprStart(st.Expression)) - v.base, true
+	case *ast.IfStatement:
+		keyword, off = "if", int(exprStart(st.Test))-v.base
+	case *ast.WhileStatement:
+		keyword, off = "while", int(exprStart(st.Test))-v.base
+	case *ast.SwitchStatement:
+		keyword, off = "switch", int(exprStart(st.Discriminant))-v.base
+	case *ast.WithStatement:
+		keyword, off = "with", int(exprStart(st.Object))-v.base
+	case *ast.ThrowStatement:
+		keyword, off = "throw", int(exprStart(st.Argument))-v.base
+	case *ast.DoWhileStatement:
+		var ok bool
+		if off, ok = v.start(st.Body); !ok {
+			return 0, false
+		}
+		keyword = "do"
+	default:
+		return int(st.Idx0()) - v.base, true
+	}
+	if off < 0 || off > len(v.src) {
+		return 0, false
+	}
+	src := strings.TrimRight(v.src[:off], " \t\r\n(")
+	if !strings.HasSuffix(src, keyword) {
+		return 0, false
+	}
+	return len(src) - len(keyword), true
+}
+
+// exprStart returns a position of the expression. The parser sets the position of a postfix operator
+// to the operator itself, thus the position of the leftmost operand is used instead.
+func exprStart(e ast.Expression) file.Idx {
+	switch e := e.(type) {
+	case *ast.UnaryExpression:
+		if e.Postfix {
+			return exprStart(e.Operand)
+		}
+	case *ast.AssignExpression:
+		return exprStart(e.Left)
+	case *ast.BinaryExpression:
+		return exprStart(e.Left)
+	case *ast.BracketExpression:
+		return exprStart(e.Left)
+	case *ast.CallExpression:
+		return exprStart(e.Callee)
+	case *ast.ConditionalExpression:
+		return exprStart(e.Test)
+	case *ast.DotExpression:
+		return exprStart(e.Left)
+	case *ast.SequenceExpression:
+		return exprStart(e.Sequence[0])
+	}
+	return e.Idx0()
+}
+
+// walk finds all loops and functions in the AST.
+func (v *instrumenter) walk(rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return
+		} else if rv.Kind() == reflect.Interface {
+			v.walk(rv.Elem())
+			return
+		}
+		switch n := rv.Interface().(type) {
+		case *ast.ForStatement:
+			v.loop(n.Body, n.Test)
+		case *ast.ForInStatement:
+			v.loop(n.Body, nil)
+		case *ast.WhileStatement:
+			v.loop(n.Body, n.Test)
+		case *ast.DoWhileStatement:
+			v.loop(n.Body, n.Test)
+		case *ast.FunctionLiteral:
+			if b, ok := n.Body.(*ast.BlockStatement); ok {
+				v.insert(b.LeftBrace+1, v.call+";")
+			}
+		}
+		v.walk(rv.Elem())
+	case reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			v.walk(rv.Index(i))
+		}
+	case reflect.Struct:
+		if rv.Type().PkgPath() != astPkg {
+			// file positions, source maps, etc
+			return
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			v.walk(rv.Field(i))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// multiTagSep separates a tag name from the sequence number of the assignment. See WithMultiTags.
+const multiTagSep = "\x00"
+
+// tagNames returns names that should be used for tags in the iterator tree.
+//
+// In multi-tags mode each assignment of a tag gets a unique name, thus values assigned to the same tag
+// on one path are not overwritten. These names are merged back when the result is built, see groupTags.
+func (s *Session) tagNames(tags []string) []string {
+	if !s.multiTags || len(tags) == 0 {
+		return tags
+	}
+	out := make([]string, 0, len(tags))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		s.tagSeq++
+		out = append(out, tag+multiTagSep+strconv.Itoa(s.tagSeq))
+	}
+	return out
+}
+
+// tagName is the same as tagNames, but for a single tag.
+func (s *Session) tagName(tag string) string {
+	return s.tagNames([]string{tag})[0]
+}
+
+// splitTag returns the tag name and the sequence number of the assignment.
+// Tags that are not renamed have a zero sequence number.
+func splitTag(tag string) (string, int) {
+	i := strings.Index(tag, multiTagSep)
+	if i < 0 {
+		return tag, 0
+	}
+	seq, _ := strconv.Atoi(tag[i+len(multiTagSep):])
+	return tag[:i], seq
+}
+
+// groupTags replaces unique tag names with the original ones.
+// If a tag was assigned more than once, its values are collected into an array, in order of assignment.
+func groupTags(m map[string]interface{}) map[string]interface{} {
+	type seqValue struct {
+		seq int
+		val interface{}
+	}
+	groups := make(map[string][]seqValue, len(m))
+	for k, v := range m {
+		name, seq := splitTag(k)
+		groups[name] = append(groups[name], seqValue{seq: seq, val: v})
+	}
+	out := make(map[string]interface{}, len(groups))
+	for name, vals := range groups {
+		if len(vals) == 1 {
+			out[name] = vals[0].val
+			continue
+		}
+		sort.Slice(vals, func(i, j int) bool {
+			return vals[i].seq < vals[j].seq
+		})
+		arr := make([]interface{}, 0, len(vals))
+		for _, v := range vals {
+			arr = append(arr, v.val)
+		}
+		out[name] = arr
+	}
+	return out
+}
+
+// lastTag returns the name of the last assignment of a tag on the path.
+func (p *pathObject) lastTag(tag string) string {
+	if !p.s.multiTags {
+		return tag
+	}
+	tags := p.path.Tags()
+	for i := len(tags) - 1; i >= 0; i-- {
+		if name, _ := splitTag(tags[i]); name == tag {
+			return tags[i]
+		}
+	}
+	return tag
+}
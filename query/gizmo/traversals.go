@@ -19,6 +19,9 @@ package gizmo
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 
@@ -73,6 +76,10 @@ func (p *pathObject) newVal(np *path.Path) goja.Value {
 	return p.s.vm.ToValue(p.new(np))
 }
 func (p *pathObject) clonePath() *path.Path {
+	if max := p.s.maxPathDepth; max > 0 && p.path.Len() >= max {
+		// deep paths may exhaust the stack when the iterator tree is built
+		throwErr(p.s.vm, errPathTooDeep{Max: max})
+	}
 	np := p.path.Clone()
 	// most likely path will be continued, so we'll put non-capped stack slice
 	// into new path object instead of preserving it in an old one
@@ -83,7 +90,19 @@ func (p *pathObject) buildIteratorTree() iterator.Shape {
 	if p.path == nil {
 		return iterator.NewNull()
 	}
-	return p.path.BuildIteratorOn(p.s.ctx, p.s.qs)
+	it := p.path.BuildIteratorOn(path.WithMaterializeCache(p.s.ctx, p.s.materialized), p.s.qs)
+	p.s.metrics.IncIterator(iteratorKind(it))
+	return it
+}
+
+// iteratorKind returns a type name of the iterator. Unlike String, it doesn't include any parameters
+// of the iterator, thus the number of different kinds is bounded.
+func iteratorKind(it iterator.Shape) string {
+	rt := reflect.TypeOf(it)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return rt.Name()
 }
 
 // Filter all paths to ones which, at this point, are on the given node.
@@ -103,6 +122,7 @@ func (p *pathObject) Is(call goja.FunctionCall) goja.Value {
 	if err != nil {
 		return throwErr(p.s.vm, err)
 	}
+	args = p.s.resolveValues(args)
 	np := p.clonePath().Is(args...)
 	return p.newVal(np)
 }
@@ -111,6 +131,10 @@ func (p *pathObject) inout(call goja.FunctionCall, in bool) goja.Value {
 	if !ok {
 		return throwErr(p.s.vm, errNoVia)
 	}
+	if err := p.s.checkPredicates(preds); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	tags = p.s.tagNames(tags)
 	np := p.clonePath()
 	if in {
 		np = np.InWithTags(tags, preds...)
@@ -196,9 +220,65 @@ func (p *pathObject) Both(call goja.FunctionCall) goja.Value {
 	if !ok {
 		return throwErr(p.s.vm, errNoVia)
 	}
-	np := p.clonePath().BothWithTags(tags, preds...)
+	if err := p.s.checkPredicates(preds); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	np := p.clonePath().BothWithTags(p.s.tagNames(tags), preds...)
+	return p.newVal(np)
+}
+
+// BothUnique is the same as Both, but returns each node only once, even if it's linked in both directions.
+// Signature: ([predicatePath], [tags])
+//
+// If the node is linked in both directions, predicate tags are set from only one of the links.
+// Nodes are unique in the whole result set, the same way as with Unique.
+//
+// Example:
+//	// javascript
+//	// Find all people in a mutual or one-way follow relationship with bob, each listed once.
+//	g.V("<bob>").bothUnique("<follows>").all()
+func (p *pathObject) BothUnique(call goja.FunctionCall) goja.Value {
+	preds, tags, ok := toViaData(exportArgs(call.Arguments))
+	if !ok {
+		return throwErr(p.s.vm, errNoVia)
+	}
+	if err := p.s.checkPredicates(preds); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	np := p.clonePath().BothUniqueWithTags(p.s.tagNames(tags), preds...)
+	return p.newVal(np)
+}
+
+// BothDir is the same as Both, but also saves the direction of each link to a tag.
+// Signature: (predicatePath, dirTag, [tags])
+//
+// The tag is set to "in" if the current node is the object of the link, and to "out" if it is the subject.
+//
+// Example:
+//	// javascript
+//	// Find all followers/followees of fred, noting the direction of each link.
+//	// Returns bob and emily with "in", and greg with "out".
+//	g.V("<fred>").bothDir("<follows>", "dir").all()
+func (p *pathObject) BothDir(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) < 2 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	dirTag, ok := args[1].(string)
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("expected string, got: %T", args[1]))
+	}
+	preds, tags, ok := toViaData(append([]interface{}{args[0]}, args[2:]...))
+	if !ok {
+		return throwErr(p.s.vm, errNoVia)
+	}
+	if err := p.s.checkPredicates(preds); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	np := p.clonePath().BothWithDirTag(p.s.tagName(dirTag), p.s.tagNames(tags), preds...)
 	return p.newVal(np)
 }
+
 func (p *pathObject) follow(ep *pathObject, rev bool) *pathObject {
 	if ep == nil {
 		return p
@@ -242,34 +322,136 @@ func (p *pathObject) FollowR(path *pathObject) *pathObject {
 	return p.follow(path, true)
 }
 
+// FollowAny follows each of the morphisms and returns the union of the results.
+// Signature: ([morphism, ...])
+//
+// Null elements of the array are ignored. An empty array results in an empty path.
+//
+// Example:
+// 	// javascript:
+//	var follows = g.Morphism().out("<follows>")
+//	var followers = g.Morphism().in("<follows>")
+//	// Returns everyone who follows bob or is followed by bob: alice, charlie, dani and fred
+//	g.V("<bob>").followAny([follows, followers]).all()
+func (p *pathObject) FollowAny(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	var morphisms []*path.Path
+	switch arg := args[0].(type) {
+	case nil:
+	case []interface{}:
+		for _, m := range arg {
+			switch m := m.(type) {
+			case nil:
+			case *path.Path:
+				morphisms = append(morphisms, m)
+			default:
+				return throwErr(p.s.vm, fmt.Errorf("followAny: expected a morphism, got: %T", m))
+			}
+		}
+	default:
+		return throwErr(p.s.vm, fmt.Errorf("followAny: expected an array of morphisms, got: %T", arg))
+	}
+	np := p.clonePath().FollowAny(morphisms...)
+	return p.newVal(np)
+}
+
+// If follows one morphism from the nodes that match the condition, and another morphism from the rest of the nodes.
+// Signature: (condition, thenMorphism, [elseMorphism])
+//
+// The condition is a path or a morphism; the node matches the condition if it is a part of the condition path.
+// If elseMorphism is omitted or null, nodes that don't match the condition are passed unchanged.
+//
+// Example:
+// 	// javascript:
+//	var cool = g.M().has("<status>", "cool_person")
+//	// Returns people followed by cool people (fred, bob and greg) and the rest of people as-is (alice and charlie)
+//	g.V("<alice>", "<bob>", "<charlie>", "<dani>").if(cool, g.M().out("<follows>")).all()
+func (p *pathObject) If(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 && len(args) != 3 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	var paths [3]*path.Path
+	for i, a := range args {
+		if sp, ok := a.(*path.Path); ok {
+			paths[i] = sp
+		} else if a != nil || i != 2 {
+			// only else branch is optional
+			return throwErr(p.s.vm, fmt.Errorf("if: expected a path or a morphism as argument %d, got: %T", i+1, a))
+		}
+	}
+	np := p.clonePath().If(paths[0], paths[1], paths[2])
+	return p.newVal(np)
+}
+
+// Repeat follows the morphism exactly N times and returns only the nodes reached on the last step.
+// Signature: (morphism, n)
+//
+// Unlike FollowRecursive, nodes reached on previous steps are not returned, and loops are not detected.
+// Zero N returns the current nodes.
+//
+// Example:
+// 	// javascript:
+//	// Returns people exactly 2 hops away from charlie: bob, fred and greg
+//	g.V("<charlie>").repeat(g.M().out("<follows>"), 2).all()
+func (p *pathObject) Repeat(m *pathObject, n int) (*pathObject, error) {
+	if m == nil {
+		return nil, errors.New("repeat: expected a morphism")
+	} else if n < 0 {
+		return nil, fmt.Errorf("repeat: expected a non-negative number of steps, got: %d", n)
+	}
+	np := p.clonePath()
+	for i := 0; i < n; i++ {
+		np = np.Follow(m.path)
+	}
+	return p.new(np), nil
+}
+
 // FollowRecursive is the same as Follow but follows the chain recursively.
+// Signature: (morphism, [maxDepth, [maxResults]], [tags])
 //
 // Starts as if at the g.M() and follows through the morphism path multiple times, returning all nodes encountered.
 //
+// The maxDepth limits the number of times the morphism is applied; zero means the default of 50 steps.
+// The maxResults limits the total number of distinct nodes returned; zero means no limit.
+// Nodes are visited level by level, thus if the results are cut off by maxResults, nodes closer to the start are
+// returned first. Nodes that were already visited are neither returned nor counted twice, thus loops in the graph
+// do not exhaust the limit. If some results were cut off, g.truncated() returns true.
+//
+// Tags are bound to the depth at which each node was reached, starting from 1 for the first application of the morphism.
+//
 // Example:
 // 	// javascript:
 //	var friend = g.Morphism().out("<follows>")
 //	// Returns all people in Charlie's network.
 //	// Returns bob and dani (from charlie), fred (from bob) and greg (from dani).
 //	g.V("<charlie>").followRecursive(friend).all()
+//	// The same, but also returns the number of hops from charlie in the "hops" tag.
+//	g.V("<charlie>").followRecursive(friend, "hops").all()
 func (p *pathObject) FollowRecursive(call goja.FunctionCall) goja.Value {
-	preds, maxDepth, tags, ok := toViaDepthData(exportArgs(call.Arguments))
+	preds, maxDepth, maxResults, tags, ok := toViaDepthData(exportArgs(call.Arguments))
 	if !ok || len(preds) == 0 {
 		return throwErr(p.s.vm, errNoVia)
 	} else if len(preds) != 1 {
 		return throwErr(p.s.vm, fmt.Errorf("expected one predicate or path for recursive follow"))
+	} else if maxResults < 0 {
+		return throwErr(p.s.vm, fmt.Errorf("expected a non-negative number of results, got: %d", maxResults))
 	}
 	np := p.clonePath()
-	np = np.FollowRecursive(preds[0], maxDepth, tags)
+	np = np.FollowRecursiveLimit(preds[0], maxDepth, maxResults, p.s.setTruncated, p.s.tagNames(tags))
 	return p.newVal(np)
 }
 
 // And is an alias for Intersect.
-func (p *pathObject) And(path *pathObject) *pathObject {
-	return p.Intersect(path)
+func (p *pathObject) And(call goja.FunctionCall) goja.Value {
+	return p.Intersect(call)
 }
 
-// Intersect filters all paths by the result of another query path.
+// Intersect filters all paths by the result of other query paths.
+// Signature: (path, [path], ...)
 //
 // This is essentially a join where, at the stage of each path, a node is shared.
 // Example:
@@ -279,15 +461,15 @@ func (p *pathObject) And(path *pathObject) *pathObject {
 //	// People followed by both charlie (bob and dani) and dani (bob and greg) -- returns bob.
 //	cFollows.Intersect(dFollows).All()
 //	// Equivalently, g.V("<charlie>").Out("<follows>").And(g.V("<dani>").Out("<follows>")).All()
-func (p *pathObject) Intersect(path *pathObject) *pathObject {
-	if path == nil {
-		return p
-	}
-	np := p.clonePath().And(path.path)
-	return p.new(np)
+//	// Multiple paths can be intersected at once.
+//	var aFollows = g.V("<alice>").Out("<follows>")
+//	cFollows.Intersect(dFollows, aFollows).All()
+func (p *pathObject) Intersect(call goja.FunctionCall) goja.Value {
+	return p.join(call, false)
 }
 
-// Union returns the combined paths of the two queries.
+// Union returns the combined paths of the queries.
+// Signature: (path, [path], ...)
 //
 // Notice that it's per-path, not per-node. Once again, if multiple paths reach the same destination,
 // they might have had different ways of getting there (and different tags).
@@ -299,17 +481,37 @@ func (p *pathObject) Intersect(path *pathObject) *pathObject {
 //	var dFollows = g.V("<dani>").Out("<follows>")
 //	// People followed by both charlie (bob and dani) and dani (bob and greg) -- returns bob (from charlie), dani, bob (from dani), and greg.
 //	cFollows.Union(dFollows).All()
-func (p *pathObject) Union(path *pathObject) *pathObject {
-	if path == nil {
-		return p
-	}
-	np := p.clonePath().Or(path.path)
-	return p.new(np)
+//	// Multiple paths can be combined at once.
+//	var aFollows = g.V("<alice>").Out("<follows>")
+//	cFollows.Union(dFollows, aFollows).All()
+func (p *pathObject) Union(call goja.FunctionCall) goja.Value {
+	return p.join(call, true)
 }
 
 // Or is an alias for Union.
-func (p *pathObject) Or(path *pathObject) *pathObject {
-	return p.Union(path)
+func (p *pathObject) Or(call goja.FunctionCall) goja.Value {
+	return p.Union(call)
+}
+
+// join folds all paths from the arguments into the current one with And, or with Or if union is set.
+// Null arguments are ignored.
+func (p *pathObject) join(call goja.FunctionCall, union bool) goja.Value {
+	np := p.clonePath()
+	for _, a := range exportArgs(call.Arguments) {
+		if a == nil {
+			continue
+		}
+		sp, ok := a.(*path.Path)
+		if !ok {
+			return throwErr(p.s.vm, fmt.Errorf("expected path, got: %T", a))
+		}
+		if union {
+			np = np.Or(sp)
+		} else {
+			np = np.And(sp)
+		}
+	}
+	return p.newVal(np)
 }
 
 // Back returns current path to a set of nodes on a given tag, preserving all constraints.
@@ -320,7 +522,7 @@ func (p *pathObject) Or(path *pathObject) *pathObject {
 //
 // Arguments:
 //
-// * `tag`: A previous tag in the query to jump back to.
+// * `tag`: A previous tag in the query to jump back to. It is an error if the tag was never set on the path with tag().
 //
 // Example:
 // 	// javascript
@@ -336,9 +538,20 @@ func (p *pathObject) Or(path *pathObject) *pathObject {
 //	//   {"id": "<fred>", "start": "<greg>"},
 //	//   {"id": "<fred>", "start": "<greg>"}
 //	g.V().tag("start").out("<status>").back("start").in("<follows>").all()
-func (p *pathObject) Back(tag string) *pathObject {
-	np := p.clonePath().Back(tag)
-	return p.new(np)
+func (p *pathObject) Back(tag string) (*pathObject, error) {
+	name := p.lastTag(tag)
+	found := false
+	for _, t := range p.path.Tags() {
+		if t == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errUnknownTag{Tag: tag}
+	}
+	np := p.clonePath().Back(name)
+	return p.new(np), nil
 }
 
 // Tag saves a list of nodes to a given tag.
@@ -348,7 +561,8 @@ func (p *pathObject) Back(tag string) *pathObject {
 //
 // Arguments:
 //
-// * `tag`: A string or list of strings to act as a result key. The value for tag was the vertex the path was on at the time it reached "Tag"
+// * `tag`: A string or list of strings to act as a result key. The value for tag was the vertex the path was on at the time it reached "Tag".
+// Multiple tags can also be passed as separate arguments.
 // Example:
 // 	// javascript
 //	// Start from all nodes, save them into start, follow any status links, and return the result.
@@ -360,7 +574,7 @@ func (p *pathObject) Back(tag string) *pathObject {
 //	//   {"id": "smart_person", "start": "<greg>"}
 //	g.V().tag("start").out("<status>").All()
 func (p *pathObject) Tag(tags ...string) *pathObject {
-	np := p.clonePath().Tag(tags...)
+	np := p.clonePath().Tag(p.s.tagNames(tags)...)
 	return p.new(np)
 }
 
@@ -381,6 +595,9 @@ func (p *pathObject) As(tags ...string) *pathObject {
 // * `predicate`: A string for a predicate node.
 // * `object`: A string for a object node or a set of filters to find it.
 //
+// Objects and filters can be mixed in a single call. In this case the object node must either
+// be one of the listed nodes or pass all the filters.
+//
 // Example:
 // 	// javascript
 //	// Start from all nodes that follow bob -- results in alice, charlie and dani
@@ -397,57 +614,162 @@ func (p *pathObject) Has(call goja.FunctionCall) goja.Value {
 func (p *pathObject) HasR(call goja.FunctionCall) goja.Value {
 	return p.has(call, true)
 }
+
+// HasNot is the opposite of Has: it keeps only nodes which do not match the given predicate and object.
+//
+// Signature: (predicate, object)
+//
+// Arguments are the same as for Has.
+//
+// The Has constraint is evaluated as a standalone query and subtracted from the current path,
+// thus it has the same performance caveat as Except.
+//
+// Example:
+// 	// javascript
+//	// People who follow someone, but have no status -- results in alice, charlie and fred.
+//	g.V().has("<follows>").unique().hasNot("<status>").all()
+func (p *pathObject) HasNot(call goja.FunctionCall) goja.Value {
+	sub, err := p.hasArgs(path.StartPath(p.s.qs), exportArgs(call.Arguments), false)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	np := p.clonePath().Except(sub)
+	return p.newVal(np)
+}
+
 func (p *pathObject) has(call goja.FunctionCall, rev bool) goja.Value {
-	args := exportArgs(call.Arguments)
+	np, err := p.hasArgs(p.clonePath(), exportArgs(call.Arguments), rev)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return p.newVal(np)
+}
+
+// hasArgs adds a Has constraint to the path, using arguments in the same format as Has.
+func (p *pathObject) hasArgs(np *path.Path, args []interface{}, rev bool) (*path.Path, error) {
 	if len(args) == 0 {
-		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+		return nil, errArgCount{Got: len(args)}
 	}
 	via := args[0]
 	args = args[1:]
-	if vp, ok := via.(*pathObject); ok {
-		via = vp.path
-	} else {
+	if _, ok := via.(*path.Path); !ok {
 		var err error
 		via, err = toQuadValue(via)
 		if err != nil {
-			return throwErr(p.s.vm, err)
+			return nil, err
 		}
-	}
-	if len(args) > 0 {
-		var filt []shape.ValueFilter
-	loop:
-		for _, a := range args {
-			switch a := a.(type) {
-			case valFilter:
-				filt = append(filt, a.f)
-			case []valFilter:
-				for _, s := range a {
-					filt = append(filt, s.f)
-				}
-			default:
-				filt = nil
-				// failed to collect all argument as filters - switch back to nodes-only mode
-				break loop
-			}
+		if err = p.s.checkPredicates([]interface{}{via}); err != nil {
+			return nil, err
 		}
-		if len(filt) > 0 {
-			np := p.clonePath()
-			np = np.HasFilter(via, rev, filt...)
-			return p.newVal(np)
+	}
+	var (
+		vals  []interface{}
+		vfilt []valFilter
+	)
+	for _, a := range args {
+		switch a := a.(type) {
+		case valFilter:
+			vfilt = append(vfilt, a)
+		case []valFilter:
+			vfilt = append(vfilt, a...)
+		default:
+			vals = append(vals, a)
 		}
 	}
-	qv, err := toQuadValues(args)
+	filt, err := p.s.valueFilters(vfilt)
 	if err != nil {
-		return throwErr(p.s.vm, err)
+		return nil, err
+	}
+	qv, err := toQuadValues(vals)
+	if err != nil {
+		return nil, err
+	}
+	qv = p.s.resolveValues(qv)
+	return np.HasNodesOrFilter(via, rev, qv, filt...), nil
+}
+
+// HasAll is the same as calling Has for each of the given predicate and object pairs.
+// A node must match all the pairs.
+// Signature: ([[predicate, object], ...])
+//
+// Objects can be given in the same form as for Has, including filters.
+//
+// Example:
+// 	// javascript
+//	// People who follow bob and have a cool_person status -- results in dani
+//	g.V().hasAll([["<follows>", "<bob>"], ["<status>", "cool_person"]]).all()
+func (p *pathObject) HasAll(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	pairs, ok := args[0].([]interface{})
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("hasAll: expected an array of [predicate, object] pairs, got: %T", args[0]))
 	}
 	np := p.clonePath()
-	if rev {
-		np = np.HasReverse(via, qv...)
-	} else {
-		np = np.Has(via, qv...)
+	for i, e := range pairs {
+		pair, ok := e.([]interface{})
+		if !ok || len(pair) != 2 {
+			return throwErr(p.s.vm, fmt.Errorf("hasAll: expected a [predicate, object] pair at index %d, got: %v", i, e))
+		}
+		var err error
+		np, err = p.hasArgs(np, pair, false)
+		if err != nil {
+			return throwErr(p.s.vm, err)
+		}
 	}
 	return p.newVal(np)
 }
+
+// cmpOperators maps operator names accepted by HasFilter to comparison operators.
+var cmpOperators = map[string]iterator.Operator{
+	"lt": iterator.CompareLT, "<": iterator.CompareLT,
+	"lte": iterator.CompareLTE, "<=": iterator.CompareLTE,
+	"gt": iterator.CompareGT, ">": iterator.CompareGT,
+	"gte": iterator.CompareGTE, ">=": iterator.CompareGTE,
+}
+
+// HasFilter is the same as Has with a single filter, but the filter is given as an operator and a value.
+// Signature: (predicate, operator, value)
+//
+// Arguments:
+//
+// * `predicate`: A string for a predicate node.
+// * `operator`: One of the filter functions (lt, lte, gt, gte, like, regex), or an operator name: "<", "<=", ">", ">=".
+// * `value`: A value to pass to the filter.
+//
+// Example:
+// 	// javascript
+//	// People older than 30
+//	g.V().hasFilter("<age>", gt, 30).all()
+//	// The same as above
+//	g.V().hasFilter("<age>", ">", 30).all()
+func (p *pathObject) HasFilter(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 3 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 3, Got: len(call.Arguments)})
+	}
+	pred, op, val := call.Arguments[0], call.Arguments[1], call.Arguments[2]
+	var filt goja.Value
+	if fnc, ok := goja.AssertFunction(op); ok {
+		v, err := fnc(goja.Undefined(), val)
+		if err != nil {
+			return throwErr(p.s.vm, err)
+		}
+		switch v.Export().(type) {
+		case valFilter, []valFilter:
+		default:
+			return throwErr(p.s.vm, fmt.Errorf("hasFilter: expected a filter function"))
+		}
+		filt = v
+	} else if o, ok := cmpOperators[op.String()]; ok {
+		filt = p.s.cmpOp(o)(goja.FunctionCall{Arguments: []goja.Value{val}})
+	} else {
+		return throwErr(p.s.vm, fmt.Errorf("hasFilter: unknown operator: %v", op))
+	}
+	return p.has(goja.FunctionCall{This: call.This, Arguments: []goja.Value{pred, filt}}, false)
+}
+
 func (p *pathObject) save(call goja.FunctionCall, rev, opt bool) goja.Value {
 	args := exportArgs(call.Arguments)
 	if len(args) > 2 || len(args) == 0 {
@@ -462,8 +784,7 @@ func (p *pathObject) save(call goja.FunctionCall, rev, opt bool) goja.Value {
 		return throwErr(p.s.vm, fmt.Errorf("expected string, got: %T", vtag))
 	}
 	via := args[0]
-	if vp, ok := via.(*pathObject); ok {
-		via = vp.path
+	if _, ok := via.(*path.Path); ok {
 		if tag == "" {
 			return throwErr(p.s.vm, errors.New("must specify a tag name when saving a path"))
 		}
@@ -488,6 +809,7 @@ func (p *pathObject) save(call goja.FunctionCall, rev, opt bool) goja.Value {
 			}
 		}
 	}
+	tag = p.s.tagName(tag)
 	np := p.clonePath()
 	if opt {
 		if rev {
@@ -506,12 +828,13 @@ func (p *pathObject) save(call goja.FunctionCall, rev, opt bool) goja.Value {
 }
 
 // Save saves the object of all quads with predicate into tag, without traversal.
-// Signature: (predicate, tag)
+// Signature: (predicate, [tag])
 //
 // Arguments:
 //
-// * `predicate`: A string for a predicate node.
-// * `tag`: A string for a tag key to store the object node.
+// * `predicate`: A string for a predicate node, or a path of predicate nodes.
+// * `tag` (Optional): A string for a tag key to store the object node. Defaults to the predicate name.
+// Required if the predicate is a path.
 //
 // Example:
 // 	// javascript
@@ -530,6 +853,20 @@ func (p *pathObject) SaveR(call goja.FunctionCall) goja.Value {
 	return p.save(call, true, false)
 }
 
+// SaveReverse is the same as SaveR, but the tag must always be specified.
+// Signature: (predicate, tag)
+//
+// Example:
+// 	// javascript
+//	// Save who points to cool_person via "<status>" into "who"
+//	g.V("cool_person").saveReverse("<status>", "who").all()
+func (p *pathObject) SaveReverse(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 2 {
+		return throwErr(p.s.vm, errArgCount{Got: len(call.Arguments)})
+	}
+	return p.save(call, true, false)
+}
+
 // SaveOpt is the same as Save, but returns empty tags if predicate does not exists.
 func (p *pathObject) SaveOpt(call goja.FunctionCall) goja.Value {
 	return p.save(call, false, true)
@@ -558,12 +895,49 @@ func (p *pathObject) Except(path *pathObject) *pathObject {
 	return p.new(np)
 }
 
+// ExceptBy removes all paths with a value of the tag that is also found in the same tag of the given path.
+// Paths without the tag are kept.
+// Signature: (path, tag)
+//
+// Unlike Except, it compares values of the tag instead of the nodes at the end of the paths. Thus, it allows
+// to filter results using an exclusion list for a node that is not at the end of the path.
+// All values of the tag in the given path are loaded into memory.
+//
+// Example:
+// 	// javascript
+//	// Who of alice, charlie and dani follows someone other than bob -- returns charlie (dani) and dani (greg).
+//	var blocked = g.V("<bob>").tag("target")
+//	g.V("<alice>", "<charlie>", "<dani>").tag("who").out("<follows>").tag("target").exceptBy(blocked, "target").tagArray()
+func (p *pathObject) ExceptBy(path *pathObject, tag string) (*pathObject, error) {
+	if path == nil {
+		return nil, errors.New("exceptBy: expected a path")
+	} else if tag == "" {
+		return nil, errors.New("exceptBy: expected a tag name")
+	}
+	np := p.clonePath().ExceptBy(path.path, p.lastTag(tag), path.lastTag(tag))
+	return p.new(np), nil
+}
+
 // Unique removes duplicate values from the path.
 func (p *pathObject) Unique() *pathObject {
 	np := p.clonePath().Unique()
 	return p.new(np)
 }
 
+// Materialize loads all results of the path into memory when it's evaluated for the first time.
+// Following scans of the path, for example when it is used in Intersect or Union, are served from memory
+// for the rest of the query. If there are too many results, the path is evaluated as usual.
+//
+// Example:
+//	// javascript
+//	// Expensive sub-query is evaluated only once.
+//	var cool = g.V().has("<status>", "cool_person").materialize()
+//	g.V("<bob>").in("<follows>").intersect(cool).all()
+func (p *pathObject) Materialize() *pathObject {
+	np := p.clonePath().Materialize()
+	return p.new(np)
+}
+
 // Difference is an alias for Except.
 func (p *pathObject) Difference(path *pathObject) *pathObject {
 	return p.Except(path)
@@ -607,7 +981,7 @@ func (p *pathObject) OutPredicates() *pathObject {
 //	// returns {"id":"<bob>", "pred":"<follows>"}
 //	g.V("<bob>").SaveInPredicates("pred").All()
 func (p *pathObject) SaveInPredicates(tag string) *pathObject {
-	np := p.clonePath().SavePredicates(true, tag)
+	np := p.clonePath().SavePredicates(true, p.s.tagName(tag))
 	return p.new(np)
 }
 
@@ -619,7 +993,7 @@ func (p *pathObject) SaveInPredicates(tag string) *pathObject {
 //	// returns {"id":"<bob>", "pred":"<follows>"}
 //	g.V("<bob>").SaveInPredicates("pred").All()
 func (p *pathObject) SaveOutPredicates(tag string) *pathObject {
-	np := p.clonePath().SavePredicates(false, tag)
+	np := p.clonePath().SavePredicates(false, p.s.tagName(tag))
 	return p.new(np)
 }
 
@@ -652,38 +1026,331 @@ func (p *pathObject) LabelContext(call goja.FunctionCall) goja.Value {
 	if !ok {
 		return throwErr(p.s.vm, errNoVia)
 	}
-	np := p.clonePath().LabelContextWithTags(tags, labels...)
+	np := p.clonePath().LabelContextWithTags(p.s.tagNames(tags), labels...)
 	return p.newVal(np)
 }
 
+// ClearLabelContext removes the subgraph context set by LabelContext, thus the following traversals consider all subgraphs.
+// It is the same as labelContext(null).
+//
+// Example:
+// 	// javascript
+//	// Find all people followed by people with statuses in the smart_graph.
+//	g.V().labelContext("<smart_graph>").in("<status>").clearLabelContext().in("<follows>").all()
+func (p *pathObject) ClearLabelContext() *pathObject {
+	np := p.clonePath().LabelContext()
+	return p.new(np)
+}
+
 // Filter applies constraints to a set of nodes. Can be used to filter values by range or match strings.
-func (p *pathObject) Filter(args ...valFilter) (*pathObject, error) {
+//
+// Arguments are either filters (lt, gt, regex, etc) or JS callbacks of the form `function(value)`.
+// A node must pass all the filters and all the callbacks must return true for it.
+func (p *pathObject) Filter(args ...goja.Value) (*pathObject, error) {
 	if len(args) == 0 {
 		return nil, errArgCount{Got: len(args)}
 	}
-	filt := make([]shape.ValueFilter, 0, len(args))
-	for _, f := range args {
-		if f.f == nil {
-			return nil, errors.New("invalid argument type in filter()")
+	var (
+		vfilt []valFilter
+		fncs  []goja.Callable
+	)
+	for _, a := range args {
+		if fnc, ok := goja.AssertFunction(a); ok {
+			fncs = append(fncs, fnc)
+			continue
 		}
-		filt = append(filt, f.f)
+		switch f := a.Export().(type) {
+		case valFilter:
+			vfilt = append(vfilt, f)
+		case []valFilter:
+			vfilt = append(vfilt, f...)
+		default:
+			return nil, fmt.Errorf("filter: expected a filter or a function, got: %T", f)
+		}
+	}
+	filt, err := p.s.valueFilters(vfilt)
+	if err != nil {
+		return nil, err
+	}
+	if len(fncs) != 0 {
+		filt = append(filt, filterCallback{s: p.s, fns: fncs})
 	}
 	np := p.clonePath().Filters(filt...)
 	return p.new(np), nil
 }
 
+// FilterOr is the same as Filter, but a node must pass at least one of the filters or callbacks.
+// Signature: (filterOrCallback...)
+//
+// Example:
+// 	// javascript
+//	// People following bob, which either sort before "b" or have "li" in their names -- returns alice and charlie
+//	g.V("<bob>").in("<follows>").filterOr(lt(iri("b")), function(v) { return v.indexOf("li") >= 0 }).all()
+func (p *pathObject) FilterOr(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) == 0 {
+		return throwErr(p.s.vm, errArgCount{Got: 0})
+	}
+	var (
+		vfilt []valFilter
+		filt  []shape.ValueFilter
+	)
+	for _, a := range call.Arguments {
+		if fnc, ok := goja.AssertFunction(a); ok {
+			filt = append(filt, filterCallback{s: p.s, fns: []goja.Callable{fnc}})
+			continue
+		}
+		switch f := a.Export().(type) {
+		case valFilter:
+			vfilt = append(vfilt, f)
+		case []valFilter:
+			vfilt = append(vfilt, f...)
+		default:
+			return throwErr(p.s.vm, fmt.Errorf("filterOr: expected a filter or a function, got: %T", f))
+		}
+	}
+	vf, err := p.s.valueFilters(vfilt)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	filt = append(vf, filt...)
+	np := p.clonePath().Filters(shape.AnyOf{Filters: filt})
+	return p.newVal(np)
+}
+
+// HasPrefix keeps only string values and IRIs that start with a given prefix.
+// Signature: (prefix, [ignoreCase])
+//
+// It is the same as filter(like("prefix%")), but the prefix is matched literally
+// and backends may use it for an efficient range lookup.
+// As with like, ignoreCase defaults to the case sensitivity of the session.
+//
+// Example:
+// 	// javascript
+//	// Nodes with IRIs starting with "f" -- results in follows and fred
+//	g.V().hasPrefix("f").all()
+func (p *pathObject) HasPrefix(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 && len(call.Arguments) != 2 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(call.Arguments)})
+	}
+	prefix, ok := call.Argument(0).Export().(string)
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("hasPrefix: expected string, got: %T", call.Argument(0).Export()))
+	}
+	ignoreCase := p.s.ignoreCase
+	if len(call.Arguments) > 1 {
+		if ignoreCase, ok = call.Argument(1).Export().(bool); !ok {
+			return throwErr(p.s.vm, fmt.Errorf("hasPrefix: expected bool as second argument"))
+		}
+	}
+	np := p.clonePath().Filters(shape.Prefix{Prefix: prefix, IgnoreCase: ignoreCase})
+	return p.newVal(np)
+}
+
+// Between keeps only values within a range, checking both bounds at once.
+// Signature: (low, high, [inclusive])
+//
+// Bounds must be both numbers or both times. Bounds are included in the range, unless inclusive is false.
+// Integers and floats are compared numerically with each other; other values are compared the same way as with lt and gt.
+//
+// Example:
+// 	// javascript
+//	// Items with a price from 3 to 5, inclusive
+//	g.V().out("<price>").between(3, 5).all()
+func (p *pathObject) Between(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 && len(args) != 3 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	inclusive := true
+	if len(args) == 3 {
+		b, ok := args[2].(bool)
+		if !ok {
+			return throwErr(p.s.vm, fmt.Errorf("between: expected bool, got: %T", args[2]))
+		}
+		inclusive = b
+	}
+	var bounds [2]quad.Value
+	for i := range bounds {
+		v, err := toQuadValue(args[i])
+		if err != nil {
+			return throwErr(p.s.vm, err)
+		}
+		bounds[i] = v
+	}
+	if k1, k2 := boundKind(bounds[0]), boundKind(bounds[1]); k1 == "" || k1 != k2 {
+		return throwErr(p.s.vm, errBoundTypes{Low: bounds[0], High: bounds[1]})
+	}
+	np := p.clonePath().Filters(shape.Between{Low: bounds[0], High: bounds[1], Inclusive: inclusive})
+	return p.newVal(np)
+}
+
+// boundKind returns the kind of a range bound: "number" or "time". It returns an empty string for other values.
+func boundKind(v quad.Value) string {
+	switch v.(type) {
+	case quad.Int, quad.Float:
+		return "number"
+	case quad.Time:
+		return "time"
+	}
+	return ""
+}
+
+// LangMatches keeps only language-tagged strings with a tag that matches a given language range.
+// Signature: (range)
+//
+// Tags are matched according to basic filtering from RFC 4647, ignoring the case: range "en" matches
+// "en" and "en-US", but not "eng". Range "*" matches any tag. Values without a language tag are filtered out.
+//
+// Example:
+// 	// javascript
+//	// English labels of all nodes, including regional variants like "en-GB"
+//	g.V().out("<label>").langMatches("en").all()
+func (p *pathObject) LangMatches(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(call.Arguments)})
+	}
+	rng, ok := call.Argument(0).Export().(string)
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("langMatches: expected string, got: %T", call.Argument(0).Export()))
+	} else if !validLangRange(rng) {
+		return throwErr(p.s.vm, fmt.Errorf("langMatches: invalid language range: %q", rng))
+	}
+	np := p.clonePath().Filters(shape.LangMatches{Range: rng})
+	return p.newVal(np)
+}
+
+// validLangRange checks if the string is a basic language range: "*" or subtags of 1-8 alphanumeric characters,
+// separated by "-" (the first subtag must consist of letters only).
+func validLangRange(rng string) bool {
+	if rng == "*" {
+		return true
+	}
+	for i, sub := range strings.Split(rng, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for _, r := range sub {
+			isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+			if !isLetter && (i == 0 || r < '0' || r > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Datatype keeps only typed literals with one of the given datatypes.
+// Signature: (datatype, [datatype...], [matchStrings])
+//
+// Datatypes are IRIs, either as iri() values or strings; prefixed names are expanded using session namespaces.
+// Native values like numbers and times are matched by their datatype, e.g. xsd:integer or xsd:dateTime.
+// If matchStrings is true, plain strings are matched as xsd:string. Other values are filtered out.
+//
+// Example:
+// 	// javascript
+//	// Only integer values of all properties
+//	g.V().out().datatype("<http://www.w3.org/2001/XMLSchema#integer>").all()
+func (p *pathObject) Datatype(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	var strs bool
+	if n := len(args); n > 0 {
+		if b, ok := args[n-1].(bool); ok {
+			strs, args = b, args[:n-1]
+		}
+	}
+	if len(args) == 0 {
+		return throwErr(p.s.vm, errArgCount{Got: len(call.Arguments)})
+	}
+	types := make([]quad.IRI, 0, len(args))
+	for _, a := range args {
+		var iri quad.IRI
+		switch a := a.(type) {
+		case quad.IRI:
+			iri = a
+		case string:
+			if v, ok := quad.StringToValue(a).(quad.IRI); ok {
+				iri = v
+			} else {
+				iri = quad.IRI(a)
+			}
+		default:
+			return throwErr(p.s.vm, fmt.Errorf("datatype: expected IRI, got: %T", a))
+		}
+		types = append(types, quad.IRI(p.s.ns.FullIRI(string(iri))))
+	}
+	np := p.clonePath().Filters(shape.Datatype{Types: types, Strings: strs})
+	return p.newVal(np)
+}
+
+// AsOf keeps only nodes that are valid at a given date.
+// Signature: (date, startPredicate, [endPredicate])
+//
+// Arguments:
+//
+// * `date`: A date to check, either a JS Date or a time value.
+// * `startPredicate`: A predicate with the start of the validity interval (inclusive), or null.
+// * `endPredicate` (Optional): A predicate with the end of the validity interval (exclusive), or null.
+//
+// Nodes without a start or an end value are treated as valid since or until any date.
+//
+// Example:
+//	// javascript
+//	// employees of the company as of the beginning of 2018
+//	g.V("<acme>").in("<worksAt>").asOf(new Date("2018-01-01"), "<validFrom>", "<validTo>").all()
+func (p *pathObject) AsOf(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) < 2 || len(args) > 3 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	date, err := toQuadValue(args[0])
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	t, ok := date.(quad.Time)
+	if !ok {
+		return throwErr(p.s.vm, fmt.Errorf("asOf: expected a date, got: %T", args[0]))
+	}
+	var preds [2]interface{}
+	for i, a := range args[1:] {
+		if a == nil {
+			continue
+		}
+		pred, err := toQuadValue(a)
+		if err != nil {
+			return throwErr(p.s.vm, err)
+		}
+		if err = p.s.checkPredicates([]interface{}{pred}); err != nil {
+			return throwErr(p.s.vm, err)
+		}
+		preds[i] = pred
+	}
+	np := p.clonePath().AsOf(time.Time(t), preds[0], preds[1])
+	return p.newVal(np)
+}
+
 // Limit limits a number of nodes for current path.
 //
 // Arguments:
 //
 // * `limit`: A number of nodes to limit results to.
 //
+// Negative limit returns all nodes except the last -limit ones, similar to slices in Python.
+// The path has to read -limit nodes ahead in this case, so they will be kept in memory.
+// Zero limit means no limit.
+//
 // Example:
 // 	// javascript
 //	// Start from all nodes that follow bob, and limit them to 2 nodes -- results in alice and charlie
 //	g.V().has("<follows>", "<bob>").limit(2).all()
+//	// Skip the last node -- results in alice and charlie
+//	g.V().has("<follows>", "<bob>").limit(-1).all()
 func (p *pathObject) Limit(limit int) *pathObject {
-	np := p.clonePath().Limit(int64(limit))
+	np := p.clonePath()
+	if limit < 0 {
+		np = np.SkipLast(int64(-limit))
+	} else {
+		np = np.Limit(int64(limit))
+	}
 	return p.new(np)
 }
 
@@ -702,8 +1369,43 @@ func (p *pathObject) Skip(offset int) *pathObject {
 	return p.new(np)
 }
 
-func (p *pathObject) Order() *pathObject {
-	np := p.clonePath().Order()
+// Order returns values from the path in ascending order.
+// Signature: ([desc])
+//
+// Arguments:
+//
+// * `desc` (Optional): If true, values are returned in descending order.
+//
+// Example:
+//	// javascript
+//	// Newest nodes first
+//	g.V().has("<createdAt>").order(true).limit(10).all()
+func (p *pathObject) Order(desc ...bool) (*pathObject, error) {
+	if len(desc) > 1 {
+		return nil, errArgCount{Got: len(desc)}
+	}
+	np := p.clonePath()
+	if len(desc) == 1 && desc[0] {
+		np = np.OrderDesc()
+	} else {
+		np = np.Order()
+	}
+	return p.new(np), nil
+}
+
+// Sample returns a random subset of up to N nodes from the path.
+// Signature: (n)
+//
+// All nodes are loaded into memory before the sample is taken, the same way as with Order.
+// Sampled nodes are returned in the same order as Order would return them.
+// See WithSeed session option to get reproducible samples.
+//
+// Example:
+//	// javascript
+//	// Start from all nodes that follow bob, and select 2 of them.
+//	g.V().has("<follows>", "<bob>").sample(2).all()
+func (p *pathObject) Sample(n int) *pathObject {
+	np := p.clonePath().Sample(n, p.s.random())
 	return p.new(np)
 }
 
@@ -729,19 +1431,19 @@ func (p *pathObject) CapitalizedFollowR(path *pathObject) *pathObject {
 func (p *pathObject) CapitalizedFollowRecursive(call goja.FunctionCall) goja.Value {
 	return p.FollowRecursive(call)
 }
-func (p *pathObject) CapitalizedAnd(path *pathObject) *pathObject {
-	return p.And(path)
+func (p *pathObject) CapitalizedAnd(call goja.FunctionCall) goja.Value {
+	return p.And(call)
 }
-func (p *pathObject) CapitalizedIntersect(path *pathObject) *pathObject {
-	return p.Intersect(path)
+func (p *pathObject) CapitalizedIntersect(call goja.FunctionCall) goja.Value {
+	return p.Intersect(call)
 }
-func (p *pathObject) CapitalizedUnion(path *pathObject) *pathObject {
-	return p.Union(path)
+func (p *pathObject) CapitalizedUnion(call goja.FunctionCall) goja.Value {
+	return p.Union(call)
 }
-func (p *pathObject) CapitalizedOr(path *pathObject) *pathObject {
-	return p.Or(path)
+func (p *pathObject) CapitalizedOr(call goja.FunctionCall) goja.Value {
+	return p.Or(call)
 }
-func (p *pathObject) CapitalizedBack(tag string) *pathObject {
+func (p *pathObject) CapitalizedBack(tag string) (*pathObject, error) {
 	return p.Back(tag)
 }
 func (p *pathObject) CapitalizedTag(tags ...string) *pathObject {
@@ -795,7 +1497,7 @@ func (p *pathObject) CapitalizedSaveOutPredicates(tag string) *pathObject {
 func (p *pathObject) CapitalizedLabelContext(call goja.FunctionCall) goja.Value {
 	return p.LabelContext(call)
 }
-func (p *pathObject) CapitalizedFilter(args ...valFilter) (*pathObject, error) {
+func (p *pathObject) CapitalizedFilter(args ...goja.Value) (*pathObject, error) {
 	return p.Filter(args...)
 }
 func (p *pathObject) CapitalizedLimit(limit int) *pathObject {
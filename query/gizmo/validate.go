@@ -0,0 +1,225 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+)
+
+// ScriptError is an error in a script found by Validate.
+type ScriptError struct {
+	// Line and Column of the error, starting from 1. Both are zero if the position is unknown.
+	Line, Column int
+	Message      string
+}
+
+func (e *ScriptError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Validate checks the script without executing it. It returns a *ScriptError for syntax errors
+// and for calls to unknown methods of graph and path objects.
+//
+// Only chains of calls that start with the graph object (g or graph) are checked for unknown methods,
+// and the check stops at the first call that doesn't return a path, for example toArray.
+// Method aliases enabled for the session are taken into account.
+func (s *Session) Validate(script string) error {
+	prg, err := parser.ParseFile(nil, "", script, 0)
+	if err != nil {
+		if list, ok := err.(parser.ErrorList); ok && len(list) != 0 {
+			e := list[0]
+			return &ScriptError{Line: e.Position.Line, Column: e.Position.Column, Message: e.Message}
+		}
+		return &ScriptError{Message: err.Error()}
+	}
+	if _, err = goja.CompileAST(prg, false); err != nil {
+		return &ScriptError{Message: err.Error()}
+	}
+	v := &validator{
+		s:      s,
+		seen:   make(map[file.Idx]struct{}),
+		graph:  s.vm.Get("graph").ToObject(s.vm),
+		path:   s.vm.ToValue(&pathObject{s: s}).ToObject(s.vm),
+		gmeths: jsMethods(reflect.TypeOf(&graphObject{})),
+		pmeths: jsMethods(rtPathObject),
+	}
+	v.walk(reflect.ValueOf(prg))
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sort.Slice(v.errs, func(i, j int) bool {
+		return v.errs[i].idx < v.errs[j].idx
+	})
+	e := v.errs[0]
+	line, col := position(script, int(e.idx)-prg.File.Base())
+	return &ScriptError{Line: line, Column: col, Message: e.msg}
+}
+
+// position converts an offset in the source to a line and a column.
+func position(src string, off int) (line, col int) {
+	if off < 0 || off > len(src) {
+		return 0, 0
+	}
+	src = src[:off]
+	line = strings.Count(src, "\n") + 1
+	col = off - strings.LastIndex(src, "\n")
+	return line, col
+}
+
+// jsMethods returns methods of a Go type by their names in JS.
+func jsMethods(rt reflect.Type) map[string]reflect.Method {
+	var names fieldNameMapper
+	out := make(map[string]reflect.Method, rt.NumMethod())
+	for i := 0; i < rt.NumMethod(); i++ {
+		m := rt.Method(i)
+		if name := names.MethodName(rt, m); name != "" {
+			out[name] = m
+		}
+	}
+	return out
+}
+
+// pathValueMethods lists methods that return a path as a JS value. Other methods that return a JS value
+// may return anything, thus the check stops at them.
+var pathValueMethods = map[string]bool{
+	// graph
+	"V": true, "Vertex": true, "fixedSet": true,
+	// path
+	"is": true, "in": true, "out": true, "both": true, "bothUnique": true, "bothDir": true,
+	"followAny": true, "followRecursive": true, "if": true,
+	"and": true, "intersect": true, "union": true, "or": true,
+	"has": true, "hasR": true, "hasNot": true, "hasAll": true, "hasFilter": true, "hasPrefix": true,
+	"save": true, "saveR": true, "saveReverse": true, "saveOpt": true, "saveOptR": true,
+	"labelContext": true, "filterOr": true, "between": true, "langMatches": true, "datatype": true, "asOf": true,
+	// backward compatibility
+	"Is": true, "In": true, "Out": true, "Both": true, "FollowRecursive": true,
+	"And": true, "Intersect": true, "Union": true, "Or": true, "Has": true, "HasR": true,
+	"Save": true, "SaveR": true, "SaveOpt": true, "SaveOptR": true, "LabelContext": true,
+}
+
+type objKind int
+
+const (
+	objUnknown = objKind(iota)
+	objGraph
+	objPath
+)
+
+type validateErr struct {
+	idx file.Idx
+	msg string
+}
+
+type validator struct {
+	s      *Session
+	seen   map[file.Idx]struct{}
+	errs   []validateErr
+	graph  *goja.Object
+	path   *goja.Object
+	gmeths map[string]reflect.Method
+	pmeths map[string]reflect.Method
+}
+
+var (
+	rtCallExpression = reflect.TypeOf(&ast.CallExpression{})
+	astPkg           = rtCallExpression.Elem().PkgPath()
+)
+
+// walk finds all call expressions in the AST.
+func (v *validator) walk(rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return
+		}
+		if rv.Type() == rtCallExpression {
+			v.kindOf(rv.Interface().(*ast.CallExpression))
+		}
+		v.walk(rv.Elem())
+	case reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			v.walk(rv.Index(i))
+		}
+	case reflect.Struct:
+		if rv.Type().PkgPath() != astPkg {
+			// file positions, source maps, etc
+			return
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			v.walk(rv.Field(i))
+		}
+	}
+}
+
+// kindOf returns the kind of object returned by an expression, and checks method calls along the way.
+func (v *validator) kindOf(e ast.Expression) objKind {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if e.Name == "g" || e.Name == "graph" {
+			return objGraph
+		}
+	case *ast.CallExpression:
+		dot, ok := e.Callee.(*ast.DotExpression)
+		if !ok {
+			return objUnknown
+		}
+		kind := v.kindOf(dot.Left)
+		if kind == objUnknown {
+			return objUnknown
+		}
+		name := dot.Identifier.Name
+		obj, meths, typ := v.graph, v.gmeths, "graph"
+		if kind == objPath {
+			obj, meths, typ = v.path, v.pmeths, "path"
+		}
+		if val := obj.Get(name); val == nil || goja.IsUndefined(val) {
+			if _, ok := v.seen[dot.Identifier.Idx]; !ok {
+				v.seen[dot.Identifier.Idx] = struct{}{}
+				v.errs = append(v.errs, validateErr{
+					idx: dot.Identifier.Idx,
+					msg: fmt.Sprintf("unknown %s method: %s", typ, name),
+				})
+			}
+			return objUnknown
+		}
+		m, ok := meths[name]
+		if !ok {
+			// aliases, builtin methods of JS objects
+			return objUnknown
+		}
+		for i := 0; i < m.Type.NumOut(); i++ {
+			switch m.Type.Out(i) {
+			case rtPathObject:
+				return objPath
+			case rtGojaValue:
+				if pathValueMethods[name] {
+					return objPath
+				}
+			}
+		}
+	}
+	return objUnknown
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/cayleygraph/quad"
+)
+
+// ToValue converts a JS value to a graph value.
+//
+// Signature: (value[, type[, param]])
+//
+// Without the type, the value is converted the same way as arguments of other functions:
+// strings are parsed (so "<bob>" becomes an IRI) and integral numbers become ints.
+//
+// The type is one of the names returned by type() of typed results (see WithTypedResults):
+//
+// * "iri", "bnode", "string": value is used as-is, without parsing.
+// * "lang": param is a language tag.
+// * "typed": param is a datatype IRI.
+// * "int", "float", "bool": value must be of the same JS type or a string representation of it.
+// * "time": value must be a Date or a string in RFC 3339 format.
+//
+// The result is a value object, the same as returned by FromValue.
+//
+// Example:
+// 	// javascript
+//	g.V(g.toValue(1, "float")).all()
+//	g.V(g.toValue("hi", "lang", "en")).all()
+func (g *graphObject) ToValue(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) == 0 || len(args) > 3 {
+		return throwErr(g.s.vm, errArgCount{Got: len(args)})
+	}
+	var (
+		qv  quad.Value
+		err error
+	)
+	if len(args) == 1 {
+		qv, err = toQuadValue(args[0])
+	} else {
+		typ, ok := args[1].(string)
+		if !ok {
+			return throwErr(g.s.vm, errValueConversion{Val: args[1], Type: "string"})
+		}
+		var param string
+		if len(args) == 3 {
+			if param, ok = args[2].(string); !ok {
+				return throwErr(g.s.vm, errValueConversion{Val: args[2], Type: "string"})
+			}
+		}
+		qv, err = g.s.toQuadValueAs(args[0], typ, param)
+	}
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	return g.s.vm.ToValue(&valueObject{s: g.s, v: qv})
+}
+
+// FromValue wraps a graph value into a value object with type information, regardless of WithTypedResults.
+// Other JS values are converted the same way as with ToValue without type argument.
+//
+// Signature: (value)
+//
+// Example:
+// 	// javascript
+//	g.fromValue("<alice>").type() // "iri"
+//	g.fromValue(1.5).type() // "float"
+func (g *graphObject) FromValue(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 {
+		return throwErr(g.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	qv, err := toQuadValue(args[0])
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	return g.s.vm.ToValue(&valueObject{s: g.s, v: qv})
+}
+
+// toQuadValueAs converts a value to a quad.Value of a given type. See ToValue for a list of types.
+func (s *Session) toQuadValueAs(o interface{}, typ, param string) (quad.Value, error) {
+	fail := func() (quad.Value, error) {
+		return nil, errValueConversion{Val: o, Type: typ}
+	}
+	str, isStr := o.(string)
+	switch typ {
+	case "iri":
+		if iri, ok := o.(quad.IRI); ok {
+			return iri, nil
+		} else if !isStr {
+			return fail()
+		}
+		return quad.IRI(strings.TrimSuffix(strings.TrimPrefix(str, "<"), ">")), nil
+	case "bnode":
+		if b, ok := o.(quad.BNode); ok {
+			return b, nil
+		} else if !isStr {
+			return fail()
+		}
+		return quad.BNode(strings.TrimPrefix(str, "_:")), nil
+	case "string":
+		if !isStr {
+			return fail()
+		}
+		return quad.String(str), nil
+	case "lang":
+		if !isStr {
+			return fail()
+		}
+		if s.validLang {
+			if err := checkLangTag(param); err != nil {
+				return nil, errInvalidLangTag{Tag: param, Err: err}
+			}
+		}
+		return quad.LangString{Value: quad.String(str), Lang: param}, nil
+	case "typed":
+		if !isStr || param == "" {
+			return fail()
+		}
+		return quad.TypedString{Value: quad.String(str), Type: quad.IRI(param)}, nil
+	case "int":
+		switch v := o.(type) {
+		case int64:
+			return quad.Int(v), nil
+		case float64:
+			if v != math.Trunc(v) {
+				return fail()
+			}
+			return quad.Int(v), nil
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fail()
+			}
+			return quad.Int(i), nil
+		}
+	case "float":
+		switch v := o.(type) {
+		case int64:
+			return quad.Float(v), nil
+		case float64:
+			return quad.Float(v), nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fail()
+			}
+			return quad.Float(f), nil
+		}
+	case "bool":
+		switch v := o.(type) {
+		case bool:
+			return quad.Bool(v), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fail()
+			}
+			return quad.Bool(b), nil
+		}
+	case "time":
+		switch v := o.(type) {
+		case time.Time:
+			return quad.Time(v), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return fail()
+			}
+			return quad.Time(t), nil
+		}
+	default:
+		return nil, errUnknownValueType{Type: typ}
+	}
+	return fail()
+}
@@ -17,9 +17,11 @@ package path
 import (
 	"context"
 	"fmt"
+	"math/rand"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/refs"
 	"github.com/cayleygraph/cayley/query/shape"
 	"github.com/cayleygraph/quad"
 )
@@ -60,6 +62,7 @@ func isMorphism(nodes ...quad.Value) morphism {
 			// smaller result set, so join isNodes first here.
 			return join(s, in), ctx
 		},
+		step: &Step{Op: stepIs, Nodes: nodes},
 	}
 }
 
@@ -82,6 +85,24 @@ func isNodeMorphism(nodes ...graph.Ref) morphism {
 	}
 }
 
+// fixedNodesMorphism is the same as isNodeMorphism, but nodes are only valid for a given quad store.
+func fixedNodesMorphism(owner graph.QuadStore, nodes []graph.Ref) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return fixedNodesMorphism(owner, nodes), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			fixed := iteratorBuilder(func(qs graph.QuadStore) iterator.Shape {
+				if graph.Unwrap(qs) != owner {
+					return iterator.NewError(ErrStoreMismatch)
+				} else if len(nodes) == 0 {
+					return iterator.NewNull()
+				}
+				return shape.Fixed(nodes).BuildIterator(qs)
+			})
+			return join(fixed, in), ctx
+		},
+	}
+}
+
 // filterMorphism is the set of nodes that passes filters.
 func filterMorphism(filt []shape.ValueFilter) morphism {
 	return morphism{
@@ -92,12 +113,22 @@ func filterMorphism(filt []shape.ValueFilter) morphism {
 	}
 }
 
+// mapMorphism replaces values of the current path with values returned by mappers.
+func mapMorphism(mappers []iterator.ValueMapperFunc) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return mapMorphism(mappers), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.AddMappers(in, mappers...), ctx
+		},
+	}
+}
+
 // hasPathMorphism is a generic form of Has morphism - it accepts a subtree that will be checked on the current path.
 func hasPathMorphism(p *Path) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return hasPathMorphism(p), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.IntersectShapes(in, p.Shape()), ctx
+			return shape.IntersectShapes(in, p.shapeFrom(shape.AllNodes{}, ctx.materialized)), ctx
 		},
 	}
 }
@@ -111,7 +142,16 @@ func hasMorphism(via interface{}, rev bool, nodes ...quad.Value) morphism {
 	} else {
 		node = shape.Lookup(nodes)
 	}
-	return hasShapeMorphism(via, rev, node)
+	m := hasShapeMorphism(via, rev, node)
+	m.Reversal = func(ctx *pathContext) (morphism, *pathContext) { return hasMorphism(via, rev, nodes...), ctx }
+	op := stepHas
+	if rev {
+		op = stepHasReverse
+	}
+	if m.step = viaStep(op, nil, via); m.step != nil {
+		m.step.Nodes = nodes
+	}
+	return m
 }
 
 // hasShapeMorphism is the set of nodes that is reachable via either a *Path, a
@@ -134,6 +174,19 @@ func hasFilterMorphism(via interface{}, rev bool, filt []shape.ValueFilter) morp
 	})
 }
 
+// hasNodesOrFilterMorphism is the set of nodes that is reachable via either a *Path, a
+// single node.(string) or a list of nodes.([]string) and that is either one of known nodes
+// or passes all provided filters.
+func hasNodesOrFilterMorphism(via interface{}, rev bool, nodes []quad.Value, filt []shape.ValueFilter) morphism {
+	return hasShapeMorphism(via, rev, shape.Union{
+		shape.Lookup(nodes),
+		shape.Filter{
+			From:    shape.AllNodes{},
+			Filters: filt,
+		},
+	})
+}
+
 func tagMorphism(tags ...string) morphism {
 	return morphism{
 		IsTag:    true,
@@ -142,6 +195,7 @@ func tagMorphism(tags ...string) morphism {
 			return shape.Save{From: in, Tags: tags}, ctx
 		},
 		tags: tags,
+		step: &Step{Op: stepTag, Tags: tags},
 	}
 }
 
@@ -153,6 +207,7 @@ func outMorphism(tags []string, via ...interface{}) morphism {
 			return shape.Out(in, buildVia(via...), ctx.labelSet, tags...), ctx
 		},
 		tags: tags,
+		step: viaStep(stepOut, tags, via...),
 	}
 }
 
@@ -164,6 +219,7 @@ func inMorphism(tags []string, via ...interface{}) morphism {
 			return shape.In(in, buildVia(via...), ctx.labelSet, tags...), ctx
 		},
 		tags: tags,
+		step: viaStep(stepIn, tags, via...),
 	}
 }
 
@@ -178,15 +234,61 @@ func bothMorphism(tags []string, via ...interface{}) morphism {
 			}, ctx
 		},
 		tags: tags,
+		step: viaStep(stepBoth, tags, via...),
+	}
+}
+
+// bothDirMorphism is the same as bothMorphism, but also saves the direction of the link ("in" or "out") to dirTag.
+func bothDirMorphism(dirTag string, tags []string, via ...interface{}) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return bothDirMorphism(dirTag, tags, via...), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			via := buildVia(via...)
+			return shape.Union{
+				shape.FixedTags{
+					Tags: map[string]graph.Ref{dirTag: refs.PreFetched(quad.String(DirIn))},
+					On:   shape.In(in, via, ctx.labelSet, tags...),
+				},
+				shape.FixedTags{
+					Tags: map[string]graph.Ref{dirTag: refs.PreFetched(quad.String(DirOut))},
+					On:   shape.Out(in, via, ctx.labelSet, tags...),
+				},
+			}, ctx
+		},
+		tags: append([]string{dirTag}, tags...),
+	}
+}
+
+// bothUniqueMorphism is the same as bothMorphism, but each node is returned only once,
+// even if it is linked in both directions.
+func bothUniqueMorphism(tags []string, via ...interface{}) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return bothUniqueMorphism(tags, via...), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			via := buildVia(via...)
+			return shape.Unique{From: shape.Union{
+				shape.In(in, via, ctx.labelSet, tags...),
+				shape.Out(in, via, ctx.labelSet, tags...),
+			}}, ctx
+		},
+		tags: tags,
 	}
 }
 
 func labelContextMorphism(tags []string, via ...interface{}) morphism {
-	var path shape.Shape
+	var (
+		path shape.Shape
+		step *Step
+	)
 	if len(via) == 0 {
 		path = nil
+		step = &Step{Op: stepLabelContext, Tags: tags}
 	} else {
 		path = shape.Save{From: buildVia(via...), Tags: tags}
+		// an empty set of values would be restored as no labels set at all
+		if step = viaStep(stepLabelContext, tags, via...); step != nil && len(step.Via) == 0 {
+			step = nil
+		}
 	}
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
@@ -200,6 +302,7 @@ func labelContextMorphism(tags []string, via ...interface{}) morphism {
 			return in, &out
 		},
 		tags: tags,
+		step: step,
 	}
 }
 
@@ -274,8 +377,9 @@ func andMorphism(p *Path) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return andMorphism(p), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return join(in, p.Shape()), ctx
+			return join(in, p.shapeFrom(shape.AllNodes{}, ctx.materialized)), ctx
 		},
+		step: pathStep(stepAnd, p),
 	}
 }
 
@@ -284,7 +388,7 @@ func andOptMorphism(p *Path) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return andOptMorphism(p), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return joinOpt(in, p.Shape()), ctx
+			return joinOpt(in, p.shapeFrom(shape.AllNodes{}, ctx.materialized)), ctx
 		},
 	}
 }
@@ -294,8 +398,9 @@ func orMorphism(p *Path) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return orMorphism(p), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.Union{in, p.Shape()}, ctx
+			return shape.Union{in, p.shapeFrom(shape.AllNodes{}, ctx.materialized)}, ctx
 		},
+		step: pathStep(stepOr, p),
 	}
 }
 
@@ -303,7 +408,69 @@ func followMorphism(p *Path) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return followMorphism(p.Reverse()), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return p.ShapeFrom(in), ctx
+			return p.shapeFrom(in, ctx.materialized), ctx
+		},
+		step: pathStep(stepFollow, p),
+	}
+}
+
+// followAnyMorphism follows each of the paths from the same nodes and returns the union of the results.
+func followAnyMorphism(paths []*Path) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			rev := make([]*Path, 0, len(paths))
+			for _, p := range paths {
+				rev = append(rev, p.Reverse())
+			}
+			return followAnyMorphism(rev), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			union := make(shape.Union, 0, len(paths))
+			for _, p := range paths {
+				union = append(union, p.shapeFrom(in, ctx.materialized))
+			}
+			return union, ctx
+		},
+	}
+}
+
+// ifMorphism follows then path from the nodes that are in cond path, and els path from the rest of nodes.
+// Nil then or els path passes the corresponding nodes unchanged. If rev is set, the condition is checked on the resulting nodes instead.
+func ifMorphism(cond, then, els *Path, rev bool) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			var rthen, rels *Path
+			if then != nil {
+				rthen = then.Reverse()
+			}
+			if els != nil {
+				rels = els.Reverse()
+			}
+			return ifMorphism(cond, rthen, rels, !rev), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			matched := func(s shape.Shape) shape.Shape {
+				return join(s, cond.shapeFrom(shape.AllNodes{}, ctx.materialized))
+			}
+			rest := func(s shape.Shape) shape.Shape {
+				return join(s, shape.Except{From: shape.AllNodes{}, Exclude: cond.shapeFrom(shape.AllNodes{}, ctx.materialized)})
+			}
+			follow := func(p *Path, s shape.Shape) shape.Shape {
+				if p == nil {
+					return s
+				}
+				return p.shapeFrom(s, ctx.materialized)
+			}
+			if rev {
+				return shape.Union{
+					matched(follow(then, in)),
+					rest(follow(els, in)),
+				}, ctx
+			}
+			return shape.Union{
+				follow(then, matched(in)),
+				follow(els, rest(in)),
+			}, ctx
 		},
 	}
 }
@@ -317,10 +484,10 @@ func (s iteratorBuilder) Optimize(ctx context.Context, r shape.Optimizer) (shape
 	return s, false
 }
 
-func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism {
+func followRecursiveMorphism(p *Path, maxDepth, maxResults int, onTruncate func(), depthTags []string) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
-			return followRecursiveMorphism(p.Reverse(), maxDepth, depthTags), ctx
+			return followRecursiveMorphism(p.Reverse(), maxDepth, maxResults, onTruncate, depthTags), ctx
 		},
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
 			return iteratorBuilder(func(qs graph.QuadStore) iterator.Shape {
@@ -329,6 +496,9 @@ func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism
 				for _, s := range depthTags {
 					it.AddDepthTag(s)
 				}
+				if maxResults > 0 {
+					it.SetMaxResults(maxResults, onTruncate)
+				}
 				return it
 			}), ctx
 		},
@@ -340,7 +510,18 @@ func exceptMorphism(p *Path) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return exceptMorphism(p), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return join(in, shape.Except{From: shape.AllNodes{}, Exclude: p.Shape()}), ctx
+			return join(in, shape.Except{From: shape.AllNodes{}, Exclude: p.shapeFrom(shape.AllNodes{}, ctx.materialized)}), ctx
+		},
+		step: pathStep(stepExcept, p),
+	}
+}
+
+// exceptTagMorphism removes all paths with a value of the tag found in the tag of p.(*Path).
+func exceptTagMorphism(p *Path, tag, pathTag string) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return exceptTagMorphism(p, tag, pathTag), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.ExceptTag{From: in, Exclude: p.shapeFrom(shape.AllNodes{}, ctx.materialized), Tag: tag, ExcludeTag: pathTag}, ctx
 		},
 	}
 }
@@ -352,6 +533,23 @@ func uniqueMorphism() morphism {
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
 			return shape.Unique{in}, ctx
 		},
+		step: &Step{Op: stepUnique},
+	}
+}
+
+// materializeMorphism loads results into memory. The cache is only used when the path is evaluated
+// from all nodes, since the input is different when the path is followed or reversed.
+func materializeMorphism(key *materializeKey) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return materializeMorphism(nil), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			m := shape.Materialize{Values: in}
+			if ctx.fromAll {
+				m.Cache = ctx.materialized.get(key)
+			}
+			return m, ctx
+		},
+		step: &Step{Op: stepMaterialize},
 	}
 }
 
@@ -362,6 +560,7 @@ func saveMorphism(via interface{}, tag string) morphism {
 			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, false, false), ctx
 		},
 		tags: []string{tag},
+		step: viaStep(stepSave, []string{tag}, via),
 	}
 }
 
@@ -372,6 +571,7 @@ func saveReverseMorphism(via interface{}, tag string) morphism {
 			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, true, false), ctx
 		},
 		tags: []string{tag},
+		step: viaStep(stepSaveReverse, []string{tag}, via),
 	}
 }
 
@@ -382,6 +582,7 @@ func saveOptionalMorphism(via interface{}, tag string) morphism {
 			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, false, true), ctx
 		},
 		tags: []string{tag},
+		step: viaStep(stepSaveOptional, []string{tag}, via),
 	}
 }
 
@@ -392,6 +593,7 @@ func saveOptionalReverseMorphism(via interface{}, tag string) morphism {
 			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, true, true), ctx
 		},
 		tags: []string{tag},
+		step: viaStep(stepSaveOptionalReverse, []string{tag}, via),
 	}
 }
 
@@ -434,14 +636,29 @@ func skipMorphism(v int64) morphism {
 			}
 			return shape.Page{From: in, Skip: v}, ctx
 		},
+		step: &Step{Op: stepSkip, N: v},
+	}
+}
+
+func orderMorphism(desc bool) morphism {
+	step := &Step{Op: stepOrder}
+	if desc {
+		step.Op = stepOrderDesc
+	}
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return orderMorphism(desc), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.Sort{From: in, Desc: desc}, ctx
+		},
+		step: step,
 	}
 }
 
-func orderMorphism() morphism {
+func sampleMorphism(n int, rnd *rand.Rand) morphism {
 	return morphism{
-		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return orderMorphism(), ctx },
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return sampleMorphism(n, rnd), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.Sort{From: in}, ctx
+			return shape.Sample{From: in, N: n, Rand: rnd}, ctx
 		},
 	}
 }
@@ -458,6 +675,23 @@ func limitMorphism(v int64) morphism {
 			}
 			return shape.Page{From: in, Limit: v}, ctx
 		},
+		step: &Step{Op: stepLimit, N: v},
+	}
+}
+
+// skipLastMorphism will omit n last values-- if number is negative or zero, this function
+// acts as a passthrough for the previous iterator.
+func skipLastMorphism(n int64) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return skipLastMorphism(n), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			if n <= 0 {
+				// Acting as a passthrough
+				return in, ctx
+			}
+			return shape.SkipLast{From: in, N: n}, ctx
+		},
+		step: &Step{Op: stepSkipLast, N: n},
 	}
 }
 
@@ -468,5 +702,6 @@ func countMorphism() morphism {
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
 			return shape.Count{Values: in}, ctx
 		},
+		step: &Step{Op: stepCount},
 	}
 }
@@ -16,7 +16,11 @@ package path
 
 import (
 	"context"
+	"errors"
+	"math/rand"
 	"regexp"
+	"sync"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
@@ -31,6 +35,7 @@ type morphism struct {
 	Reversal func(*pathContext) (morphism, *pathContext)
 	Apply    applyMorphism
 	tags     []string
+	step     *Step // nil if the step cannot be serialized
 }
 
 // pathContext allows a high-level change to the way paths are constructed. Some
@@ -58,12 +63,76 @@ type pathContext struct {
 	//
 	// Claimed by the withLabel morphism
 	labelSet shape.Shape
+
+	// Set when the path is evaluated from all nodes, as opposed to being followed from
+	// a different path. Results of such evaluations are the same each time, thus can be cached.
+	//
+	// Claimed by the materialize morphism
+	fromAll bool
+
+	// Cache for results of materialized paths. It is set only when the path is built for a query
+	// with WithMaterializeCache.
+	//
+	// Claimed by the materialize morphism
+	materialized *MaterializeCache
 }
 
 func (c pathContext) copy() pathContext {
 	return pathContext{
-		labelSet: c.labelSet,
+		labelSet:     c.labelSet,
+		fromAll:      c.fromAll,
+		materialized: c.materialized,
+	}
+}
+
+// materializeKey identifies a single Materialize step and all copies of the path it was added to.
+type materializeKey struct {
+	_ int // must not be zero-sized, or pointers may be equal
+}
+
+// MaterializeCache keeps results of Materialize steps, so that each materialized path is evaluated only once.
+//
+// Results are kept for the lifetime of the cache, thus it should be created for a single query and attached
+// to the context passed to BuildIteratorOn with WithMaterializeCache. Without the cache, results are loaded
+// separately for each iterator.
+type MaterializeCache struct {
+	mu sync.Mutex
+	m  map[*materializeKey]*shape.MaterializeCache
+}
+
+// NewMaterializeCache creates an empty cache for materialized paths.
+func NewMaterializeCache() *MaterializeCache {
+	return &MaterializeCache{m: make(map[*materializeKey]*shape.MaterializeCache)}
+}
+
+func (c *MaterializeCache) get(key *materializeKey) *shape.MaterializeCache {
+	if c == nil || key == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mc := c.m[key]
+	if mc == nil {
+		mc = &shape.MaterializeCache{}
+		c.m[key] = mc
 	}
+	return mc
+}
+
+type materializeCacheKey struct{}
+
+// WithMaterializeCache attaches a cache for materialized paths to the context.
+// Iterators built with this context share results of the same Materialize steps. See MaterializeCache.
+func WithMaterializeCache(ctx context.Context, c *MaterializeCache) context.Context {
+	return context.WithValue(ctx, materializeCacheKey{}, c)
+}
+
+func materializeCacheFrom(ctx context.Context) *MaterializeCache {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(materializeCacheKey{}).(*MaterializeCache)
+	return c
 }
 
 // Path represents either a morphism (a pre-defined path stored for later use),
@@ -100,6 +169,18 @@ func StartPathNodes(qs graph.QuadStore, nodes ...graph.Ref) *Path {
 	return newPath(qs, isNodeMorphism(nodes...))
 }
 
+// ErrStoreMismatch is returned when a path that references nodes of one QuadStore is executed on a different one.
+var ErrStoreMismatch = errors.New("path: nodes belong to a different quad store")
+
+// StartPathFixed is the same as StartPathNodes, but nodes are checked to belong to the given QuadStore.
+//
+// References are only valid for the QuadStore they were resolved by, thus building an iterator
+// for this path on any other QuadStore returns an iterator with ErrStoreMismatch error.
+// Unlike StartPathNodes, an empty set of nodes results in an empty path.
+func StartPathFixed(qs graph.QuadStore, nodes ...graph.Ref) *Path {
+	return newPath(qs, fixedNodesMorphism(graph.Unwrap(qs), nodes))
+}
+
 // PathFromIterator creates a new Path from a set of nodes contained in iterator.
 func PathFromIterator(qs graph.QuadStore, it iterator.Shape) *Path {
 	return newPath(qs, iteratorMorphism(it))
@@ -187,6 +268,24 @@ func (p *Path) Filters(filters ...shape.ValueFilter) *Path {
 	return np
 }
 
+// InSet represents the nodes that are present in a given set of values.
+//
+// It allows to restrict results to an in-memory set (an allow-list) without passing all values to the query.
+// The set is captured by reference and must not be modified while the query is running.
+func (p *Path) InSet(set map[quad.Value]struct{}) *Path {
+	return p.Filters(shape.InSet{Set: set})
+}
+
+// Map replaces the nodes in the current path with values returned by mappers.
+// Mapped values that are not present in the quad store are dropped.
+//
+// Adjacent Map calls are merged, thus each node is resolved only once.
+func (p *Path) Map(mappers ...iterator.ValueMapperFunc) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, mapMorphism(mappers))
+	return np
+}
+
 // Tag adds tag strings to the nodes at this point in the path for each result
 // path in the set.
 func (p *Path) Tag(tags ...string) *Path {
@@ -263,6 +362,35 @@ func (p *Path) BothWithTags(tags []string, via ...interface{}) *Path {
 	return np
 }
 
+// Values saved by BothWithDirTag to indicate the direction of the link.
+const (
+	DirIn  = "in"
+	DirOut = "out"
+)
+
+// BothWithDirTag is the same as BothWithTags, but also saves the direction of the link to dirTag:
+// DirIn if the current node is the object of the link, and DirOut if it is the subject.
+func (p *Path) BothWithDirTag(dirTag string, tags []string, via ...interface{}) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, bothDirMorphism(dirTag, tags, via...))
+	return np
+}
+
+// BothUnique is the same as Both, but each node is returned only once, even if it's linked
+// to the current nodes in both directions. Nodes are unique across all paths, the same way as with Unique.
+func (p *Path) BothUnique(via ...interface{}) *Path {
+	return p.BothUniqueWithTags(nil, via...)
+}
+
+// BothUniqueWithTags is exactly like BothUnique, except it tags the value of the predicate
+// traversed with the tags provided. If the node is linked in both directions, tags are taken
+// from the first link found.
+func (p *Path) BothUniqueWithTags(tags []string, via ...interface{}) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, bothUniqueMorphism(tags, via...))
+	return np
+}
+
 // Labels updates this path to represent the nodes of the labels
 // of inbound and outbound quads.
 func (p *Path) Labels() *Path {
@@ -343,6 +471,20 @@ func (p *Path) Except(path *Path) *Path {
 	return np
 }
 
+// ExceptBy updates the current Path to exclude paths, for which the value of the tag is equal to a value
+// of pathTag on any path of the supplied Path. If pathTag is empty, the same tag is used on both paths.
+// Paths without the tag are kept.
+//
+// For example:
+//  // Will return people followed by alice, charlie and dani, except when they follow bob
+//  StartPath(qs, "alice", "charlie", "dani").Tag("who").Out("follows").Tag("target").
+//  	ExceptBy(StartPath(qs, "bob").Tag("target"), "target", "")
+func (p *Path) ExceptBy(path *Path, tag, pathTag string) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, exceptTagMorphism(path, tag, pathTag))
+	return np
+}
+
 // Unique updates the current Path to contain only unique nodes.
 func (p *Path) Unique() *Path {
 	np := p.clone()
@@ -350,6 +492,18 @@ func (p *Path) Unique() *Path {
 	return np
 }
 
+// Materialize updates the current Path to load all its results into memory on the first scan.
+// If the path is built with a MaterializeCache (see WithMaterializeCache), following scans with the same cache,
+// including ones of other paths built from this one, are served from memory.
+//
+// It is useful for expensive sub-queries that are used in Intersect or Union.
+// If there are too many results, the path is evaluated as usual.
+func (p *Path) Materialize() *Path {
+	np := p.clone()
+	np.stack = append(np.stack, materializeMorphism(&materializeKey{}))
+	return np
+}
+
 // Follow allows you to stitch two paths together. The resulting path will start
 // from where the first path left off and continue iterating down the path given.
 func (p *Path) Follow(path *Path) *Path {
@@ -358,6 +512,25 @@ func (p *Path) Follow(path *Path) *Path {
 	return np
 }
 
+// FollowAny is the same as Follow, but follows each of the given paths from the current nodes
+// and returns the union of the results. If no paths are given, the result is empty.
+func (p *Path) FollowAny(paths ...*Path) *Path {
+	if len(paths) == 0 {
+		return p.InSet(nil)
+	}
+	np := p.clone()
+	np.stack = append(np.stack, followAnyMorphism(paths))
+	return np
+}
+
+// If follows then path from the current nodes that are present in cond path, and els path from the rest of the nodes,
+// and returns the union of the results. If then or els is nil, the corresponding nodes are passed unchanged.
+func (p *Path) If(cond, then, els *Path) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, ifMorphism(cond, then, els, false))
+	return np
+}
+
 // FollowReverse is the same as follow, except it will iterate backwards up the
 // path given as argument.
 func (p *Path) FollowReverse(path *Path) *Path {
@@ -384,6 +557,15 @@ func (p *Path) FollowReverse(path *Path) *Path {
 //
 // This is a very expensive operation in practice. Be sure to use it wisely.
 func (p *Path) FollowRecursive(via interface{}, maxDepth int, depthTags []string) *Path {
+	return p.FollowRecursiveLimit(via, maxDepth, 0, nil, depthTags)
+}
+
+// FollowRecursiveLimit is the same as FollowRecursive, but also limits the total number of distinct nodes
+// returned by the recursion. Zero maxResults means no limit.
+//
+// Nodes closer to the start are returned first. If the limit cuts off some of the nodes, onTruncate is called.
+// It may be nil. See iterator.Recursive.SetMaxResults for details.
+func (p *Path) FollowRecursiveLimit(via interface{}, maxDepth, maxResults int, onTruncate func(), depthTags []string) *Path {
 	var path *Path
 	switch v := via.(type) {
 	case string:
@@ -396,7 +578,7 @@ func (p *Path) FollowRecursive(via interface{}, maxDepth int, depthTags []string
 		panic("did not pass a string predicate or a Path to FollowRecursive")
 	}
 	np := p.clone()
-	np.stack = append(p.stack, followRecursiveMorphism(path, maxDepth, depthTags))
+	np.stack = append(p.stack, followRecursiveMorphism(path, maxDepth, maxResults, onTruncate, depthTags))
 	return np
 }
 
@@ -466,6 +648,47 @@ func (p *Path) HasFilter(via interface{}, rev bool, filt ...shape.ValueFilter) *
 	return np
 }
 
+// HasNodesOrFilter limits the paths to be ones where the current nodes have some linkage
+// to either one of known nodes or some nodes that pass all provided filters.
+func (p *Path) HasNodesOrFilter(via interface{}, rev bool, nodes []quad.Value, filt ...shape.ValueFilter) *Path {
+	if len(filt) == 0 {
+		if rev {
+			return p.HasReverse(via, nodes...)
+		}
+		return p.Has(via, nodes...)
+	} else if len(nodes) == 0 {
+		return p.HasFilter(via, rev, filt...)
+	}
+	np := p.clone()
+	np.stack = append(np.stack, hasNodesOrFilterMorphism(via, rev, nodes, filt))
+	return np
+}
+
+// AsOf limits the paths to the nodes that are valid at a given time.
+//
+// The validity interval of a node is defined by values of start and end predicates,
+// and the node is valid if start <= t < end. A node without start or end value has
+// no lower or upper bound respectively. Nil predicate disables the corresponding check.
+// Values of both predicates must be stored as quad.Time.
+func (p *Path) AsOf(t time.Time, start, end interface{}) *Path {
+	np := p.clone()
+	if start != nil {
+		np = np.And(validityBound(start, shape.Comparison{Op: iterator.CompareLTE, Val: quad.Time(t)}))
+	}
+	if end != nil {
+		np = np.And(validityBound(end, shape.Comparison{Op: iterator.CompareGT, Val: quad.Time(t)}))
+	}
+	return np
+}
+
+// validityBound returns a morphism that passes nodes that either have a value for a given predicate
+// that passes the comparison, or don't have a value for this predicate at all.
+func validityBound(via interface{}, cmp shape.Comparison) *Path {
+	passed := StartMorphism().HasFilter(via, false, cmp)
+	missing := StartMorphism().Except(StartMorphism().Has(via))
+	return passed.Or(missing).Unique()
+}
+
 // LabelContext restricts the following operations (such as In, Out) to only
 // traverse edges that match the given set of labels.
 func (p *Path) LabelContext(via ...interface{}) *Path {
@@ -511,6 +734,22 @@ func (p *Path) Back(tag string) *Path {
 	}
 }
 
+// Len returns the number of steps in this path.
+func (p *Path) Len() int {
+	return len(p.stack)
+}
+
+// Tags returns all tags assigned with Tag on this path, in order.
+func (p *Path) Tags() []string {
+	var tags []string
+	for _, m := range p.stack {
+		if m.IsTag {
+			tags = append(tags, m.tags...)
+		}
+	}
+	return tags
+}
+
 // BuildIterator returns an iterator from this given Path.  Note that you must
 // call this with a full path (not a morphism), since a morphism does not have
 // the ability to fetch the underlying quads.  This function will panic if
@@ -524,7 +763,7 @@ func (p *Path) BuildIterator(ctx context.Context) iterator.Shape {
 
 // BuildIteratorOn will return an iterator for this path on the given QuadStore.
 func (p *Path) BuildIteratorOn(ctx context.Context, qs graph.QuadStore) iterator.Shape {
-	return shape.BuildIterator(ctx, qs, p.Shape())
+	return shape.BuildIterator(ctx, qs, p.shapeFrom(shape.AllNodes{}, materializeCacheFrom(ctx)))
 }
 
 // MorphismFor returns the morphism of this path. The returned value is a
@@ -543,8 +782,23 @@ func (p *Path) Skip(v int64) *Path {
 	return p
 }
 
+// Order returns values from the path in ascending order.
+// Values of different types are ordered by type first, see iterator.CompareValues for details.
 func (p *Path) Order() *Path {
-	p.stack = append(p.stack, orderMorphism())
+	p.stack = append(p.stack, orderMorphism(false))
+	return p
+}
+
+// OrderDesc is the same as Order, but returns values in descending order.
+func (p *Path) OrderDesc() *Path {
+	p.stack = append(p.stack, orderMorphism(true))
+	return p
+}
+
+// Sample returns a random subset of up to n values from the path. Values are selected using a given
+// random source; nil means a source seeded with the current time. See iterator.Sample for details.
+func (p *Path) Sample(n int, rnd *rand.Rand) *Path {
+	p.stack = append(p.stack, sampleMorphism(n, rnd))
 	return p
 }
 
@@ -554,6 +808,12 @@ func (p *Path) Limit(v int64) *Path {
 	return p
 }
 
+// SkipLast will omit n last values from the result set. Up to n values are buffered in memory.
+func (p *Path) SkipLast(n int64) *Path {
+	p.stack = append(p.stack, skipLastMorphism(n))
+	return p
+}
+
 // Count will count a number of results as it's own result set.
 func (p *Path) Count() *Path {
 	p.stack = append(p.stack, countMorphism())
@@ -562,14 +822,22 @@ func (p *Path) Count() *Path {
 
 // Iterate is an shortcut for graph.Iterate.
 func (p *Path) Iterate(ctx context.Context) *iterator.Chain {
-	return shape.Iterate(ctx, p.qs, p.Shape())
+	return shape.Iterate(ctx, p.qs, p.shapeFrom(shape.AllNodes{}, materializeCacheFrom(ctx)))
 }
 func (p *Path) Shape() shape.Shape {
 	return p.ShapeFrom(shape.AllNodes{})
 }
 func (p *Path) ShapeFrom(from shape.Shape) shape.Shape {
+	return p.shapeFrom(from, nil)
+}
+
+// shapeFrom is the same as ShapeFrom, but also sets a cache for materialized paths.
+func (p *Path) shapeFrom(from shape.Shape, cache *MaterializeCache) shape.Shape {
 	s := from
-	ctx := &p.baseContext
+	base := p.baseContext.copy()
+	_, base.fromAll = from.(shape.AllNodes)
+	base.materialized = cache
+	ctx := &base
 	for _, m := range p.stack {
 		s, ctx = m.Apply(s, ctx)
 	}
@@ -15,12 +15,69 @@
 package path_test
 
 import (
+	"encoding/json"
+	"reflect"
+	"regexp"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph/iterator"
 	_ "github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/query/path"
 	"github.com/cayleygraph/cayley/query/path/pathtest"
+	"github.com/cayleygraph/quad"
 )
 
 func TestMorphisms(t *testing.T) {
 	pathtest.RunTestMorphisms(t, nil)
 }
+
+func TestSteps(t *testing.T) {
+	friends := path.StartMorphism().Out(quad.IRI("follows"))
+	p := path.StartMorphism(quad.IRI("alice")).Tag("start").
+		OutWithTags([]string{"pred"}, quad.IRI("follows")).
+		Follow(friends).
+		Has(quad.IRI("status"), quad.String("cool")).
+		SaveOptional(quad.IRI("name"), "name").
+		LabelContext(quad.IRI("smart_graph")).
+		In().
+		Except(path.StartMorphism(quad.IRI("bob"))).
+		Unique().Order().Skip(1).Limit(2)
+
+	steps, err := p.Steps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []path.Step
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, steps) {
+		t.Fatalf("steps changed after decoding:\n%#v\nvs\n%#v", got, steps)
+	}
+	np, err := path.MorphismFromSteps(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(np.Shape(), p.Shape()) {
+		t.Fatalf("unexpected shape:\n%#v\nvs\n%#v", np.Shape(), p.Shape())
+	}
+	if !reflect.DeepEqual(np.Reverse().Shape(), p.Reverse().Shape()) {
+		t.Fatalf("unexpected reversed shape:\n%#v\nvs\n%#v", np.Reverse().Shape(), p.Reverse().Shape())
+	}
+
+	for _, p := range []*path.Path{
+		path.StartMorphism().Filter(iterator.CompareGT, quad.Int(1)),
+		path.StartMorphism().Follow(path.StartMorphism().Regex(regexp.MustCompile("a"))),
+		path.StartMorphism().Out(path.StartMorphism().Out(quad.IRI("follows"))),
+	} {
+		if _, err := p.Steps(); err != path.ErrNotSerializable {
+			t.Errorf("expected %v, got: %v", path.ErrNotSerializable, err)
+		}
+	}
+	if _, err := path.MorphismFromSteps([]path.Step{{Op: "regex"}}); err == nil {
+		t.Error("expected an error for unknown step")
+	}
+}
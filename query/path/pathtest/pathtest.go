@@ -174,6 +174,16 @@ func testSet(qs graph.QuadStore) []test {
 			path:    path.StartPath(qs, vBob).In(vFollows).Filter(iterator.CompareGT, quad.IRI("c")),
 			expect:  []quad.Value{vCharlie, vDani},
 		},
+		{
+			message: "in with set",
+			path:    path.StartPath(qs, vBob).In(vFollows).InSet(map[quad.Value]struct{}{vAlice: {}, vDani: {}, vGreg: {}}),
+			expect:  []quad.Value{vAlice, vDani},
+		},
+		{
+			message: "in with empty set",
+			path:    path.StartPath(qs, vBob).In(vFollows).InSet(nil),
+			expect:  nil,
+		},
 		{
 			message: "in with regex",
 			path:    path.StartPath(qs, vBob).In(vFollows).Regex(regexp.MustCompile("ar?li.*e")),
@@ -221,6 +231,36 @@ func testSet(qs graph.QuadStore) []test {
 			path:    path.StartPath(qs, vFred).FollowReverse(path.StartMorphism().Out(vFollows).Out(vFollows)),
 			expect:  []quad.Value{vAlice, vCharlie, vDani},
 		},
+		{
+			message: "follow any",
+			path: path.StartPath(qs, vBob).FollowAny(
+				path.StartMorphism().Out(vFollows),
+				path.StartMorphism().In(vFollows),
+			),
+			expect: []quad.Value{vAlice, vCharlie, vDani, vFred},
+		},
+		{
+			message: "follow any reverse",
+			path: path.StartPath(qs, vFred).FollowReverse(path.StartMorphism().FollowAny(
+				path.StartMorphism().Out(vFollows),
+				path.StartMorphism().Out(vStatus),
+			)),
+			expect: []quad.Value{vBob, vEmily},
+		},
+		{
+			message: "if without then reverse",
+			path: path.StartPath(qs, vGreg).FollowReverse(path.StartMorphism().If(
+				path.StartMorphism().Has(vStatus, vCool),
+				nil,
+				path.StartMorphism().Out(vFollows),
+			)),
+			expect: []quad.Value{vFred, vGreg},
+		},
+		{
+			message: "follow none",
+			path:    path.StartPath(qs, vBob).FollowAny(),
+			expect:  nil,
+		},
 		{
 			message: "is, tag, instead of FollowR",
 			path:    path.StartPath(qs).Tag("first").Follow(path.StartMorphism().Out(vFollows).Out(vFollows)).Is(vFred),
@@ -237,11 +277,36 @@ func testSet(qs graph.QuadStore) []test {
 			path:    path.StartPath(qs, vAlice, vBob, vCharlie).Except(path.StartPath(qs, vBob)).Except(path.StartPath(qs, vAlice)),
 			expect:  []quad.Value{vCharlie},
 		},
+		{
+			message: "Except by a tag value",
+			path: path.StartPath(qs, vAlice, vCharlie, vDani).Tag("who").Out(vFollows).Tag("target").
+				ExceptBy(path.StartPath(qs, vBob).Tag("target"), "target", ""),
+			tag:    "who",
+			expect: []quad.Value{vCharlie, vDani},
+		},
+		{
+			message: "Except by a tag value with a different tag name",
+			path: path.StartPath(qs, vAlice, vCharlie, vDani).Tag("who").Out(vFollows).
+				ExceptBy(path.StartPath(qs, vCharlie, vDani).Tag("blocked").Out(vFollows), "who", "blocked"),
+			expect: []quad.Value{vBob},
+		},
 		{
 			message: "Unique",
 			path:    path.StartPath(qs, vAlice, vBob, vCharlie).Out(vFollows).Unique(),
 			expect:  []quad.Value{vBob, vDani, vFred},
 		},
+		{
+			message: "intersect with a materialized path",
+			path: path.StartPath(qs, vAlice, vCharlie, vDani).Out(vFollows).Unique().
+				And(path.StartPath(qs, vDani).Out(vFollows).Materialize()),
+			expect: []quad.Value{vBob, vGreg},
+		},
+		{
+			message: "both with direction",
+			path:    path.StartPath(qs, vFred).BothWithDirTag("dir", nil, vFollows),
+			tag:     "dir",
+			expect:  []quad.Value{quad.String(path.DirIn), quad.String(path.DirIn), quad.String(path.DirOut)},
+		},
 		{
 			message: "simple save",
 			path:    path.StartPath(qs).Save(vStatus, "somecool"),
@@ -278,11 +343,30 @@ func testSet(qs graph.QuadStore) []test {
 			}),
 			expect: []quad.Value{vBob, vDani, vEmily, vFred},
 		},
+		{
+			message: "filter nodes with has and values",
+			path: path.StartPath(qs).HasNodesOrFilter(vFollows, false, []quad.Value{vAlice}, shape.Comparison{
+				Op: iterator.CompareGT, Val: quad.IRI("f"),
+			}, shape.Comparison{
+				Op: iterator.CompareLT, Val: quad.IRI("g"),
+			}),
+			expect: []quad.Value{vBob, vEmily},
+		},
 		{
 			message: "has path",
 			path:    path.StartPath(qs).HasPath(path.StartMorphism().Out(vStatus).Is(vCool)),
 			expect:  []quad.Value{vGreg, vDani, vBob},
 		},
+		{
+			message: "use fixed nodes",
+			path:    path.StartPathFixed(qs, qs.ValueOf(vAlice), qs.ValueOf(vCharlie)).Out(vFollows),
+			expect:  []quad.Value{vBob, vBob, vDani},
+		},
+		{
+			message: "use empty fixed nodes",
+			path:    path.StartPathFixed(qs).Out(vFollows),
+			expect:  nil,
+		},
 		{
 			message: "string prefix",
 			path: path.StartPath(qs).Filters(shape.Wildcard{
@@ -290,6 +374,21 @@ func testSet(qs graph.QuadStore) []test {
 			}),
 			expect: []quad.Value{vBob},
 		},
+		{
+			message: "string prefix filter",
+			path: path.StartPath(qs).Filters(shape.Prefix{
+				Prefix: `f`,
+			}),
+			expect: []quad.Value{vFollows, vFred},
+		},
+		{
+			message: "any of filters",
+			path: path.StartPath(qs).Filters(shape.AnyOf{Filters: []shape.ValueFilter{
+				shape.Prefix{Prefix: `f`},
+				shape.Wildcard{Pattern: `%ob`},
+			}}),
+			expect: []quad.Value{vBob, vFollows, vFred},
+		},
 		{
 			message: "three letters and range",
 			path: path.StartPath(qs).Filters(shape.Wildcard{
@@ -325,6 +424,20 @@ func testSet(qs graph.QuadStore) []test {
 				{vGreg},
 			},
 		},
+		{
+			message: "negative Limit",
+			path:    path.StartPath(qs).Has(vStatus, vCool).Limit(-1),
+			expect:  []quad.Value{vBob, vDani, vGreg},
+		},
+		{
+			message: "SkipLast",
+			path:    path.StartPath(qs).Has(vStatus, vCool).SkipLast(1),
+			expectAlt: [][]quad.Value{
+				{vBob, vDani},
+				{vBob, vGreg},
+				{vDani, vGreg},
+			},
+		},
 		{
 			message: "Skip and Limit",
 			path:    path.StartPath(qs).Has(vStatus, vCool).Skip(1).Limit(1),
@@ -497,6 +610,12 @@ func testSet(qs graph.QuadStore) []test {
 				vSmart,
 			},
 		},
+		{
+			message:  "use descending order",
+			path:     path.StartPath(qs, vBob, vAlice, vGreg, vDani).OrderDesc(),
+			expect:   []quad.Value{vGreg, vDani, vBob, vAlice},
+			unsorted: true,
+		},
 		{
 			message: "order with a next path",
 			path:    path.StartPath(qs, vDani, vBob).Save(vFollows, "target").Order(),
@@ -0,0 +1,298 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cayleygraph/quad"
+	"github.com/cayleygraph/quad/pquads"
+)
+
+// ErrNotSerializable is returned by Steps when the path contains a step that has no Step description.
+var ErrNotSerializable = errors.New("path: step cannot be serialized")
+
+// Names of serializable steps, see Step.Op.
+const (
+	stepIs                  = "is"
+	stepTag                 = "tag"
+	stepOut                 = "out"
+	stepIn                  = "in"
+	stepBoth                = "both"
+	stepHas                 = "has"
+	stepHasReverse          = "hasReverse"
+	stepSave                = "save"
+	stepSaveReverse         = "saveReverse"
+	stepSaveOptional        = "saveOptional"
+	stepSaveOptionalReverse = "saveOptionalReverse"
+	stepLabelContext        = "labelContext"
+	stepFollow              = "follow"
+	stepAnd                 = "and"
+	stepOr                  = "or"
+	stepExcept              = "except"
+	stepUnique              = "unique"
+	stepMaterialize         = "materialize"
+	stepSkip                = "skip"
+	stepLimit               = "limit"
+	stepSkipLast            = "skipLast"
+	stepOrder               = "order"
+	stepOrderDesc           = "orderDesc"
+	stepCount               = "count"
+)
+
+// Step is a serializable description of a single step of a path.
+//
+// Only steps that depend on constant values can be described: Is, Tag, Out, In, Both, Has, HasReverse, Save and
+// its variants, LabelContext, Follow, And, Or, Except, Unique, Materialize, Skip, Limit, SkipLast, Order,
+// OrderDesc and Count. Predicates of these steps must be given as values; a path used as a predicate is not
+// supported. Steps that hold functions, regular expressions, iterators or nodes resolved by a specific quad store
+// have no description. See Path.Steps and MorphismFromSteps.
+type Step struct {
+	// Op is the name of the step, for example "out" or "has".
+	Op string
+	// Via is a set of predicates to traverse. An empty set means all predicates.
+	Via []quad.Value
+	// Nodes is a set of nodes for Is and Has steps.
+	Nodes []quad.Value
+	// Tags are tags set by the step.
+	Tags []string
+	// N is an argument of Skip, Limit and SkipLast steps.
+	N int64
+	// Path is a sub-path of Follow, And, Or and Except steps.
+	Path []Step
+}
+
+type stepJSON struct {
+	Op    string   `json:"op"`
+	Via   [][]byte `json:"via,omitempty"`
+	Nodes [][]byte `json:"nodes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	N     int64    `json:"n,omitempty"`
+	Path  []Step   `json:"path,omitempty"`
+}
+
+func marshalValues(vals []quad.Value) ([][]byte, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	out := make([][]byte, 0, len(vals))
+	for _, v := range vals {
+		data, err := pquads.MarshalValue(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+func unmarshalValues(data [][]byte) ([]quad.Value, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	out := make([]quad.Value, 0, len(data))
+	for _, b := range data {
+		v, err := pquads.UnmarshalValue(b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// MarshalJSON implements json.Marshaler. Values are encoded with pquads.
+func (s Step) MarshalJSON() ([]byte, error) {
+	via, err := marshalValues(s.Via)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := marshalValues(s.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stepJSON{
+		Op: s.Op, Via: via, Nodes: nodes,
+		Tags: s.Tags, N: s.N, Path: s.Path,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var js stepJSON
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	via, err := unmarshalValues(js.Via)
+	if err != nil {
+		return err
+	}
+	nodes, err := unmarshalValues(js.Nodes)
+	if err != nil {
+		return err
+	}
+	*s = Step{
+		Op: js.Op, Via: via, Nodes: nodes,
+		Tags: js.Tags, N: js.N, Path: js.Path,
+	}
+	return nil
+}
+
+// Steps returns a serializable description of the path. It returns ErrNotSerializable if any of the steps
+// cannot be described, see Step for the list of supported steps.
+//
+// The description does not include the quad store the path is bound to.
+func (p *Path) Steps() ([]Step, error) {
+	if p.baseContext.labelSet != nil {
+		return nil, ErrNotSerializable
+	}
+	steps := make([]Step, 0, len(p.stack))
+	for _, m := range p.stack {
+		if m.step == nil {
+			return nil, ErrNotSerializable
+		}
+		steps = append(steps, *m.step)
+	}
+	return steps, nil
+}
+
+// MorphismFromSteps creates a morphism from a description returned by Path.Steps.
+func MorphismFromSteps(steps []Step) (*Path, error) {
+	p := newPath(nil)
+	for _, s := range steps {
+		m, err := s.morphism()
+		if err != nil {
+			return nil, err
+		}
+		p.stack = append(p.stack, m)
+	}
+	return p, nil
+}
+
+func (s Step) morphism() (morphism, error) {
+	var via interface{}
+	if len(s.Via) != 0 {
+		via = s.Via
+	}
+	switch s.Op {
+	case stepIs:
+		return isMorphism(s.Nodes...), nil
+	case stepTag:
+		return tagMorphism(s.Tags...), nil
+	case stepOut:
+		return outMorphism(s.Tags, via), nil
+	case stepIn:
+		return inMorphism(s.Tags, via), nil
+	case stepBoth:
+		return bothMorphism(s.Tags, via), nil
+	case stepHas, stepHasReverse:
+		return hasMorphism(via, s.Op == stepHasReverse, s.Nodes...), nil
+	case stepSave, stepSaveReverse, stepSaveOptional, stepSaveOptionalReverse:
+		if len(s.Tags) != 1 {
+			return morphism{}, fmt.Errorf("path: %s step expects one tag, got %d", s.Op, len(s.Tags))
+		}
+		tag := s.Tags[0]
+		switch s.Op {
+		case stepSaveReverse:
+			return saveReverseMorphism(via, tag), nil
+		case stepSaveOptional:
+			return saveOptionalMorphism(via, tag), nil
+		case stepSaveOptionalReverse:
+			return saveOptionalReverseMorphism(via, tag), nil
+		}
+		return saveMorphism(via, tag), nil
+	case stepLabelContext:
+		if via == nil {
+			return labelContextMorphism(s.Tags), nil
+		}
+		return labelContextMorphism(s.Tags, via), nil
+	case stepFollow, stepAnd, stepOr, stepExcept:
+		sub, err := MorphismFromSteps(s.Path)
+		if err != nil {
+			return morphism{}, err
+		}
+		switch s.Op {
+		case stepAnd:
+			return andMorphism(sub), nil
+		case stepOr:
+			return orMorphism(sub), nil
+		case stepExcept:
+			return exceptMorphism(sub), nil
+		}
+		return followMorphism(sub), nil
+	case stepUnique:
+		return uniqueMorphism(), nil
+	case stepMaterialize:
+		return materializeMorphism(&materializeKey{}), nil
+	case stepSkip:
+		return skipMorphism(s.N), nil
+	case stepLimit:
+		return limitMorphism(s.N), nil
+	case stepSkipLast:
+		return skipLastMorphism(s.N), nil
+	case stepOrder, stepOrderDesc:
+		return orderMorphism(s.Op == stepOrderDesc), nil
+	case stepCount:
+		return countMorphism(), nil
+	}
+	return morphism{}, fmt.Errorf("path: unknown step %q", s.Op)
+}
+
+// viaValues returns predicates passed to a step as values, in the same way as buildVia interprets them.
+// It returns false if predicates are given as a path.
+func viaValues(via ...interface{}) ([]quad.Value, bool) {
+	if len(via) == 1 {
+		switch v := via[0].(type) {
+		case nil:
+			return nil, true
+		case *Path:
+			return nil, false
+		case quad.Value:
+			return []quad.Value{v}, true
+		case []quad.Value:
+			// an empty set matches no predicates, while an empty description means all of them
+			return v, len(v) != 0
+		}
+	}
+	var out []quad.Value
+	for _, v := range via {
+		qv, ok := quad.AsValue(v)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, qv)
+	}
+	return out, true
+}
+
+// viaStep describes a step that traverses predicates given by via.
+func viaStep(op string, tags []string, via ...interface{}) *Step {
+	vals, ok := viaValues(via...)
+	if !ok {
+		return nil
+	}
+	return &Step{Op: op, Via: vals, Tags: tags}
+}
+
+// pathStep describes a step that uses a sub-path.
+func pathStep(op string, p *Path) *Step {
+	steps, err := p.Steps()
+	if err != nil {
+		return nil
+	}
+	return &Step{Op: op, Path: steps}
+}
@@ -233,6 +233,26 @@ func AddFilters(nodes Shape, filters ...ValueFilter) Shape {
 	}
 }
 
+// AddMappers maps values of the nodes set. Adjacent mappers are merged into a single Map shape.
+func AddMappers(nodes Shape, mappers ...iterator.ValueMapperFunc) Shape {
+	if len(mappers) == 0 {
+		return nodes
+	}
+	if s, ok := nodes.(Map); ok {
+		arr := make([]iterator.ValueMapperFunc, 0, len(s.Mappers)+len(mappers))
+		arr = append(arr, s.Mappers...)
+		arr = append(arr, mappers...)
+		return Map{From: s.From, Mappers: arr}
+	}
+	if nodes == nil {
+		nodes = AllNodes{}
+	}
+	return Map{
+		From:    nodes,
+		Mappers: mappers,
+	}
+}
+
 func Compare(nodes Shape, op iterator.Operator, v quad.Value) Shape {
 	return AddFilters(nodes, Comparison{Op: op, Val: v})
 }
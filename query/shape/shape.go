@@ -2,16 +2,21 @@ package shape
 
 import (
 	"context"
+	"math/rand"
 	"os"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/refs"
 	"github.com/cayleygraph/quad"
+	"github.com/cayleygraph/quad/voc/xsd"
 )
 
 var (
@@ -287,6 +292,39 @@ func (s Except) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
 	return s, opt
 }
 
+// ExceptTag removes paths from the source, if the value of a tag is found in a tag of any path of the excluded shape.
+// Paths without the tag are kept.
+type ExceptTag struct {
+	From       Shape  // source paths
+	Exclude    Shape  // paths with excluded tag values
+	Tag        string // tag to check on the source paths
+	ExcludeTag string // tag with excluded values; empty means the same as Tag
+}
+
+func (s ExceptTag) BuildIterator(qs graph.QuadStore) iterator.Shape {
+	from := s.From.BuildIterator(qs)
+	if IsNull(s.Exclude) {
+		return from
+	}
+	return iterator.NewExceptTag(from, s.Exclude.BuildIterator(qs), s.Tag, s.ExcludeTag)
+}
+func (s ExceptTag) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
+	var opt, opta bool
+	s.From, opt = s.From.Optimize(ctx, r)
+	s.Exclude, opta = s.Exclude.Optimize(ctx, r)
+	opt = opt || opta
+	if r != nil {
+		ns, nopt := r.OptimizeShape(ctx, s)
+		return ns, opt || nopt
+	}
+	if IsNull(s.From) {
+		return nil, true
+	} else if IsNull(s.Exclude) {
+		return s.From, true
+	}
+	return s, opt
+}
+
 // ValueFilter is an interface for iterator wrappers that can filter node values.
 type ValueFilter interface {
 	BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape
@@ -326,6 +364,44 @@ func (s Filter) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
 	return s, opt
 }
 
+// Map replaces all values from the source with values returned by a list of mappers.
+//
+// Mappers are applied in a single pass, thus each value is resolved only once regardless of the number of mappers.
+type Map struct {
+	From    Shape                      // source that will be mapped
+	Mappers []iterator.ValueMapperFunc // mappers to apply, in order
+}
+
+func (s Map) BuildIterator(qs graph.QuadStore) iterator.Shape {
+	if IsNull(s.From) {
+		return iterator.NewNull()
+	}
+	it := s.From.BuildIterator(qs)
+	if len(s.Mappers) == 0 {
+		return it
+	}
+	return iterator.NewValueMapperChain(qs, it, s.Mappers...)
+}
+func (s Map) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
+	if IsNull(s.From) {
+		return nil, true
+	}
+	var opt bool
+	s.From, opt = s.From.Optimize(ctx, r)
+	if r != nil {
+		ns, nopt := r.OptimizeShape(ctx, s)
+		return ns, opt || nopt
+	}
+	if IsNull(s.From) {
+		return nil, true
+	} else if len(s.Mappers) == 0 {
+		return s.From, true
+	} else if sub, ok := s.From.(Map); ok {
+		return AddMappers(sub, s.Mappers...), true
+	}
+	return s, opt
+}
+
 var _ ValueFilter = Comparison{}
 
 // Comparison is a value filter that evaluates binary operation in reference to a fixed value.
@@ -338,6 +414,39 @@ func (f Comparison) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterato
 	return iterator.NewComparison(it, f.Op, f.Val, qs)
 }
 
+var _ ValueFilter = Between{}
+
+// Between is a value filter that passes values within a range, checking both bounds in one pass.
+//
+// Values are compared the same way as with Comparison, except that integers and floats are compared
+// numerically with each other, thus a range of floats may contain integer values and vice versa.
+type Between struct {
+	Low, High quad.Value
+	Inclusive bool // bounds are included in the range
+}
+
+func (f Between) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	lo, hi := iterator.CompareGT, iterator.CompareLT
+	if f.Inclusive {
+		lo, hi = iterator.CompareGTE, iterator.CompareLTE
+	}
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		return compareNumeric(v, lo, f.Low) && compareNumeric(v, hi, f.High), nil
+	})
+}
+
+// compareNumeric is the same as iterator.RunValueOp, but compares integers and floats numerically.
+func compareNumeric(a quad.Value, op iterator.Operator, b quad.Value) bool {
+	switch a.(type) {
+	case quad.Int, quad.Float:
+		switch b.(type) {
+		case quad.Int, quad.Float:
+			return iterator.RunNumOp(a, op, b)
+		}
+	}
+	return iterator.RunValueOp(a, op, b)
+}
+
 var _ ValueFilter = Regexp{}
 
 // Regexp filters values using regular expression.
@@ -362,7 +471,8 @@ var _ ValueFilter = Wildcard{}
 //   % - zero or more characters
 //   ? - exactly one character
 type Wildcard struct {
-	Pattern string // allowed wildcards are: % and ?
+	Pattern    string // allowed wildcards are: % and ?
+	IgnoreCase bool   // match letters regardless of their case
 }
 
 // Regexp returns an analog regexp pattern in format accepted by Go stdlib (RE2).
@@ -386,6 +496,9 @@ func (f Wildcard) Regexp() string {
 		any, `.*`,
 		`\?`, `.`,
 	).Replace(pattern)
+	if f.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
 	return pattern
 }
 
@@ -402,6 +515,215 @@ func (f Wildcard) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.
 	return iterator.NewRegexWithRefs(it, re, qs)
 }
 
+var _ ValueFilter = Prefix{}
+
+// Prefix is a filter that passes only string values and IRIs that start with a given prefix.
+//
+// Unlike an equivalent Wildcard pattern, it can be translated by backends to a range lookup.
+// See Range for the bounds of this range. Case-insensitive prefixes have no such range.
+type Prefix struct {
+	Prefix     string
+	IgnoreCase bool // match letters regardless of their case
+}
+
+// Range returns a range of strings that start with the prefix: from is inclusive and to is exclusive.
+// If the range has no upper bound, to is empty and ok is false.
+//
+// The upper bound is a valid UTF-8 string if the prefix is valid.
+func (f Prefix) Range() (from, to string, ok bool) {
+	end := f.Prefix
+	for end != "" {
+		r, n := utf8.DecodeLastRuneInString(end)
+		end = end[:len(end)-n]
+		if r == utf8.RuneError && n == 1 {
+			// not a valid UTF-8 sequence; increment the byte instead
+			if b := f.Prefix[len(end)]; b < 0xff {
+				return f.Prefix, end + string([]byte{b + 1}), true
+			}
+			continue
+		} else if r == unicode.MaxRune {
+			continue
+		}
+		r++
+		if r >= surrogateMin && r <= surrogateMax {
+			r = surrogateMax + 1
+		}
+		return f.Prefix, end + string(r), true
+	}
+	return f.Prefix, "", false
+}
+
+// surrogate halves are not valid in UTF-8
+const (
+	surrogateMin = 0xd800
+	surrogateMax = 0xdfff
+)
+
+// hasPrefixFold is the same as strings.HasPrefix, but letters are compared regardless of their case.
+func hasPrefixFold(s, prefix string) bool {
+	for _, r := range prefix {
+		if s == "" {
+			return false
+		}
+		c, n := utf8.DecodeRuneInString(s)
+		if c != r && !strings.EqualFold(string(c), string(r)) {
+			return false
+		}
+		s = s[n:]
+	}
+	return true
+}
+
+func (f Prefix) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	if f.Prefix == "" {
+		return it
+	}
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		var s string
+		switch v := v.(type) {
+		case quad.String:
+			s = string(v)
+		case quad.LangString:
+			s = string(v.Value)
+		case quad.TypedString:
+			s = string(v.Value)
+		case quad.IRI:
+			s = string(v)
+		case quad.BNode:
+			s = string(v)
+		default:
+			return false, nil
+		}
+		if f.IgnoreCase {
+			return hasPrefixFold(s, f.Prefix), nil
+		}
+		return strings.HasPrefix(s, f.Prefix), nil
+	})
+}
+
+var _ ValueFilter = AnyOf{}
+
+// AnyOf is a filter that passes values that pass at least one of the given filters.
+type AnyOf struct {
+	Filters []ValueFilter
+}
+
+func (f AnyOf) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	switch len(f.Filters) {
+	case 0:
+		return iterator.NewNull()
+	case 1:
+		return f.Filters[0].BuildIterator(qs, it)
+	}
+	// check each value separately instead of merging filtered results,
+	// thus values are returned in the same order and with the same paths as in the source
+	return iterator.NewAnyValueFilter(it, func(cur iterator.Shape) []iterator.Shape {
+		filters := make([]iterator.Shape, 0, len(f.Filters))
+		for _, vf := range f.Filters {
+			filters = append(filters, vf.BuildIterator(qs, cur))
+		}
+		return filters
+	})
+}
+
+var _ ValueFilter = InSet{}
+
+// InSet is a filter that passes only values that are present in a given set.
+//
+// The set is not copied, thus it can be shared between multiple queries running concurrently,
+// but it must not be modified while any of these queries is running.
+type InSet struct {
+	Set map[quad.Value]struct{}
+}
+
+func (f InSet) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	if len(f.Set) == 0 {
+		return iterator.NewNull()
+	}
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		_, ok := f.Set[v]
+		return ok, nil
+	})
+}
+
+var _ ValueFilter = LangMatches{}
+
+// LangMatches is a filter that passes only language-tagged strings with a tag that matches a given
+// language range, according to basic filtering from RFC 4647. Matching is case-insensitive.
+//
+// For example, range "en" matches tags "en" and "en-US", but not "eng". Range "*" matches any tag.
+type LangMatches struct {
+	Range string
+}
+
+// Matches checks if a language tag matches the range.
+func (f LangMatches) Matches(tag string) bool {
+	if tag == "" {
+		return false
+	} else if f.Range == "*" {
+		return true
+	}
+	if len(tag) < len(f.Range) || !strings.EqualFold(tag[:len(f.Range)], f.Range) {
+		return false
+	}
+	return len(tag) == len(f.Range) || tag[len(f.Range)] == '-'
+}
+
+func (f LangMatches) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	if f.Range == "" {
+		return iterator.NewNull()
+	}
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		ls, ok := v.(quad.LangString)
+		return ok && f.Matches(ls.Lang), nil
+	})
+}
+
+var _ ValueFilter = Datatype{}
+
+// Datatype is a filter that passes only typed literals with one of the given datatypes.
+//
+// Native values like quad.Int or quad.Time are matched by the datatype of their typed string representation.
+// Plain strings are matched as xsd:string only if Strings is set; other values are filtered out.
+type Datatype struct {
+	Types   []quad.IRI
+	Strings bool // match plain strings as xsd:string
+}
+
+// Matches checks if the value has one of the datatypes.
+func (f Datatype) Matches(v quad.Value) bool {
+	var typ quad.IRI
+	switch v := v.(type) {
+	case quad.String:
+		if !f.Strings {
+			return false
+		}
+		typ = xsd.String
+	case quad.TypedString:
+		typ = v.Type
+	case quad.TypedStringer:
+		typ = v.TypedString().Type
+	default:
+		return false
+	}
+	typ = typ.Full()
+	for _, t := range f.Types {
+		if t.Full() == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Datatype) BuildIterator(qs graph.QuadStore, it iterator.Shape) iterator.Shape {
+	if len(f.Types) == 0 {
+		return iterator.NewNull()
+	}
+	return iterator.NewValueFilter(qs, it, func(v quad.Value) (bool, error) {
+		return f.Matches(v), nil
+	})
+}
+
 // Count returns a count of objects in source as a single value. It always returns exactly one value.
 type Count struct {
 	Values Shape
@@ -861,6 +1183,9 @@ var MaterializeThreshold = 100 // TODO: tune
 type Materialize struct {
 	Size   int // approximate size; zero means undefined
 	Values Shape
+	// Cache is optional. If set, results are loaded once and shared between all iterators
+	// built from this shape for the same QuadStore.
+	Cache *MaterializeCache
 }
 
 func (s Materialize) BuildIterator(qs graph.QuadStore) iterator.Shape {
@@ -868,8 +1193,27 @@ func (s Materialize) BuildIterator(qs graph.QuadStore) iterator.Shape {
 		return iterator.NewNull()
 	}
 	it := s.Values.BuildIterator(qs)
+	if s.Cache != nil {
+		return iterator.NewMaterializeCached(it, int64(s.Size), s.Cache.forStore(qs))
+	}
 	return iterator.NewMaterializeWithSize(it, int64(s.Size))
 }
+
+// MaterializeCache shares results of Materialize between iterators built for the same QuadStore.
+type MaterializeCache struct {
+	mu    sync.Mutex
+	qs    graph.QuadStore
+	cache *iterator.MaterializeCache
+}
+
+func (c *MaterializeCache) forStore(qs graph.QuadStore) *iterator.MaterializeCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil || c.qs != qs {
+		c.qs, c.cache = qs, iterator.NewMaterializeCache()
+	}
+	return c.cache
+}
 func (s Materialize) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
 	if IsNull(s.Values) {
 		return nil, true
@@ -902,6 +1246,30 @@ func clearFixedTags(arr []Shape) ([]Shape, map[string]refs.Ref) {
 	return arr, tags
 }
 
+// clearCommonFixedTags is like clearFixedTags, but only lifts tags if all shapes have the same set of fixed tags.
+// This is required for unions, since each branch may have a different value for the same tag.
+func clearCommonFixedTags(arr []Shape) ([]Shape, map[string]refs.Ref) {
+	if len(arr) == 0 {
+		return arr, nil
+	}
+	first, ok := arr[0].(FixedTags)
+	if !ok {
+		return arr, nil
+	}
+	for _, s := range arr[1:] {
+		ft, ok := s.(FixedTags)
+		if !ok || len(ft.Tags) != len(first.Tags) {
+			return arr, nil
+		}
+		for k, v := range first.Tags {
+			if v2, ok := ft.Tags[k]; !ok || refs.ToKey(v) != refs.ToKey(v2) {
+				return arr, nil
+			}
+		}
+	}
+	return clearFixedTags(arr)
+}
+
 // Intersect computes an intersection of nodes between multiple queries. Similar to And iterator.
 type Intersect []Shape
 
@@ -1275,7 +1643,7 @@ func (s Union) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
 		ns, nopt := r.OptimizeShape(ctx, s)
 		return ns, opt || nopt
 	}
-	if arr, ft := clearFixedTags([]Shape(s)); ft != nil {
+	if arr, ft := clearCommonFixedTags([]Shape(s)); ft != nil {
 		ns, _ := FixedTags{On: Union(arr), Tags: ft}.Optimize(ctx, r)
 		return ns, true
 	}
@@ -1435,8 +1803,74 @@ func FilterQuads(subject, predicate, object, label []quad.Value) Shape {
 	return q
 }
 
+// SkipLast omits N last nodes. See iterator.SkipLast.
+type SkipLast struct {
+	From Shape
+	N    int64
+}
+
+func (s SkipLast) BuildIterator(qs graph.QuadStore) iterator.Shape {
+	if IsNull(s.From) {
+		return iterator.NewNull()
+	}
+	it := s.From.BuildIterator(qs)
+	if s.N <= 0 {
+		return it
+	}
+	return iterator.NewSkipLast(it, s.N)
+}
+func (s SkipLast) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
+	if IsNull(s.From) {
+		return nil, true
+	}
+	var opt bool
+	s.From, opt = s.From.Optimize(ctx, r)
+	if IsNull(s.From) {
+		return nil, true
+	} else if s.N <= 0 {
+		return s.From, true
+	}
+	if r != nil {
+		ns, nopt := r.OptimizeShape(ctx, s)
+		return ns, opt || nopt
+	}
+	return s, opt
+}
+
+// Sample selects a random subset of up to N nodes. See iterator.Sample.
+type Sample struct {
+	From Shape
+	N    int
+	// Rand is a source of randomness. If nil, a source seeded with current time is used.
+	Rand *rand.Rand
+}
+
+func (s Sample) BuildIterator(qs graph.QuadStore) iterator.Shape {
+	if IsNull(s.From) || s.N <= 0 {
+		return iterator.NewNull()
+	}
+	it := s.From.BuildIterator(qs)
+	return iterator.NewSample(qs, it, s.N, s.Rand)
+}
+func (s Sample) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
+	if IsNull(s.From) || s.N <= 0 {
+		return nil, true
+	}
+	var opt bool
+	s.From, opt = s.From.Optimize(ctx, r)
+	if IsNull(s.From) {
+		return nil, true
+	}
+	if r != nil {
+		ns, nopt := r.OptimizeShape(ctx, s)
+		return ns, opt || nopt
+	}
+	return s, opt
+}
+
 type Sort struct {
 	From Shape
+	Desc bool // order values in descending order
 }
 
 func (s Sort) BuildIterator(qs graph.QuadStore) iterator.Shape {
@@ -1444,6 +1878,9 @@ func (s Sort) BuildIterator(qs graph.QuadStore) iterator.Shape {
 		return iterator.NewNull()
 	}
 	it := s.From.BuildIterator(qs)
+	if s.Desc {
+		return iterator.NewSortDesc(qs, it)
+	}
 	return iterator.NewSort(qs, it)
 }
 func (s Sort) Optimize(ctx context.Context, r Optimizer) (Shape, bool) {
@@ -28,6 +28,7 @@ import (
 	"github.com/cayleygraph/cayley/graph/refs"
 	. "github.com/cayleygraph/cayley/query/shape"
 	"github.com/cayleygraph/quad"
+	"github.com/cayleygraph/quad/voc/xsd"
 )
 
 func intVal(v int) refs.Ref {
@@ -268,6 +269,30 @@ var optimizeCases = []struct {
 			}},
 		},
 	},
+	{ // fixed tags with different values must stay in union branches
+		name: "keep different fixed tags in union",
+		from: Union{
+			FixedTags{Tags: map[string]refs.Ref{"dir": intVal(1)}, On: Fixed{intVal(3)}},
+			FixedTags{Tags: map[string]refs.Ref{"dir": intVal(2)}, On: Fixed{intVal(4)}},
+		},
+		opt: false,
+		expect: Union{
+			FixedTags{Tags: map[string]refs.Ref{"dir": intVal(1)}, On: Fixed{intVal(3)}},
+			FixedTags{Tags: map[string]refs.Ref{"dir": intVal(2)}, On: Fixed{intVal(4)}},
+		},
+	},
+	{ // same fixed tags can be popped from union
+		name: "pop common fixed tags from union",
+		from: Union{
+			FixedTags{Tags: map[string]refs.Ref{"dir": intVal(1)}, On: Fixed{intVal(3)}},
+			FixedTags{Tags: map[string]refs.Ref{"dir": intVal(1)}, On: Fixed{intVal(4)}},
+		},
+		opt: true,
+		expect: FixedTags{
+			Tags: map[string]refs.Ref{"dir": intVal(1)},
+			On:   Union{Fixed{intVal(3)}, Fixed{intVal(4)}},
+		},
+	},
 	{ // remove optional empty set from intersect
 		name: "remove optional empty set",
 		from: IntersectOpt{
@@ -395,3 +420,77 @@ func TestWalk(t *testing.T) {
 		"shape.QuadsAction",
 	}, types)
 }
+
+func TestMapMerge(t *testing.T) {
+	inc := func(v quad.Value) (quad.Value, error) {
+		return v.(quad.Int) + 1, nil
+	}
+	var s Shape = Fixed{intVal(1)}
+	for i := 0; i < 3; i++ {
+		s = AddMappers(s, inc)
+	}
+	m, ok := s.(Map)
+	require.True(t, ok, "expected a map, got: %T", s)
+	require.Equal(t, Fixed{intVal(1)}, m.From)
+	require.Len(t, m.Mappers, 3)
+
+	// nested maps are also merged by the optimizer
+	s, _ = Map{From: Map{From: Fixed{intVal(1)}, Mappers: []iterator.ValueMapperFunc{inc}}, Mappers: []iterator.ValueMapperFunc{inc}}.Optimize(context.TODO(), nil)
+	m, ok = s.(Map)
+	require.True(t, ok, "expected a map, got: %T", s)
+	require.Equal(t, Fixed{intVal(1)}, m.From)
+	require.Len(t, m.Mappers, 2)
+}
+
+func TestLangMatches(t *testing.T) {
+	for _, c := range []struct {
+		rng, tag string
+		ok       bool
+	}{
+		{rng: "en", tag: "en", ok: true},
+		{rng: "en", tag: "en-US", ok: true},
+		{rng: "en", tag: "EN-us", ok: true},
+		{rng: "en-US", tag: "en", ok: false},
+		{rng: "en", tag: "eng", ok: false},
+		{rng: "*", tag: "fr", ok: true},
+		{rng: "*", tag: "", ok: false},
+	} {
+		require.Equal(t, c.ok, LangMatches{Range: c.rng}.Matches(c.tag), "%q ~ %q", c.rng, c.tag)
+	}
+}
+
+func TestDatatype(t *testing.T) {
+	f := Datatype{Types: []quad.IRI{xsd.Integer, "xsd:dateTime"}}
+	require.True(t, f.Matches(quad.Int(1)))
+	require.True(t, f.Matches(quad.TypedString{Value: "1", Type: "xsd:integer"}))
+	require.True(t, f.Matches(quad.Time{}))
+	require.False(t, f.Matches(quad.Float(1)))
+	require.False(t, f.Matches(quad.String("1")))
+	require.False(t, f.Matches(quad.IRI("1")))
+
+	f = Datatype{Types: []quad.IRI{xsd.String}}
+	require.False(t, f.Matches(quad.String("a")))
+	f.Strings = true
+	require.True(t, f.Matches(quad.String("a")))
+}
+
+func TestPrefixRange(t *testing.T) {
+	for _, c := range []struct {
+		prefix   string
+		from, to string
+		ok       bool
+	}{
+		{prefix: "ab", from: "ab", to: "ac", ok: true},
+		{prefix: "a\xff", from: "a\xff", to: "b", ok: true},
+		{prefix: "\xff\xff", from: "\xff\xff", ok: false},
+		{prefix: "a¿", from: "a¿", to: "aÀ", ok: true},
+		{prefix: "a\U0010ffff", from: "a\U0010ffff", to: "b", ok: true},
+		{prefix: "\ud7ff", from: "\ud7ff", to: "\ue000", ok: true},
+		{prefix: "", from: "", ok: false},
+	} {
+		from, to, ok := Prefix{Prefix: c.prefix}.Range()
+		require.Equal(t, c.from, from)
+		require.Equal(t, c.to, to)
+		require.Equal(t, c.ok, ok)
+	}
+}